@@ -0,0 +1,458 @@
+package audioproc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+type CrossfadeCurve int
+
+const (
+	CrossfadeLinear CrossfadeCurve = iota
+	// constant power: sum of squared gains is 1 over the fade
+	CrossfadeEqualPower
+)
+
+func ParseCrossfadeCurve(s string) (CrossfadeCurve, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "linear":
+		return CrossfadeLinear, nil
+	case "equal-power", "equalpower":
+		return CrossfadeEqualPower, nil
+	}
+	return CrossfadeLinear, fmt.Errorf("unknown crossfade curve: %s", s)
+}
+
+func (c CrossfadeCurve) String() string {
+	switch c {
+	case CrossfadeLinear:
+		return "linear"
+	case CrossfadeEqualPower:
+		return "equal-power"
+	}
+	return fmt.Sprintf("CrossfadeCurve(%d)", int(c))
+}
+
+// gains returns gains of fading out and fading in tracks at fade position t in [0, 1]
+func (c CrossfadeCurve) gains(t float64) (float64, float64) {
+	if c == CrossfadeEqualPower {
+		return math.Cos(t * math.Pi / 2), math.Sin(t * math.Pi / 2)
+	}
+	return 1 - t, t
+}
+
+type CrossfadeOptions struct {
+	// crossfade length, 0 - gapless playback
+	Duration        time.Duration
+	Curve           CrossfadeCurve
+	FramesPerBuffer int
+	// OpenTrack starts decoding of the track
+	OpenTrack func(ctx context.Context, fileName string) (audiosource.AudioStream, error)
+}
+
+type SetCrossfadeOptionsFn func(opt *CrossfadeOptions)
+
+func WithCrossfadeDuration(dur time.Duration) SetCrossfadeOptionsFn {
+	return func(opt *CrossfadeOptions) {
+		opt.Duration = dur
+	}
+}
+
+func WithCrossfadeCurve(curve CrossfadeCurve) SetCrossfadeOptionsFn {
+	return func(opt *CrossfadeOptions) {
+		opt.Curve = curve
+	}
+}
+
+func WithFramesPerBuffer(framesPerBuffer int) SetCrossfadeOptionsFn {
+	return func(opt *CrossfadeOptions) {
+		opt.FramesPerBuffer = framesPerBuffer
+	}
+}
+
+func WithOpenTrack(openFn func(ctx context.Context, fileName string) (audiosource.AudioStream, error)) SetCrossfadeOptionsFn {
+	return func(opt *CrossfadeOptions) {
+		opt.OpenTrack = openFn
+	}
+}
+
+// crossfadeTrack is a decoded track converted to the output format
+type crossfadeTrack struct {
+	idx       int
+	stream    audiosource.AudioStream
+	resampler *streamResampler
+	channels  int
+	// converted samples not played yet
+	samples []int16
+	eof     bool
+}
+
+type crossfadeStream struct {
+	opt         CrossfadeOptions
+	fileNames   []string
+	audioFormat types.FrameFormat
+	stream      chan audiosource.AudioSamplesPacket
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mxStatus       sync.RWMutex
+	trackIdx       int
+	nextIdx        int
+	elapsedSamples int
+}
+
+// NewCrossfadeStream plays files one after another, the end of each track
+// is mixed with the beginning of the next one. Next track is opened (and
+// decoded ahead) while the current one plays. Output has format of the first
+// track, other tracks are resampled and their channels converted.
+func NewCrossfadeStream(ctx context.Context,
+	fileNames []string,
+	opts ...SetCrossfadeOptionsFn,
+) (audiosource.AudioStream, error) {
+	opt := CrossfadeOptions{
+		FramesPerBuffer: 2048,
+	}
+	for _, sf := range opts {
+		sf(&opt)
+	}
+	if opt.OpenTrack == nil {
+		framesPerBuffer := opt.FramesPerBuffer
+		opt.OpenTrack = func(ctx context.Context, fileName string) (audiosource.AudioStream, error) {
+			return audiosource.NewMusicAudioProducer(ctx, fileName,
+				audiosource.WithFramesPerBuffer(framesPerBuffer))
+		}
+	}
+
+	cs := crossfadeStream{
+		opt:       opt,
+		fileNames: fileNames,
+		stream:    make(chan audiosource.AudioSamplesPacket, 1),
+		done:      make(chan struct{}),
+		nextIdx:   -1,
+	}
+
+	first := cs.openTrack(ctx, 0)
+	if first == nil {
+		return nil, fmt.Errorf("no playable tracks")
+	}
+
+	go cs.run(ctx, first)
+
+	return &cs, nil
+}
+
+// openTrack opens first playable track starting at index idx
+func (cs *crossfadeStream) openTrack(ctx context.Context, idx int) *crossfadeTrack {
+	for ; idx < len(cs.fileNames); idx++ {
+		stream, err := cs.opt.OpenTrack(ctx, cs.fileNames[idx])
+		if err != nil {
+			fmt.Printf("ERR: %s: %v\n", cs.fileNames[idx], err)
+			continue
+		}
+
+		trackFormat := stream.GetFormat()
+		if trackFormat.BitsPerSample != 16 {
+			fmt.Printf("ERR: %s: bits per sample %d not supported\n", cs.fileNames[idx], trackFormat.BitsPerSample)
+			stream.Close()
+			continue
+		}
+
+		if cs.audioFormat == (types.FrameFormat{}) {
+			// first track defines output format
+			cs.audioFormat = trackFormat
+		}
+
+		t := crossfadeTrack{
+			idx:      idx,
+			stream:   stream,
+			channels: trackFormat.Channels,
+		}
+		if trackFormat.SampleRate != cs.audioFormat.SampleRate {
+			t.resampler, err = newStreamResampler(trackFormat.SampleRate,
+				cs.audioFormat.SampleRate, cs.audioFormat.Channels)
+			if err != nil {
+				fmt.Printf("ERR: %s: %v\n", cs.fileNames[idx], err)
+				stream.Close()
+				continue
+			}
+		}
+
+		return &t
+	}
+
+	return nil
+}
+
+func (cs *crossfadeStream) run(ctx context.Context, cur *crossfadeTrack) {
+	defer close(cs.stream)
+
+	channels := cs.audioFormat.Channels
+	fadeSamples := int(cs.opt.Duration.Seconds()*float64(cs.audioFormat.SampleRate)) * channels
+	packetSamples := cs.opt.FramesPerBuffer * channels
+
+	var next *crossfadeTrack
+	defer func() {
+		cur.stream.Close()
+		if next != nil {
+			next.stream.Close()
+		}
+	}()
+
+	for {
+		// look ahead: next track decodes while the current one plays
+		next = cs.openTrack(ctx, cur.idx+1)
+		nextIdx := -1
+		if next != nil {
+			nextIdx = next.idx
+		}
+		cs.setTrack(cur.idx, nextIdx)
+
+		// play current track keeping the fade out part buffered
+		for {
+			if !cs.fill(ctx, cur, fadeSamples+packetSamples) {
+				return
+			}
+			if len(cur.samples) < fadeSamples+packetSamples {
+				break
+			}
+			if !cs.emit(ctx, cur.take(packetSamples)) {
+				return
+			}
+		}
+
+		if next == nil {
+			cs.emit(ctx, cur.take(len(cur.samples)))
+			return
+		}
+
+		if len(cur.samples) > fadeSamples {
+			if !cs.emit(ctx, cur.take(len(cur.samples)-fadeSamples)) {
+				return
+			}
+		}
+
+		tail := cur.take(len(cur.samples))
+		if !cs.fill(ctx, next, len(tail)) {
+			return
+		}
+		head := next.take(min(len(tail), len(next.samples)))
+
+		cur.stream.Close()
+		cur, next = next, nil
+
+		if !cs.emit(ctx, cs.mix(tail, head)) {
+			return
+		}
+	}
+}
+
+// mix fades out tail of the current track and fades in head of the next
+func (cs *crossfadeStream) mix(tail []int16, head []int16) []int16 {
+	channels := cs.audioFormat.Channels
+	nFrames := len(tail) / channels
+
+	out := make([]int16, len(tail))
+	for i := range nFrames {
+		t := (float64(i) + 0.5) / float64(nFrames)
+		gainOut, gainIn := cs.opt.Curve.gains(t)
+
+		for ch := range channels {
+			idx := i*channels + ch
+			v := float64(tail[idx]) * gainOut
+			if idx < len(head) {
+				v += float64(head[idx]) * gainIn
+			}
+			v = min(max(math.Round(v), math.MinInt16), math.MaxInt16)
+			out[idx] = int16(v)
+		}
+	}
+
+	return out
+}
+
+// fill decodes track until it has at least n samples or track ended
+func (cs *crossfadeStream) fill(ctx context.Context, t *crossfadeTrack, n int) bool {
+	for !t.eof && len(t.samples) < n {
+		select {
+		case pkt, ok := <-t.stream.Stream():
+			if !ok {
+				t.eof = true
+				if t.resampler != nil {
+					audio, err := t.resampler.Flush()
+					if err != nil {
+						fmt.Printf("ERR: %v\n", err)
+					}
+					t.samples = appendSamples(t.samples, audio)
+				}
+				break
+			}
+
+			audio := convertChannels(pkt.Audio[:pkt.SamplesCount*t.channels*2],
+				t.channels, cs.audioFormat.Channels)
+			if t.resampler != nil {
+				var err error
+				audio, err = t.resampler.Process(audio)
+				if err != nil {
+					fmt.Printf("ERR: %v\n", err)
+					t.eof = true
+				}
+			}
+			t.samples = appendSamples(t.samples, audio)
+		case <-ctx.Done():
+			return false
+		case <-cs.done:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t *crossfadeTrack) take(n int) []int16 {
+	out := t.samples[:n]
+	t.samples = t.samples[n:]
+	return out
+}
+
+// emit sends samples in packets
+func (cs *crossfadeStream) emit(ctx context.Context, samples []int16) bool {
+	channels := cs.audioFormat.Channels
+	packetSamples := cs.opt.FramesPerBuffer * channels
+
+	for len(samples) > 0 {
+		n := min(len(samples), packetSamples)
+
+		audio := make([]byte, 2*n)
+		for i, s := range samples[:n] {
+			audio[2*i] = byte(s)
+			audio[2*i+1] = byte(s >> 8)
+		}
+		samples = samples[n:]
+
+		pkt := audiosource.AudioSamplesPacket{
+			Format:       cs.audioFormat,
+			Audio:        audio,
+			SamplesCount: n / channels,
+		}
+
+		select {
+		case cs.stream <- pkt:
+		case <-ctx.Done():
+			return false
+		case <-cs.done:
+			return false
+		}
+
+		cs.mxStatus.Lock()
+		cs.elapsedSamples += pkt.SamplesCount
+		cs.mxStatus.Unlock()
+	}
+
+	return true
+}
+
+func (cs *crossfadeStream) setTrack(idx int, nextIdx int) {
+	cs.mxStatus.Lock()
+	defer cs.mxStatus.Unlock()
+
+	if cs.trackIdx != idx {
+		cs.elapsedSamples = 0
+	}
+	cs.trackIdx = idx
+	cs.nextIdx = nextIdx
+}
+
+// appendSamples appends 16 bit little endian samples
+func appendSamples(samples []int16, audio []byte) []int16 {
+	for i := 0; i+1 < len(audio); i += 2 {
+		samples = append(samples, int16(uint16(audio[i])|uint16(audio[i+1])<<8))
+	}
+	return samples
+}
+
+// convertChannels mixes down to mono or maps input channels to output channels
+func convertChannels(audio []byte, inChannels int, outChannels int) []byte {
+	if inChannels == outChannels {
+		return audio
+	}
+
+	nFrames := len(audio) / (2 * inChannels)
+	out := make([]byte, 0, 2*nFrames*outChannels)
+
+	sample := func(frame int, ch int) int {
+		idx := 2 * (frame*inChannels + ch)
+		return int(int16(uint16(audio[idx]) | uint16(audio[idx+1])<<8))
+	}
+
+	for i := range nFrames {
+		if outChannels == 1 {
+			sum := 0
+			for ch := range inChannels {
+				sum += sample(i, ch)
+			}
+			v := int16(sum / inChannels)
+			out = append(out, byte(v), byte(v>>8))
+			continue
+		}
+		for ch := range outChannels {
+			v := int16(sample(i, ch%inChannels))
+			out = append(out, byte(v), byte(v>>8))
+		}
+	}
+
+	return out
+}
+
+func (cs *crossfadeStream) GetFormat() types.FrameFormat {
+	return cs.audioFormat
+}
+
+func (cs *crossfadeStream) Status() map[string]string {
+	cs.mxStatus.RLock()
+	defer cs.mxStatus.RUnlock()
+
+	attrs := make(map[string]string)
+
+	attrs["format"] = fmt.Sprintf("%d:%d:%d",
+		cs.audioFormat.SampleRate,
+		cs.audioFormat.BitsPerSample,
+		cs.audioFormat.Channels,
+	)
+
+	attrs["track"] = fmt.Sprintf("%d", cs.trackIdx)
+	attrs["file"] = cs.fileNames[cs.trackIdx]
+	if cs.nextIdx >= 0 {
+		attrs["next"] = cs.fileNames[cs.nextIdx]
+	}
+
+	attrs["elapsed_samples"] = fmt.Sprintf("%d", cs.elapsedSamples)
+
+	elapsed := float64(cs.elapsedSamples) / float64(cs.audioFormat.SampleRate)
+
+	dur := time.Second * time.Duration(elapsed)
+
+	attrs["elapsed_str"] = dur.String()
+
+	attrs["elapsed"] = fmt.Sprintf("%.6f", elapsed)
+
+	return attrs
+}
+
+func (cs *crossfadeStream) Stream() <-chan audiosource.AudioSamplesPacket {
+	return cs.stream
+}
+
+func (cs *crossfadeStream) Close() error {
+	cs.closeOnce.Do(func() {
+		close(cs.done)
+	})
+	return nil
+}
@@ -0,0 +1,85 @@
+package audioproc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+type constStream struct {
+	audioFormat types.FrameFormat
+	stream      chan audiosource.AudioSamplesPacket
+}
+
+// newConstStream produces nSamples mono samples with the value
+func newConstStream(nSamples int, value int16) audiosource.AudioStream {
+	s := constStream{
+		audioFormat: types.FrameFormat{SampleRate: 1000, Channels: 1, BitsPerSample: 16},
+		stream:      make(chan audiosource.AudioSamplesPacket),
+	}
+	go func() {
+		defer close(s.stream)
+		for nSamples > 0 {
+			n := min(nSamples, 300)
+			s.stream <- constPacket(1, n, value)
+			nSamples -= n
+		}
+	}()
+	return &s
+}
+
+func (s *constStream) GetFormat() types.FrameFormat                  { return s.audioFormat }
+func (s *constStream) Status() map[string]string                     { return nil }
+func (s *constStream) Stream() <-chan audiosource.AudioSamplesPacket { return s.stream }
+func (s *constStream) Close() error                                  { return nil }
+
+func Test_CrossfadeStream(t *testing.T) {
+	tracks := map[string]audiosource.AudioStream{
+		"a": newConstStream(2000, 1000),
+		"b": newConstStream(1500, 3000),
+	}
+
+	stream, err := NewCrossfadeStream(context.Background(), []string{"a", "missing", "b"},
+		WithCrossfadeDuration(500*time.Millisecond),
+		WithFramesPerBuffer(128),
+		WithOpenTrack(func(ctx context.Context, fileName string) (audiosource.AudioStream, error) {
+			s, ok := tracks[fileName]
+			if !ok {
+				return nil, fmt.Errorf("not found")
+			}
+			return s, nil
+		}))
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	var samples []int16
+	for pkt := range stream.Stream() {
+		samples = append(samples, samplesOf(pkt)...)
+	}
+
+	// tracks overlap by 500 samples
+	assert.Equal(t, 2000+1500-500, len(samples))
+	assert.Equal(t, int16(1000), samples[1499])
+	// linear fade: half of each track in the middle
+	assert.InDelta(t, 2000, samples[1750], 5)
+	assert.Equal(t, int16(3000), samples[2000])
+	assert.Equal(t, int16(3000), samples[len(samples)-1])
+}
+
+func Test_CrossfadeCurve(t *testing.T) {
+	gainOut, gainIn := CrossfadeEqualPower.gains(0.5)
+	assert.InDelta(t, 1, gainOut*gainOut+gainIn*gainIn, 1e-9)
+
+	curve, err := ParseCrossfadeCurve("equal-power")
+	assert.NoError(t, err)
+	assert.Equal(t, CrossfadeEqualPower, curve)
+
+	_, err = ParseCrossfadeCurve("log")
+	assert.Error(t, err)
+}
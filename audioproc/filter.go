@@ -0,0 +1,103 @@
+package audioproc
+
+import (
+	"context"
+	"math"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+	"github.com/drgolem/musiclab/types"
+)
+
+// FilterStage applies a filter to each channel of 16 bit audio packets.
+// Filters are designed for the stream sample rate and are redesigned with
+// cleared state on audio format change.
+type FilterStage struct {
+	design func(sampleRate int) dsp.Filter
+
+	audioFormat types.FrameFormat
+	filters     []dsp.Filter
+}
+
+// NewFilterStage returns filter stage, design returns a new filter instance
+// for the sample rate on each call
+func NewFilterStage(design func(sampleRate int) dsp.Filter) *FilterStage {
+	return &FilterStage{
+		design: design,
+	}
+}
+
+// NewEQStage returns filter stage of parametric EQ bands
+func NewEQStage(bands []dsp.EQBand) *FilterStage {
+	return NewFilterStage(func(sampleRate int) dsp.Filter {
+		return dsp.EQCascade(bands, sampleRate)
+	})
+}
+
+// Process filters packets from the input channel. Output channel is closed
+// when input is closed or context is done.
+func (f *FilterStage) Process(ctx context.Context, in <-chan audiosource.AudioSamplesPacket) <-chan audiosource.AudioSamplesPacket {
+	out := make(chan audiosource.AudioSamplesPacket, 1)
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case pkt, ok := <-in:
+				if !ok {
+					return
+				}
+
+				select {
+				case out <- f.apply(pkt):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func (f *FilterStage) apply(pkt audiosource.AudioSamplesPacket) audiosource.AudioSamplesPacket {
+	if pkt.Format.BitsPerSample != 16 || pkt.Format.Channels < 1 {
+		// only 16 bit samples supported
+		return pkt
+	}
+
+	channels := pkt.Format.Channels
+	if pkt.Format != f.audioFormat {
+		f.audioFormat = pkt.Format
+		f.filters = make([]dsp.Filter, channels)
+		for ch := range channels {
+			f.filters[ch] = f.design(pkt.Format.SampleRate)
+		}
+	}
+
+	nSamples := min(pkt.SamplesCount, len(pkt.Audio)/(2*channels))
+	audio := make([]byte, nSamples*channels*2)
+
+	idx := 0
+	for range nSamples {
+		for ch := range channels {
+			s := int16(uint16(pkt.Audio[idx]) | uint16(pkt.Audio[idx+1])<<8)
+			v := math.Round(f.filters[ch].Process(float64(s)))
+			v = min(max(v, math.MinInt16), math.MaxInt16)
+
+			sv := int16(v)
+			audio[idx] = byte(sv)
+			audio[idx+1] = byte(sv >> 8)
+			idx += 2
+		}
+	}
+
+	return audiosource.AudioSamplesPacket{
+		Format:       pkt.Format,
+		Audio:        audio,
+		SamplesCount: nSamples,
+	}
+}
@@ -0,0 +1,53 @@
+package audioproc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+)
+
+func Test_FilterStage(t *testing.T) {
+	ctx := context.Background()
+
+	in := make(chan audiosource.AudioSamplesPacket, 4)
+	for range 4 {
+		in <- constPacket(2, 4410, 10000)
+	}
+	close(in)
+
+	// highpass removes DC
+	stage := NewFilterStage(func(sampleRate int) dsp.Filter {
+		return dsp.ButterworthHighPass(sampleRate, 20, 2)
+	})
+
+	var last []int16
+	packets := 0
+	for pkt := range stage.Process(ctx, in) {
+		assert.Equal(t, 4410, pkt.SamplesCount)
+		last = samplesOf(pkt)
+		packets++
+	}
+	assert.Equal(t, 4, packets)
+
+	// channels are filtered independently with the same result
+	for i := 0; i < len(last); i += 2 {
+		assert.Equal(t, last[i], last[i+1])
+	}
+	assert.InDelta(t, 0, float64(last[len(last)-1]), 2)
+
+	// unity EQ keeps samples
+	bands, err := dsp.ParseEQ("peak:1000:0")
+	assert.NoError(t, err)
+	in = make(chan audiosource.AudioSamplesPacket, 1)
+	in <- constPacket(1, 1000, 1234)
+	close(in)
+	for pkt := range NewEQStage(bands).Process(ctx, in) {
+		for _, s := range samplesOf(pkt) {
+			assert.Equal(t, int16(1234), s)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package audioproc
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+func constPacket(channels int, nSamples int, value int16) audiosource.AudioSamplesPacket {
+	audio := make([]byte, 0, 2*channels*nSamples)
+	for range nSamples * channels {
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(value))
+	}
+	return audiosource.AudioSamplesPacket{
+		Format: types.FrameFormat{
+			SampleRate:    44100,
+			Channels:      channels,
+			BitsPerSample: 16,
+		},
+		Audio:        audio,
+		SamplesCount: nSamples,
+	}
+}
+
+func samplesOf(pkt audiosource.AudioSamplesPacket) []int16 {
+	samples := make([]int16, len(pkt.Audio)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pkt.Audio[2*i:]))
+	}
+	return samples
+}
+
+func Test_ParseVolume(t *testing.T) {
+	v, err := ParseVolume("0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, v)
+
+	v, err = ParseVolume("-6dB")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.501, v, 0.001)
+
+	v, err = ParseVolume("+6 db")
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.995, v, 0.001)
+
+	_, err = ParseVolume("loud")
+	assert.Error(t, err)
+
+	_, err = ParseVolume("-1")
+	assert.Error(t, err)
+}
+
+func Test_GainStageRamp(t *testing.T) {
+	g := NewGainStage()
+
+	in := make(chan audiosource.AudioSamplesPacket, 3)
+	out := g.Process(context.Background(), in)
+
+	// unity gain passes packet through
+	in <- constPacket(1, 4, 1000)
+	assert.Equal(t, []int16{1000, 1000, 1000, 1000}, samplesOf(<-out))
+
+	// volume change is ramped over the packet
+	g.SetVolume(0.5)
+	in <- constPacket(1, 4, 1000)
+	assert.Equal(t, []int16{875, 750, 625, 500}, samplesOf(<-out))
+
+	// mute ramps down to silence
+	g.SetMute(true)
+	in <- constPacket(1, 4, 1000)
+	assert.Equal(t, []int16{375, 250, 125, 0}, samplesOf(<-out))
+
+	close(in)
+	_, ok := <-out
+	assert.False(t, ok)
+}
+
+func Test_GainStagePan(t *testing.T) {
+	g := NewGainStage()
+	g.SetPan(-0.5)
+
+	in := make(chan audiosource.AudioSamplesPacket, 2)
+	out := g.Process(context.Background(), in)
+
+	// first packet starts with target gains, no ramp
+	in <- constPacket(2, 2, 1000)
+	assert.Equal(t, []int16{1000, 500, 1000, 500}, samplesOf(<-out))
+
+	g.SetVolumeDb(24)
+	in <- constPacket(2, 1, 30000)
+	assert.Equal(t, []int16{32767, 32767}, samplesOf(<-out))
+	close(in)
+}
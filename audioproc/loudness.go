@@ -0,0 +1,472 @@
+package audioproc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+	"github.com/drgolem/musiclab/types"
+)
+
+const (
+	// loudness of silence and of too short measurements, LUFS
+	MinLoudness = -120.0
+
+	absoluteGate       = -70.0
+	integratedRelGate  = -10.0
+	loudnessRangeGate  = -20.0
+	truePeakOversample = 4
+	truePeakTapsPhase  = 12
+)
+
+// kWeighting returns BS.1770 pre-filter (high shelf) and RLB highpass
+// filters for the sample rate
+func kWeighting(sampleRate int) (dsp.Biquad, dsp.Biquad) {
+	fs := float64(sampleRate)
+
+	// high shelf, +4 dB above 1.5 kHz
+	f0 := 1681.974450955533
+	gain := 3.999843853973347
+	q := 0.7071752369554196
+
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+
+	shelf := dsp.Biquad{
+		B0: (vh + vb*k/q + k*k) / a0,
+		B1: 2 * (k*k - vh) / a0,
+		B2: (vh - vb*k/q + k*k) / a0,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+
+	// highpass at 38 Hz
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+
+	highpass := dsp.Biquad{
+		B0: 1,
+		B1: -2,
+		B2: 1,
+		A1: 2 * (k*k - 1) / a0,
+		A2: (1 - k/q + k*k) / a0,
+	}
+
+	return shelf, highpass
+}
+
+// channelWeight returns BS.1770 weight of channel in L, R, C, LFE, Ls, Rs
+// order, LFE is excluded
+func channelWeight(ch int, channels int) float64 {
+	if channels < 5 {
+		return 1
+	}
+	switch ch {
+	case 3:
+		if channels == 6 {
+			return 0
+		}
+		return 1.41
+	case 4, 5:
+		return 1.41
+	}
+	return 1
+}
+
+// truePeakFilter returns polyphase interpolation filter for true peak
+// oversampling, Blackman windowed sinc with cutoff at input Nyquist
+func truePeakFilter() [][]float64 {
+	taps := truePeakOversample * truePeakTapsPhase
+	mid := float64(taps-1) / 2
+
+	phases := make([][]float64, truePeakOversample)
+	for p := range phases {
+		phases[p] = make([]float64, truePeakTapsPhase)
+	}
+	for n := range taps {
+		x := (float64(n) - mid) / truePeakOversample
+		h := 1.0
+		if x != 0 {
+			h = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(n)/float64(taps-1)) +
+			0.08*math.Cos(4*math.Pi*float64(n)/float64(taps-1))
+		phases[n%truePeakOversample][n/truePeakOversample] = h * w
+	}
+
+	// unity gain for each phase
+	for _, phase := range phases {
+		var sum float64
+		for _, h := range phase {
+			sum += h
+		}
+		for i := range phase {
+			phase[i] /= sum
+		}
+	}
+
+	return phases
+}
+
+// LoudnessMeter measures loudness of 16 bit audio packets by ITU-R BS.1770
+// and EBU R128: momentary (400ms), short-term (3s), gated integrated
+// loudness, loudness range and 4x oversampled true peak
+type LoudnessMeter struct {
+	mx sync.Mutex
+
+	audioFormat types.FrameFormat
+	shelf       []dsp.Biquad
+	highpass    []dsp.Biquad
+	weights     []float64
+	tpFilter    [][]float64
+	// last input samples per channel for true peak interpolation
+	tpHistory [][]float64
+
+	// 100ms sub-blocks
+	subBlockLen   int
+	subBlockCount int
+	subBlockSum   []float64
+	// weighted mean square of each completed sub-block
+	subBlocks []float64
+
+	// mean square of 400ms blocks with 75% overlap
+	momentaryBlocks []float64
+	// loudness of 3s windows, every 100ms
+	shortTermValues []float64
+
+	maxMomentary float64
+	maxShortTerm float64
+	samplePeak   float64
+	truePeak     float64
+	samples      int
+}
+
+func NewLoudnessMeter() *LoudnessMeter {
+	return &LoudnessMeter{
+		maxMomentary: MinLoudness,
+		maxShortTerm: MinLoudness,
+	}
+}
+
+func (m *LoudnessMeter) reset(audioFormat types.FrameFormat) {
+	channels := audioFormat.Channels
+
+	m.audioFormat = audioFormat
+	m.shelf = make([]dsp.Biquad, channels)
+	m.highpass = make([]dsp.Biquad, channels)
+	m.weights = make([]float64, channels)
+	m.tpFilter = truePeakFilter()
+	m.tpHistory = make([][]float64, channels)
+	for ch := range channels {
+		m.shelf[ch], m.highpass[ch] = kWeighting(audioFormat.SampleRate)
+		m.weights[ch] = channelWeight(ch, channels)
+		m.tpHistory[ch] = make([]float64, truePeakTapsPhase)
+	}
+
+	m.subBlockLen = audioFormat.SampleRate / 10
+	m.subBlockCount = 0
+	m.subBlockSum = make([]float64, channels)
+	m.subBlocks = m.subBlocks[:0]
+	m.momentaryBlocks = m.momentaryBlocks[:0]
+	m.shortTermValues = m.shortTermValues[:0]
+
+	m.maxMomentary = MinLoudness
+	m.maxShortTerm = MinLoudness
+	m.samplePeak = 0
+	m.truePeak = 0
+	m.samples = 0
+}
+
+// Add measures audio packet, packets of all measured audio must have the same
+// format
+func (m *LoudnessMeter) Add(pkt audiosource.AudioSamplesPacket) error {
+	if pkt.Format.BitsPerSample != 16 {
+		return fmt.Errorf("bits per sample %d not supported", pkt.Format.BitsPerSample)
+	}
+	if pkt.Format.Channels < 1 || pkt.Format.SampleRate < 10 {
+		return fmt.Errorf("invalid audio format: %s", pkt.Format.String())
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if m.subBlockLen == 0 {
+		m.reset(pkt.Format)
+	} else if pkt.Format != m.audioFormat {
+		return fmt.Errorf("audio format changed: %s -> %s", m.audioFormat.String(), pkt.Format.String())
+	}
+
+	channels := pkt.Format.Channels
+	nSamples := min(pkt.SamplesCount, len(pkt.Audio)/(2*channels))
+
+	idx := 0
+	for range nSamples {
+		for ch := range channels {
+			s := int16(uint16(pkt.Audio[idx]) | uint16(pkt.Audio[idx+1])<<8)
+			idx += 2
+			x := float64(s) / 32768
+
+			m.peak(ch, x)
+
+			y := m.highpass[ch].Process(m.shelf[ch].Process(x))
+			m.subBlockSum[ch] += y * y
+		}
+
+		m.samples++
+		m.subBlockCount++
+		if m.subBlockCount == m.subBlockLen {
+			m.endSubBlock()
+		}
+	}
+
+	return nil
+}
+
+// peak updates sample and true peak with the channel sample
+func (m *LoudnessMeter) peak(ch int, x float64) {
+	m.samplePeak = max(m.samplePeak, math.Abs(x))
+
+	history := m.tpHistory[ch]
+	copy(history[1:], history[:len(history)-1])
+	history[0] = x
+
+	for _, phase := range m.tpFilter {
+		var y float64
+		for i, h := range phase {
+			y += h * history[i]
+		}
+		m.truePeak = max(m.truePeak, math.Abs(y))
+	}
+}
+
+func (m *LoudnessMeter) endSubBlock() {
+	var sum float64
+	for ch, s := range m.subBlockSum {
+		sum += m.weights[ch] * s / float64(m.subBlockLen)
+		m.subBlockSum[ch] = 0
+	}
+	m.subBlockCount = 0
+	m.subBlocks = append(m.subBlocks, sum)
+
+	if n := len(m.subBlocks); n >= 4 {
+		power := meanOf(m.subBlocks[n-4:])
+		m.momentaryBlocks = append(m.momentaryBlocks, power)
+		m.maxMomentary = max(m.maxMomentary, powerToLoudness(power))
+	}
+	if n := len(m.subBlocks); n >= 30 {
+		loudness := powerToLoudness(meanOf(m.subBlocks[n-30:]))
+		m.shortTermValues = append(m.shortTermValues, loudness)
+		m.maxShortTerm = max(m.maxShortTerm, loudness)
+	}
+}
+
+func meanOf(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
+
+func powerToLoudness(power float64) float64 {
+	if power <= 0 {
+		return MinLoudness
+	}
+	return max(MinLoudness, -0.691+10*math.Log10(power))
+}
+
+// Process measures packets from the input channel and passes them through,
+// packets not measured are reported once. Output channel is closed when input
+// is closed or context is done.
+func (m *LoudnessMeter) Process(ctx context.Context, in <-chan audiosource.AudioSamplesPacket) <-chan audiosource.AudioSamplesPacket {
+	out := make(chan audiosource.AudioSamplesPacket, 1)
+
+	go func() {
+		defer close(out)
+
+		reported := false
+		for {
+			select {
+			case pkt, ok := <-in:
+				if !ok {
+					return
+				}
+
+				if err := m.Add(pkt); err != nil && !reported {
+					// packets pass unmeasured, error is reported once
+					fmt.Printf("ERR: %v\n", err)
+					reported = true
+				}
+
+				select {
+				case out <- pkt:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// Momentary returns loudness of the last 400ms, LUFS
+func (m *LoudnessMeter) Momentary() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if len(m.momentaryBlocks) == 0 {
+		return MinLoudness
+	}
+	return powerToLoudness(m.momentaryBlocks[len(m.momentaryBlocks)-1])
+}
+
+// ShortTerm returns loudness of the last 3s, LUFS
+func (m *LoudnessMeter) ShortTerm() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if len(m.shortTermValues) == 0 {
+		return MinLoudness
+	}
+	return m.shortTermValues[len(m.shortTermValues)-1]
+}
+
+// MaxMomentary returns maximal momentary loudness, LUFS
+func (m *LoudnessMeter) MaxMomentary() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	return m.maxMomentary
+}
+
+// MaxShortTerm returns maximal short-term loudness, LUFS
+func (m *LoudnessMeter) MaxShortTerm() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	return m.maxShortTerm
+}
+
+// Integrated returns gated integrated loudness of all measured audio, LUFS:
+// 400ms blocks below -70 LUFS and then blocks 10 LU below loudness of the
+// remaining blocks are excluded
+func (m *LoudnessMeter) Integrated() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	gated := make([]float64, 0, len(m.momentaryBlocks))
+	for _, p := range m.momentaryBlocks {
+		if powerToLoudness(p) > absoluteGate {
+			gated = append(gated, p)
+		}
+	}
+	if len(gated) == 0 {
+		return MinLoudness
+	}
+
+	relGate := powerToLoudness(meanOf(gated)) + integratedRelGate
+
+	var sum float64
+	var count int
+	for _, p := range gated {
+		if powerToLoudness(p) > relGate {
+			sum += p
+			count++
+		}
+	}
+	if count == 0 {
+		return MinLoudness
+	}
+
+	return powerToLoudness(sum / float64(count))
+}
+
+// LoudnessRange returns loudness range (EBU Tech 3342), LU: difference of
+// 95th and 10th percentiles of short-term loudness gated at -70 LUFS and 20 LU
+// below the mean
+func (m *LoudnessMeter) LoudnessRange() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	gated := make([]float64, 0, len(m.shortTermValues))
+	var power float64
+	for _, l := range m.shortTermValues {
+		if l > absoluteGate {
+			gated = append(gated, l)
+			power += math.Pow(10, (l+0.691)/10)
+		}
+	}
+	if len(gated) == 0 {
+		return 0
+	}
+
+	relGate := powerToLoudness(power/float64(len(gated))) + loudnessRangeGate
+
+	values := make([]float64, 0, len(gated))
+	for _, l := range gated {
+		if l > relGate {
+			values = append(values, l)
+		}
+	}
+	if len(values) == 0 {
+		return 0
+	}
+	slices.Sort(values)
+
+	percentile := func(p float64) float64 {
+		return values[int(math.Round(p*float64(len(values)-1)))]
+	}
+
+	return percentile(0.95) - percentile(0.10)
+}
+
+// TruePeak returns maximal 4x oversampled peak over all channels, dBTP
+func (m *LoudnessMeter) TruePeak() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	return LinearToDb(max(m.truePeak, m.samplePeak))
+}
+
+// SamplePeak returns maximal sample peak over all channels, dBFS
+func (m *LoudnessMeter) SamplePeak() float64 {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	return LinearToDb(m.samplePeak)
+}
+
+// Duration returns duration of measured audio
+func (m *LoudnessMeter) Duration() time.Duration {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if m.audioFormat.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(m.samples) * time.Second / time.Duration(m.audioFormat.SampleRate)
+}
+
+func (m *LoudnessMeter) Status() map[string]string {
+	attrs := make(map[string]string)
+	attrs["momentary"] = fmt.Sprintf("%.1f", m.Momentary())
+	attrs["short_term"] = fmt.Sprintf("%.1f", m.ShortTerm())
+	attrs["integrated"] = fmt.Sprintf("%.1f", m.Integrated())
+	attrs["lra"] = fmt.Sprintf("%.1f", m.LoudnessRange())
+	attrs["true_peak"] = fmt.Sprintf("%.1f", m.TruePeak())
+
+	return attrs
+}
@@ -0,0 +1,61 @@
+package audioproc
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+func sinePacket(sampleRate int, freq float64, phase float64, amplDb float64, dur float64) audiosource.AudioSamplesPacket {
+	nSamples := int(dur * float64(sampleRate))
+	ampl := DbToLinear(amplDb)
+
+	audio := make([]byte, 0, 4*nSamples)
+	for i := range nSamples {
+		v := ampl * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)+phase)
+		s := int16(math.Round(v * 32767))
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(s))
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(s))
+	}
+	return audiosource.AudioSamplesPacket{
+		Format: types.FrameFormat{
+			SampleRate:    sampleRate,
+			Channels:      2,
+			BitsPerSample: 16,
+		},
+		Audio:        audio,
+		SamplesCount: nSamples,
+	}
+}
+
+func Test_LoudnessMeter(t *testing.T) {
+	// EBU Tech 3341 case 1: stereo 1 kHz sine at -23 dBFS
+	m := NewLoudnessMeter()
+	assert.NoError(t, m.Add(sinePacket(48000, 1000, 0, -23, 20)))
+	assert.InDelta(t, -23, m.Integrated(), 0.1)
+	assert.InDelta(t, -23, m.Momentary(), 0.1)
+	assert.InDelta(t, -23, m.ShortTerm(), 0.1)
+	assert.InDelta(t, 0, m.LoudnessRange(), 0.1)
+	assert.InDelta(t, -23, m.TruePeak(), 0.1)
+
+	// EBU Tech 3342 case 1: 20s at -20 dBFS followed by 20s at -30 dBFS
+	m = NewLoudnessMeter()
+	assert.NoError(t, m.Add(sinePacket(48000, 1000, 0, -20, 20)))
+	assert.NoError(t, m.Add(sinePacket(48000, 1000, 0, -30, 20)))
+	assert.InDelta(t, 10, m.LoudnessRange(), 1)
+	assert.InDelta(t, -22.4, m.Integrated(), 0.3)
+
+	// inter-sample peak: quarter of sample rate sine sampled at 45 degrees
+	m = NewLoudnessMeter()
+	assert.NoError(t, m.Add(sinePacket(48000, 12000, math.Pi/4, -6, 1)))
+	assert.InDelta(t, -9, m.SamplePeak(), 0.1)
+	assert.InDelta(t, -6, m.TruePeak(), 0.5)
+
+	pkt := sinePacket(44100, 1000, 0, -6, 0.1)
+	assert.Error(t, m.Add(pkt))
+}
@@ -0,0 +1,55 @@
+package audioproc
+
+import (
+	"bytes"
+	"slices"
+
+	soxr "github.com/zaf/resample"
+)
+
+// streamResampler converts sample rate of 16 bit interleaved audio
+type streamResampler struct {
+	resampler *soxr.Resampler
+	out       bytes.Buffer
+}
+
+func newStreamResampler(inRate int, outRate int, channels int) (*streamResampler, error) {
+	r := streamResampler{}
+
+	resampler, err := soxr.New(&r.out,
+		float64(inRate),
+		float64(outRate),
+		channels,
+		soxr.I16,
+		soxr.HighQ)
+	if err != nil {
+		return nil, err
+	}
+	r.resampler = resampler
+
+	return &r, nil
+}
+
+// Process resamples audio, returns resampled audio available so far
+func (r *streamResampler) Process(audio []byte) ([]byte, error) {
+	if len(audio) == 0 {
+		return nil, nil
+	}
+	_, err := r.resampler.Write(audio)
+	if err != nil {
+		return nil, err
+	}
+	return r.take(), nil
+}
+
+// Flush returns audio remaining in resampler, resampler can not be used after
+func (r *streamResampler) Flush() ([]byte, error) {
+	err := r.resampler.Close()
+	return r.take(), err
+}
+
+func (r *streamResampler) take() []byte {
+	out := slices.Clone(r.out.Bytes())
+	r.out.Reset()
+	return out
+}
@@ -0,0 +1,106 @@
+package audioproc
+
+import (
+	"context"
+	"time"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+	"github.com/drgolem/musiclab/types"
+)
+
+// SpectrumFrame is STFT frame of audio stream
+type SpectrumFrame struct {
+	Index int
+	// frame start time from the start of the stream
+	Time       time.Duration
+	SampleRate int
+	Spectrum   []complex128
+}
+
+// StreamSTFT computes STFT of 16 bit audio packets mixed to mono as they
+// arrive, frames are emitted as soon as their samples are available. Audio
+// format change restarts frames at the elapsed stream time. Output channel
+// is closed when input is closed or context is done.
+func StreamSTFT(ctx context.Context, in <-chan audiosource.AudioSamplesPacket, stft *dsp.STFT) <-chan SpectrumFrame {
+	out := make(chan SpectrumFrame, 16)
+
+	go func() {
+		defer close(out)
+
+		ss := stft.NewStreamingSTFT()
+
+		var audioFormat types.FrameFormat
+		// time of the first frame of the current format
+		var offset time.Duration
+		var samples int
+		var index int
+
+		for {
+			select {
+			case pkt, ok := <-in:
+				if !ok {
+					return
+				}
+				if pkt.Format.BitsPerSample != 16 || pkt.Format.Channels < 1 {
+					continue
+				}
+
+				if pkt.Format != audioFormat {
+					if audioFormat.SampleRate > 0 {
+						offset += time.Duration(samples) * time.Second / time.Duration(audioFormat.SampleRate)
+					}
+					audioFormat = pkt.Format
+					samples = 0
+					ss.Reset()
+				}
+
+				mono := monoSamples(pkt)
+				samples += len(mono)
+
+				spectra := ss.Write(mono)
+				first := ss.Frames() - len(spectra)
+				for i, spec := range spectra {
+					frameStart := (first + i) * stft.FrameShift
+					frame := SpectrumFrame{
+						Index:      index,
+						Time:       offset + time.Duration(frameStart)*time.Second/time.Duration(audioFormat.SampleRate),
+						SampleRate: audioFormat.SampleRate,
+						Spectrum:   spec,
+					}
+					index++
+
+					select {
+					case out <- frame:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// monoSamples returns 16 bit packet samples averaged over channels, scaled
+// as in audiosource.AudioSamplesFromFile
+func monoSamples(pkt audiosource.AudioSamplesPacket) []float64 {
+	channels := pkt.Format.Channels
+	nSamples := min(pkt.SamplesCount, len(pkt.Audio)/(2*channels))
+
+	mono := make([]float64, nSamples)
+	idx := 0
+	for i := range mono {
+		var sum float64
+		for range channels {
+			sum += float64(int16(uint16(pkt.Audio[idx]) | uint16(pkt.Audio[idx+1])<<8))
+			idx += 2
+		}
+		mono[i] = sum / float64(channels) / 0x7FFF
+	}
+
+	return mono
+}
@@ -0,0 +1,38 @@
+package audioproc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+)
+
+func Test_StreamSTFT(t *testing.T) {
+	in := make(chan audiosource.AudioSamplesPacket)
+	go func() {
+		defer close(in)
+		for _, n := range []int{100, 3000, 441, 5000} {
+			in <- constPacket(2, n, 1000)
+		}
+	}()
+
+	stft := dsp.New(441, 2048)
+	frames := make([]SpectrumFrame, 0)
+	for frame := range StreamSTFT(context.Background(), in, stft) {
+		frames = append(frames, frame)
+	}
+
+	// 8541 samples
+	assert.Equal(t, (8541-2048)/441+1, len(frames))
+	for i, frame := range frames {
+		assert.Equal(t, i, frame.Index)
+		assert.Equal(t, time.Duration(i)*10*time.Millisecond, frame.Time)
+		assert.Equal(t, 1025, len(frame.Spectrum))
+	}
+	// DC of Hann windowed constant signal, window sum is about half of its length
+	assert.InDelta(t, 1000.0/0x7FFF*1024, real(frames[0].Spectrum[0]), 0.05)
+}
@@ -0,0 +1,232 @@
+package audioproc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+	"github.com/drgolem/musiclab/types"
+)
+
+const (
+	MinTempo     = 0.25
+	MaxTempo     = 4.0
+	MaxSemitones = 24.0
+)
+
+// TimePitchStage changes tempo and pitch of 16 bit audio packets by phase
+// vocoder time stretch and resampling. Packets pass unchanged until tempo or
+// pitch is changed the first time, processing is flushed on audio format
+// change and at the end of input.
+type TimePitchStage struct {
+	mx        sync.Mutex
+	tempo     float64
+	semitones float64
+
+	active      bool
+	audioFormat types.FrameFormat
+	channels    []*dsp.TimePitch
+}
+
+func NewTimePitchStage() *TimePitchStage {
+	return &TimePitchStage{
+		tempo: 1.0,
+	}
+}
+
+// SetTempo sets playback speed, 0.5 - half speed, 1.0 - original tempo
+func (s *TimePitchStage) SetTempo(tempo float64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.tempo = min(max(tempo, MinTempo), MaxTempo)
+}
+
+func (s *TimePitchStage) Tempo() float64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.tempo
+}
+
+// SetSemitones sets pitch shift, 12 - octave up
+func (s *TimePitchStage) SetSemitones(semitones float64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.semitones = min(max(semitones, -MaxSemitones), MaxSemitones)
+}
+
+func (s *TimePitchStage) Semitones() float64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.semitones
+}
+
+func (s *TimePitchStage) Status() map[string]string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	attrs := make(map[string]string)
+	attrs["tempo"] = fmt.Sprintf("%.2f", s.tempo)
+	attrs["semitones"] = strconv.FormatFloat(s.semitones, 'f', -1, 64)
+
+	return attrs
+}
+
+// settings returns tempo and pitch shift
+func (s *TimePitchStage) settings() (float64, float64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.tempo, s.semitones
+}
+
+// Process changes tempo and pitch of packets from the input channel. Output
+// channel is closed when input is closed or context is done.
+func (s *TimePitchStage) Process(ctx context.Context, in <-chan audiosource.AudioSamplesPacket) <-chan audiosource.AudioSamplesPacket {
+	out := make(chan audiosource.AudioSamplesPacket, 1)
+
+	send := func(pkt audiosource.AudioSamplesPacket) bool {
+		if pkt.SamplesCount == 0 {
+			// output is delayed by the vocoder frame
+			return true
+		}
+		select {
+		case out <- pkt:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(out)
+
+		for {
+			select {
+			case pkt, ok := <-in:
+				if !ok {
+					send(s.flush())
+					return
+				}
+
+				if pkt.Format != s.audioFormat && s.channels != nil {
+					if !send(s.flush()) {
+						return
+					}
+				}
+				if !send(s.apply(pkt)) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// stretchFrameLen returns phase vocoder frame length of about 40ms
+func stretchFrameLen(sampleRate int) int {
+	if sampleRate > 48000 {
+		return 4096
+	}
+	return 2048
+}
+
+func (s *TimePitchStage) apply(pkt audiosource.AudioSamplesPacket) audiosource.AudioSamplesPacket {
+	if pkt.Format.BitsPerSample != 16 || pkt.Format.Channels < 1 {
+		// only 16 bit samples supported
+		return pkt
+	}
+
+	tempo, semitones := s.settings()
+	if !s.active {
+		if tempo == 1 && semitones == 0 {
+			return pkt
+		}
+		// processing delays the stream, it is not bypassed after that
+		s.active = true
+	}
+
+	channels := pkt.Format.Channels
+	if s.channels == nil {
+		s.audioFormat = pkt.Format
+		s.channels = make([]*dsp.TimePitch, channels)
+		for ch := range channels {
+			s.channels[ch] = dsp.NewTimePitch(stretchFrameLen(pkt.Format.SampleRate), tempo, semitones)
+		}
+	}
+
+	nSamples := min(pkt.SamplesCount, len(pkt.Audio)/(2*channels))
+	samples := make([]float64, nSamples)
+
+	outChannels := make([][]float64, channels)
+	for ch, tp := range s.channels {
+		if tp.Tempo() != tempo || tp.Semitones() != semitones {
+			tp.Set(tempo, semitones)
+		}
+
+		idx := ch * 2
+		for i := range nSamples {
+			sv := int16(uint16(pkt.Audio[idx]) | uint16(pkt.Audio[idx+1])<<8)
+			samples[i] = float64(sv)
+			idx += channels * 2
+		}
+		outChannels[ch] = tp.Write(samples)
+	}
+
+	return interleavePacket(s.audioFormat, outChannels)
+}
+
+// flush returns buffered output of the current format and drops processors
+func (s *TimePitchStage) flush() audiosource.AudioSamplesPacket {
+	outChannels := make([][]float64, len(s.channels))
+	for ch, tp := range s.channels {
+		outChannels[ch] = tp.Flush()
+	}
+	s.channels = nil
+
+	return interleavePacket(s.audioFormat, outChannels)
+}
+
+// interleavePacket returns 16 bit packet of channel samples, channels are
+// truncated to the shortest one
+func interleavePacket(format types.FrameFormat, channels [][]float64) audiosource.AudioSamplesPacket {
+	if len(channels) == 0 {
+		return audiosource.AudioSamplesPacket{Format: format}
+	}
+
+	nSamples := len(channels[0])
+	for _, samples := range channels {
+		nSamples = min(nSamples, len(samples))
+	}
+
+	audio := make([]byte, nSamples*len(channels)*2)
+
+	idx := 0
+	for i := range nSamples {
+		for _, samples := range channels {
+			v := math.Round(samples[i])
+			v = min(max(v, math.MinInt16), math.MaxInt16)
+
+			sv := int16(v)
+			audio[idx] = byte(sv)
+			audio[idx+1] = byte(sv >> 8)
+			idx += 2
+		}
+	}
+
+	return audiosource.AudioSamplesPacket{
+		Format:       format,
+		Audio:        audio,
+		SamplesCount: nSamples,
+	}
+}
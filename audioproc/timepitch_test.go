@@ -0,0 +1,47 @@
+package audioproc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+)
+
+func Test_TimePitchStage(t *testing.T) {
+	ctx := context.Background()
+
+	// original tempo and pitch pass packets unchanged
+	in := make(chan audiosource.AudioSamplesPacket, 1)
+	in <- constPacket(2, 1000, 1234)
+	close(in)
+
+	stage := NewTimePitchStage()
+	for pkt := range stage.Process(ctx, in) {
+		assert.Equal(t, 1000, pkt.SamplesCount)
+		for _, s := range samplesOf(pkt) {
+			assert.Equal(t, int16(1234), s)
+		}
+	}
+
+	// half tempo doubles duration
+	in = make(chan audiosource.AudioSamplesPacket, 10)
+	for range 10 {
+		in <- constPacket(2, 4410, 1000)
+	}
+	close(in)
+
+	stage = NewTimePitchStage()
+	stage.SetTempo(0.5)
+	stage.SetSemitones(-3)
+	assert.Equal(t, map[string]string{"tempo": "0.50", "semitones": "-3"}, stage.Status())
+
+	outSamples := 0
+	for pkt := range stage.Process(ctx, in) {
+		assert.Equal(t, 2, pkt.Format.Channels)
+		assert.Equal(t, 4*pkt.SamplesCount, len(pkt.Audio))
+		outSamples += pkt.SamplesCount
+	}
+	assert.InDelta(t, 2*44100, outSamples, 2048)
+}
@@ -0,0 +1,67 @@
+package audiosink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/drgolem/go-portaudio/portaudio"
+)
+
+// DefaultOutputDevice returns default output device of the first host API
+// having one
+func DefaultOutputDevice() (int, error) {
+	hostApiCnt, err := portaudio.GetHostApiCount()
+	if err != nil {
+		return 0, err
+	}
+
+	for idx := 0; idx < hostApiCnt; idx++ {
+		hi, err := portaudio.GetHostApiInfo(idx)
+		if err != nil {
+			return 0, err
+		}
+		if hi.DefaultOutputDevice >= 0 {
+			return hi.DefaultOutputDevice, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no default output device")
+}
+
+// FindOutputDevice returns output device index by device index or by case
+// insensitive name substring. Empty device selects default output device.
+func FindOutputDevice(device string) (int, error) {
+	if device == "" {
+		return DefaultOutputDevice()
+	}
+
+	if deviceIdx, err := strconv.Atoi(device); err == nil {
+		di, err := portaudio.GetDeviceInfo(deviceIdx)
+		if err != nil {
+			return 0, fmt.Errorf("device %d: %w", deviceIdx, err)
+		}
+		if di.MaxOutputChannels == 0 {
+			return 0, fmt.Errorf("device %d [%s] has no output channels", deviceIdx, di.Name)
+		}
+		return deviceIdx, nil
+	}
+
+	devCnt, err := portaudio.GetDeviceCount()
+	if err != nil {
+		return 0, err
+	}
+
+	name := strings.ToLower(device)
+	for devIdx := 0; devIdx < devCnt; devIdx++ {
+		di, err := portaudio.GetDeviceInfo(devIdx)
+		if err != nil {
+			return 0, err
+		}
+		if di.MaxOutputChannels > 0 && strings.Contains(strings.ToLower(di.Name), name) {
+			return devIdx, nil
+		}
+	}
+
+	return 0, fmt.Errorf("output device [%s] not found", device)
+}
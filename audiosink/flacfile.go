@@ -0,0 +1,322 @@
+package audiosink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+const (
+	flacBlockSize     = 4096
+	flacMaxFixedOrder = 4
+	// rice1 parameter is 4 bits, 0xF is reserved for escape code
+	flacMaxRiceParam = 14
+	flacVendor       = "musiclab"
+)
+
+type flacFileSink struct {
+	file         *os.File
+	encoder      *flac.Encoder
+	audioFormat  types.FrameFormat
+	songInfo     *types.SongInfo
+	samples      [][]int32
+	audioPctChan <-chan audiosource.AudioSamplesPacket
+	mx           sync.Mutex
+}
+
+// NewFlacFileSink creates (or truncates) output flac file. Samples are encoded
+// in fixed size blocks as they arrive on the channel, song info (if not nil)
+// is written as vorbis comments. STREAMINFO with MD5 is updated on Close.
+func NewFlacFileSink(fileName string,
+	audioPctChan <-chan audiosource.AudioSamplesPacket,
+	songInfo *types.SongInfo,
+) (AudioSink, error) {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := flacFileSink{
+		file: f,
+		audioFormat: types.FrameFormat{
+			SampleRate:    44100,
+			Channels:      2,
+			BitsPerSample: 16,
+		},
+		songInfo:     songInfo,
+		audioPctChan: audioPctChan,
+	}
+
+	return &fs, nil
+}
+
+func (fs *flacFileSink) Play(ctx context.Context) error {
+	for {
+		select {
+		case pkt, ok := <-fs.audioPctChan:
+			if !ok {
+				// channel closed, no data
+				return nil
+			}
+
+			err := fs.write(pkt)
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (fs *flacFileSink) write(pkt audiosource.AudioSamplesPacket) error {
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+
+	if fs.file == nil {
+		return fmt.Errorf("flac sink closed")
+	}
+
+	if fs.encoder == nil {
+		fs.audioFormat = pkt.Format
+		err := fs.createEncoder()
+		if err != nil {
+			return err
+		}
+	} else if fs.audioFormat != pkt.Format {
+		return fmt.Errorf("flac sink: format change %s -> %s not supported",
+			fs.audioFormat.String(), pkt.Format.String())
+	}
+
+	channels := fs.audioFormat.Channels
+	bytesPerSample := fs.audioFormat.BitsPerSample / 8
+	shift := 32 - fs.audioFormat.BitsPerSample
+
+	// little endian interleaved PCM to per channel samples
+	idx := 0
+	for range pkt.SamplesCount {
+		for ch := range channels {
+			var v uint32
+			for b := range bytesPerSample {
+				v |= uint32(pkt.Audio[idx+b]) << (8 * b)
+			}
+			idx += bytesPerSample
+			fs.samples[ch] = append(fs.samples[ch], int32(v<<shift)>>shift)
+		}
+	}
+
+	for len(fs.samples[0]) >= flacBlockSize {
+		err := fs.writeFrame(flacBlockSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (fs *flacFileSink) createEncoder() error {
+	bps := fs.audioFormat.BitsPerSample
+	if bps != 16 && bps != 24 {
+		return fmt.Errorf("flac sink: bits per sample %d not supported", bps)
+	}
+	if fs.audioFormat.Channels < 1 || fs.audioFormat.Channels > 8 {
+		return fmt.Errorf("flac sink: channels %d not supported", fs.audioFormat.Channels)
+	}
+
+	info := &meta.StreamInfo{
+		BlockSizeMin:  flacBlockSize,
+		BlockSizeMax:  flacBlockSize,
+		SampleRate:    uint32(fs.audioFormat.SampleRate),
+		NChannels:     uint8(fs.audioFormat.Channels),
+		BitsPerSample: uint8(bps),
+	}
+
+	enc, err := flac.NewEncoder(fs.file, info, fs.vorbisCommentBlock())
+	if err != nil {
+		return err
+	}
+
+	fs.encoder = enc
+	fs.samples = make([][]int32, fs.audioFormat.Channels)
+
+	return nil
+}
+
+func (fs *flacFileSink) vorbisCommentBlock() *meta.Block {
+	comment := &meta.VorbisComment{
+		Vendor: flacVendor,
+	}
+	if fs.songInfo != nil {
+		for _, tag := range [][2]string{
+			{"TITLE", fs.songInfo.Title},
+			{"ARTIST", fs.songInfo.Artist},
+			{"ALBUM", fs.songInfo.Album},
+		} {
+			if tag[1] != "" {
+				comment.Tags = append(comment.Tags, tag)
+			}
+		}
+	}
+
+	length := 4 + len(comment.Vendor) + 4
+	for _, tag := range comment.Tags {
+		length += 4 + len(tag[0]) + 1 + len(tag[1])
+	}
+
+	return &meta.Block{
+		Header: meta.Header{
+			Type:   meta.TypeVorbisComment,
+			Length: int64(length),
+		},
+		Body: comment,
+	}
+}
+
+func (fs *flacFileSink) writeFrame(nSamples int) error {
+	channels := fs.audioFormat.Channels
+
+	f := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(nSamples),
+			SampleRate:        uint32(fs.audioFormat.SampleRate),
+			Channels:          frame.Channels(channels - 1),
+			BitsPerSample:     uint8(fs.audioFormat.BitsPerSample),
+		},
+		Subframes: make([]*frame.Subframe, channels),
+	}
+
+	for ch := range channels {
+		samples := make([]int32, nSamples)
+		copy(samples, fs.samples[ch])
+		f.Subframes[ch] = flacSubframe(samples, fs.audioFormat.BitsPerSample)
+
+		// keep the tail for the next block
+		n := copy(fs.samples[ch], fs.samples[ch][nSamples:])
+		fs.samples[ch] = fs.samples[ch][:n]
+	}
+
+	return fs.encoder.WriteFrame(f)
+}
+
+// flacSubframe picks constant, fixed or verbatim prediction whichever gives
+// the smallest subframe
+func flacSubframe(samples []int32, bps int) *frame.Subframe {
+	nSamples := len(samples)
+
+	subframe := &frame.Subframe{
+		SubHeader: frame.SubHeader{
+			Pred: frame.PredVerbatim,
+		},
+		Samples:  samples,
+		NSamples: nSamples,
+	}
+
+	constant := true
+	for _, s := range samples {
+		if s != samples[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		subframe.Pred = frame.PredConstant
+		return subframe
+	}
+
+	if nSamples <= flacMaxFixedOrder {
+		return subframe
+	}
+
+	// fixed predictor of order k is the k-th difference of the signal
+	residuals := make([]int64, nSamples)
+	for i, s := range samples {
+		residuals[i] = int64(s)
+	}
+
+	bestBits := int64(nSamples * bps)
+	for order := 0; order <= flacMaxFixedOrder; order++ {
+		if order > 0 {
+			for i := nSamples - 1; i >= order; i-- {
+				residuals[i] -= residuals[i-1]
+			}
+		}
+
+		param, bits := riceParam(residuals[order:])
+		// warm-up samples, 4 bits partition order, 4 bits rice parameter
+		bits += int64(order*bps) + 8
+		if bits < bestBits {
+			bestBits = bits
+			subframe.Pred = frame.PredFixed
+			subframe.Order = order
+			subframe.ResidualCodingMethod = frame.ResidualCodingMethodRice1
+			subframe.RiceSubframe = &frame.RiceSubframe{
+				PartOrder:  0,
+				Partitions: []frame.RicePartition{{Param: param}},
+			}
+		}
+	}
+
+	return subframe
+}
+
+// riceParam returns rice parameter with the smallest encoded size of the residuals
+func riceParam(residuals []int64) (uint, int64) {
+	var bestParam uint
+	bestBits := int64(math.MaxInt64)
+	for k := uint(0); k <= flacMaxRiceParam; k++ {
+		bits := int64(len(residuals)) * int64(k+1)
+		for _, r := range residuals {
+			// zigzag encoding
+			folded := uint64(r<<1) ^ uint64(r>>63)
+			bits += int64(folded >> k)
+		}
+		if bits < bestBits {
+			bestBits = bits
+			bestParam = k
+		}
+	}
+	return bestParam, bestBits
+}
+
+func (fs *flacFileSink) Close(ctx context.Context) error {
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+
+	if fs.file == nil {
+		return nil
+	}
+
+	var err error
+	if fs.encoder == nil {
+		// no data received, still write valid stream header
+		err = fs.createEncoder()
+	}
+	if err == nil && len(fs.samples[0]) > 0 {
+		err = fs.writeFrame(len(fs.samples[0]))
+	}
+	if err == nil {
+		// updates STREAMINFO: number of samples, block sizes and MD5
+		err = fs.encoder.Close()
+	}
+
+	// encoder may have closed the file already
+	closeErr := fs.file.Close()
+	if closeErr != nil && !errors.Is(closeErr, os.ErrClosed) && err == nil {
+		err = closeErr
+	}
+	fs.file = nil
+
+	return err
+}
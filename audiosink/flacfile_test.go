@@ -0,0 +1,108 @@
+package audiosink
+
+import (
+	"context"
+	"crypto/md5"
+	"io"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+func Test_FlacFileSinkRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	rnd := rand.New(rand.NewSource(1))
+
+	songInfo := &types.SongInfo{
+		Title:  "Doremi",
+		Artist: "Musiclab",
+	}
+
+	for _, bps := range []int{16, 24} {
+		format := types.FrameFormat{
+			SampleRate:    44100,
+			Channels:      2,
+			BitsPerSample: bps,
+		}
+		bytesPerSample := bps / 8
+		amplitude := float64(int64(1)<<(bps-1)) * 0.5
+
+		// two full blocks and a partial final block, silent right channel
+		// in the middle block uses constant subframes
+		const nSamples = 2*flacBlockSize + 1808
+		expected := make([][]int32, format.Channels)
+		audio := make([]byte, 0, nSamples*format.Channels*bytesPerSample)
+		for i := range nSamples {
+			for ch := range format.Channels {
+				v := int32(amplitude*math.Sin(2*math.Pi*440*float64(i)/44100) + 100*rnd.NormFloat64())
+				if ch == 1 && i >= flacBlockSize && i < 2*flacBlockSize {
+					v = 0
+				}
+				expected[ch] = append(expected[ch], v)
+				for b := range bytesPerSample {
+					audio = append(audio, byte(uint32(v)>>(8*b)))
+				}
+			}
+		}
+
+		fileName := filepath.Join(t.TempDir(), "out.flac")
+		audioPktChan := make(chan audiosource.AudioSamplesPacket, 16)
+		frameBytes := format.Channels * bytesPerSample
+		for from := 0; from < nSamples; from += 1000 {
+			to := min(from+1000, nSamples)
+			audioPktChan <- audiosource.AudioSamplesPacket{
+				Format:       format,
+				Audio:        audio[from*frameBytes : to*frameBytes],
+				SamplesCount: to - from,
+			}
+		}
+		close(audioPktChan)
+
+		sink, err := NewFlacFileSink(fileName, audioPktChan, songInfo)
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Play(ctx))
+		assert.NoError(t, sink.Close(ctx))
+
+		stream, err := flac.ParseFile(fileName)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, uint64(nSamples), stream.Info.NSamples)
+		assert.Equal(t, uint8(bps), stream.Info.BitsPerSample)
+		assert.Equal(t, [md5.Size]uint8(md5.Sum(audio)), stream.Info.MD5sum)
+
+		var tags [][2]string
+		for _, block := range stream.Blocks {
+			if comment, ok := block.Body.(*meta.VorbisComment); ok {
+				tags = comment.Tags
+			}
+		}
+		assert.Equal(t, [][2]string{{"TITLE", "Doremi"}, {"ARTIST", "Musiclab"}}, tags)
+
+		decoded := make([][]int32, format.Channels)
+		for {
+			f, err := stream.ParseNext()
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err) {
+				break
+			}
+			for ch, subframe := range f.Subframes {
+				decoded[ch] = append(decoded[ch], subframe.Samples...)
+			}
+		}
+		stream.Close()
+
+		assert.Equal(t, expected, decoded, "bps %d", bps)
+	}
+}
@@ -0,0 +1,73 @@
+package audiosink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+type pipeSink struct {
+	w             io.Writer
+	wavHeader     bool
+	audioFormat   types.FrameFormat
+	headerWritten bool
+	audioPctChan  <-chan audiosource.AudioSamplesPacket
+}
+
+// NewPipeSink writes raw PCM to the writer (stdout pipe), optionally preceded
+// by wav header with unknown (maximum) data size. Writer is not closed by the
+// sink.
+func NewPipeSink(w io.Writer,
+	wavHeader bool,
+	audioPctChan <-chan audiosource.AudioSamplesPacket,
+) (AudioSink, error) {
+	ps := pipeSink{
+		w:            w,
+		wavHeader:    wavHeader,
+		audioPctChan: audioPctChan,
+	}
+
+	return &ps, nil
+}
+
+func (ps *pipeSink) Play(ctx context.Context) error {
+	for {
+		select {
+		case pkt, ok := <-ps.audioPctChan:
+			if !ok {
+				return nil
+			}
+
+			if !ps.headerWritten {
+				ps.audioFormat = pkt.Format
+				ps.headerWritten = true
+				if ps.wavHeader {
+					_, err := ps.w.Write(WavHeader(pkt.Format, math.MaxUint32))
+					if err != nil {
+						return err
+					}
+				}
+			} else if ps.audioFormat != pkt.Format {
+				// pipe consumer can not learn about the new format
+				return fmt.Errorf("stream format changed: %s -> %s",
+					ps.audioFormat.String(), pkt.Format.String())
+			}
+
+			frameByteSize := pkt.Format.Channels * pkt.Format.BitsPerSample / 8
+			_, err := ps.w.Write(pkt.Audio[:pkt.SamplesCount*frameByteSize])
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ps *pipeSink) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package audiosink
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+func Test_PipeSinkWavRoundTrip(t *testing.T) {
+	audioFormat := types.FrameFormat{SampleRate: 22050, Channels: 2, BitsPerSample: 16}
+
+	audio := make([]byte, 4*1000)
+	for i := range audio {
+		audio[i] = byte(i)
+	}
+
+	for _, wavHeader := range []bool{true, false} {
+		in := make(chan audiosource.AudioSamplesPacket, 2)
+		in <- audiosource.AudioSamplesPacket{Format: audioFormat, Audio: audio[:4*600], SamplesCount: 600}
+		in <- audiosource.AudioSamplesPacket{Format: audioFormat, Audio: audio[4*600:], SamplesCount: 400}
+		close(in)
+
+		var buf bytes.Buffer
+		sink, err := NewPipeSink(&buf, wavHeader, in)
+		assert.NoError(t, err)
+		assert.NoError(t, sink.Play(context.Background()))
+
+		// raw input needs format, wav header is sniffed
+		stream, err := audiosource.NewReaderAudioProducer(context.Background(), bytes.NewReader(buf.Bytes()),
+			audiosource.WithFramesPerBuffer(256),
+			audiosource.WithInputFormat(audioFormat))
+		assert.NoError(t, err)
+		assert.Equal(t, audioFormat, stream.GetFormat())
+
+		var out []byte
+		for pkt := range stream.Stream() {
+			out = append(out, pkt.Audio...)
+		}
+		assert.Equal(t, audio, out)
+	}
+
+	_, err := audiosource.NewReaderAudioProducer(context.Background(), bytes.NewReader(audio))
+	assert.Error(t, err)
+}
@@ -23,17 +23,47 @@ type portAudioSink struct {
 	audioPctChan    <-chan audiosource.AudioSamplesPacket
 }
 
-func NewPortAudioSink(deviceIdx int,
+// NewPortAudioSink opens output device selected by index or name substring,
+// default output device is used if device is empty or not found
+func NewPortAudioSink(device string,
 	framesPerBuffer int,
 	audioPctChan <-chan audiosource.AudioSamplesPacket,
 ) (AudioSink, error) {
 
+	deviceIdx, err := FindOutputDevice(device)
+	if err != nil && device != "" {
+		fmt.Printf("PortAudio: %v, using default output device\n", err)
+		deviceIdx, err = DefaultOutputDevice()
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	audioFormat := types.FrameFormat{
 		SampleRate: 44100,
 		Channels:   2,
 		//BitsPerSample: 16,
 	}
 
+	stream, err := openOutputStream(deviceIdx, audioFormat, framesPerBuffer)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := portAudioSink{
+		audioFormat:     audioFormat,
+		deviceIdx:       deviceIdx,
+		framesPerBuffer: framesPerBuffer,
+		stream:          stream,
+		audioPctChan:    audioPctChan,
+	}
+
+	return &ps, nil
+}
+
+// openOutputStream checks that device supports audio format and starts
+// output stream
+func openOutputStream(deviceIdx int, audioFormat types.FrameFormat, framesPerBuffer int) (*portaudio.PaStream, error) {
 	sampleformat := portaudio.SampleFmtInt16
 
 	outStreamParams := portaudio.PaStreamParameters{
@@ -41,6 +71,13 @@ func NewPortAudioSink(deviceIdx int,
 		ChannelCount: audioFormat.Channels,
 		SampleFormat: sampleformat,
 	}
+
+	err := portaudio.IsFormatSupported(nil, &outStreamParams, float32(audioFormat.SampleRate))
+	if err != nil {
+		return nil, fmt.Errorf("device %d, sample rate %d, channels %d: %w",
+			deviceIdx, audioFormat.SampleRate, audioFormat.Channels, err)
+	}
+
 	stream, err := portaudio.NewStream(outStreamParams, float32(audioFormat.SampleRate))
 	if err != nil {
 		return nil, err
@@ -53,18 +90,11 @@ func NewPortAudioSink(deviceIdx int,
 
 	err = stream.StartStream()
 	if err != nil {
+		stream.Close()
 		return nil, err
 	}
 
-	ps := portAudioSink{
-		audioFormat:     audioFormat,
-		deviceIdx:       deviceIdx,
-		framesPerBuffer: framesPerBuffer,
-		stream:          stream,
-		audioPctChan:    audioPctChan,
-	}
-
-	return &ps, nil
+	return stream, nil
 }
 
 func (ps *portAudioSink) Play(ctx context.Context) error {
@@ -80,31 +110,15 @@ func (ps *portAudioSink) Play(ctx context.Context) error {
 			if ps.audioFormat != pkt.Format {
 				ps.audioFormat = pkt.Format
 
-				sampleformat := portaudio.SampleFmtInt16
-
-				outStreamParams := portaudio.PaStreamParameters{
-					DeviceIndex:  ps.deviceIdx,
-					ChannelCount: ps.audioFormat.Channels,
-					SampleFormat: sampleformat,
-				}
-				var err error
-				ps.stream, err = portaudio.NewStream(outStreamParams, float32(ps.audioFormat.SampleRate))
-				if err != nil {
-					fmt.Printf("PulseAudio: ERR: %v\n", err)
-					return nil
-				}
-
-				err = ps.stream.Open(ps.framesPerBuffer)
-				if err != nil {
-					fmt.Printf("PulseAudio: ERR: %v\n", err)
-					return nil
-				}
+				ps.stream.StopStream()
+				ps.stream.Close()
 
-				err = ps.stream.StartStream()
+				stream, err := openOutputStream(ps.deviceIdx, ps.audioFormat, ps.framesPerBuffer)
 				if err != nil {
 					fmt.Printf("PulseAudio: ERR: %v\n", err)
 					return nil
 				}
+				ps.stream = stream
 			}
 
 			err := ps.stream.Write(pkt.SamplesCount, pkt.Audio)
@@ -0,0 +1,386 @@
+package audiosink
+
+/*
+#cgo pkg-config: portaudio-2.0
+#include <stdint.h>
+#include <portaudio.h>
+
+extern int paCallbackSinkFill(void *output, unsigned long frameCount,
+	PaStreamCallbackFlags statusFlags, uintptr_t userData);
+
+static int paCallbackSinkStreamCallback(const void *input, void *output,
+	unsigned long frameCount, const PaStreamCallbackTimeInfo *timeInfo,
+	PaStreamCallbackFlags statusFlags, void *userData)
+{
+	return paCallbackSinkFill(output, frameCount, statusFlags, (uintptr_t)userData);
+}
+
+static PaError paCallbackSinkOpenStream(PaStream **stream, int device, int channels,
+	double sampleRate, double latency, unsigned long framesPerBuffer, uintptr_t userData)
+{
+	PaStreamParameters outParams;
+	outParams.device = device;
+	outParams.channelCount = channels;
+	outParams.sampleFormat = paInt16;
+	outParams.suggestedLatency = latency;
+	outParams.hostApiSpecificStreamInfo = NULL;
+
+	return Pa_OpenStream(stream, NULL, &outParams, sampleRate, framesPerBuffer,
+		paNoFlag, paCallbackSinkStreamCallback, (void *)userData);
+}
+
+static double paCallbackSinkOutputLatency(PaStream *stream)
+{
+	const PaStreamInfo *info = Pa_GetStreamInfo(stream);
+	if (info == NULL) {
+		return 0;
+	}
+	return info->outputLatency;
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"runtime/cgo"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/drgolem/go-portaudio/portaudio"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+// StatusReporter is implemented by sinks reporting playback state
+type StatusReporter interface {
+	Status() map[string]string
+}
+
+type CallbackSinkOptions struct {
+	// suggested output latency, 0 - device default low latency
+	Latency time.Duration
+	// buffered audio required to start (or resume after underflow) playback
+	Prebuffer time.Duration
+	// jitter buffer size
+	BufferDuration time.Duration
+}
+
+type SetCallbackOptionsFn func(opt *CallbackSinkOptions)
+
+func WithLatency(latency time.Duration) SetCallbackOptionsFn {
+	return func(opt *CallbackSinkOptions) {
+		opt.Latency = latency
+	}
+}
+
+func WithPrebuffer(prebuffer time.Duration) SetCallbackOptionsFn {
+	return func(opt *CallbackSinkOptions) {
+		opt.Prebuffer = prebuffer
+	}
+}
+
+func WithBufferDuration(dur time.Duration) SetCallbackOptionsFn {
+	return func(opt *CallbackSinkOptions) {
+		opt.BufferDuration = dur
+	}
+}
+
+type portAudioCallbackSink struct {
+	opt             CallbackSinkOptions
+	deviceIdx       int
+	framesPerBuffer int
+	audioPctChan    <-chan audiosource.AudioSamplesPacket
+
+	// owned by Play
+	audioFormat types.FrameFormat
+	stream      unsafe.Pointer
+	handle      cgo.Handle
+	latency     time.Duration
+
+	// shared with audio callback
+	ring           atomic.Pointer[spscRingBuffer]
+	frameByteSize  atomic.Int64
+	prebufferBytes atomic.Int64
+	playing        atomic.Bool
+	draining       atomic.Bool
+	underflows     atomic.Uint64
+	// audio that did not fit the buffer before the stream was stopped
+	overflows      atomic.Uint64
+	droppedFrames  atomic.Uint64
+	playedFrames   atomic.Uint64
+	bytesPerSecond atomic.Int64
+	latencyNs      atomic.Int64
+}
+
+// NewPortAudioCallbackSink creates sink pulling audio from jitter buffer in
+// PortAudio callback. Output stream is opened for the format of the first
+// packet and reopened on format change.
+func NewPortAudioCallbackSink(device string,
+	framesPerBuffer int,
+	audioPctChan <-chan audiosource.AudioSamplesPacket,
+	opts ...SetCallbackOptionsFn,
+) (AudioSink, error) {
+	opt := CallbackSinkOptions{
+		Prebuffer:      100 * time.Millisecond,
+		BufferDuration: 500 * time.Millisecond,
+	}
+	for _, sf := range opts {
+		sf(&opt)
+	}
+	if opt.BufferDuration < opt.Prebuffer {
+		return nil, fmt.Errorf("buffer %v is smaller than prebuffer %v", opt.BufferDuration, opt.Prebuffer)
+	}
+
+	deviceIdx, err := FindOutputDevice(device)
+	if err != nil && device != "" {
+		fmt.Printf("PortAudio: %v, using default output device\n", err)
+		deviceIdx, err = DefaultOutputDevice()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cs := portAudioCallbackSink{
+		opt:             opt,
+		deviceIdx:       deviceIdx,
+		framesPerBuffer: framesPerBuffer,
+		audioPctChan:    audioPctChan,
+	}
+
+	return &cs, nil
+}
+
+func (cs *portAudioCallbackSink) Play(ctx context.Context) error {
+	for {
+		select {
+		case pkt, ok := <-cs.audioPctChan:
+			if !ok {
+				// channel closed, play out buffered audio
+				cs.drain(ctx)
+				return nil
+			}
+
+			if cs.stream == nil || cs.audioFormat != pkt.Format {
+				if cs.stream != nil {
+					cs.drain(ctx)
+					cs.closeStream()
+				}
+				err := cs.openStream(pkt.Format)
+				if err != nil {
+					return err
+				}
+			}
+
+			frameByteSize := pkt.Format.Channels * pkt.Format.BitsPerSample / 8
+			cs.write(ctx, pkt.Audio[:pkt.SamplesCount*frameByteSize])
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// write blocks until data is in the jitter buffer or context is done, full
+// buffer is a back pressure for the producer, data still not written when
+// context is done is an overflow
+func (cs *portAudioCallbackSink) write(ctx context.Context, data []byte) {
+	ring := cs.ring.Load()
+
+	// poll buffer twice per callback period
+	pollInterval := time.Duration(cs.framesPerBuffer) * time.Second /
+		time.Duration(2*cs.audioFormat.SampleRate)
+
+	for {
+		n := ring.Write(data)
+		data = data[n:]
+		if len(data) == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			cs.overflow(len(data))
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// drain waits until buffered audio is played
+func (cs *portAudioCallbackSink) drain(ctx context.Context) {
+	ring := cs.ring.Load()
+	if ring == nil {
+		return
+	}
+
+	cs.draining.Store(true)
+	defer cs.draining.Store(false)
+
+	for ring.Size() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// let the device play its own buffers
+	select {
+	case <-ctx.Done():
+	case <-time.After(cs.latency):
+	}
+}
+
+func (cs *portAudioCallbackSink) openStream(audioFormat types.FrameFormat) error {
+	if audioFormat.BitsPerSample != 16 {
+		return fmt.Errorf("PortAudio: bits per sample %d not supported", audioFormat.BitsPerSample)
+	}
+
+	outStreamParams := portaudio.PaStreamParameters{
+		DeviceIndex:  cs.deviceIdx,
+		ChannelCount: audioFormat.Channels,
+		SampleFormat: portaudio.SampleFmtInt16,
+	}
+	err := portaudio.IsFormatSupported(nil, &outStreamParams, float32(audioFormat.SampleRate))
+	if err != nil {
+		return fmt.Errorf("device %d, sample rate %d, channels %d: %w",
+			cs.deviceIdx, audioFormat.SampleRate, audioFormat.Channels, err)
+	}
+
+	latency := cs.opt.Latency
+	if latency == 0 {
+		di, err := portaudio.GetDeviceInfo(cs.deviceIdx)
+		if err != nil {
+			return err
+		}
+		latency = time.Duration(float64(di.DefaultLowOutputLatency) * float64(time.Second))
+	}
+
+	frameByteSize := audioFormat.Channels * audioFormat.BitsPerSample / 8
+	bytesPerSecond := float64(audioFormat.SampleRate * frameByteSize)
+	bufferFrames := int(cs.opt.BufferDuration.Seconds()*float64(audioFormat.SampleRate)) + cs.framesPerBuffer
+
+	cs.ring.Store(newSpscRingBuffer(bufferFrames * frameByteSize))
+	cs.frameByteSize.Store(int64(frameByteSize))
+	cs.bytesPerSecond.Store(int64(bytesPerSecond))
+	cs.prebufferBytes.Store(int64(cs.opt.Prebuffer.Seconds()*bytesPerSecond) / int64(frameByteSize) * int64(frameByteSize))
+	cs.playing.Store(false)
+
+	cs.handle = cgo.NewHandle(cs)
+
+	var stream unsafe.Pointer
+	errCode := C.paCallbackSinkOpenStream(&stream,
+		C.int(cs.deviceIdx),
+		C.int(audioFormat.Channels),
+		C.double(audioFormat.SampleRate),
+		C.double(latency.Seconds()),
+		C.ulong(cs.framesPerBuffer),
+		C.uintptr_t(cs.handle))
+	if errCode != C.paNoError {
+		cs.handle.Delete()
+		return &portaudio.PaError{ErrorCode: int(errCode)}
+	}
+
+	errCode = C.Pa_StartStream(stream)
+	if errCode != C.paNoError {
+		C.Pa_CloseStream(stream)
+		cs.handle.Delete()
+		return &portaudio.PaError{ErrorCode: int(errCode)}
+	}
+
+	cs.stream = stream
+	cs.audioFormat = audioFormat
+	cs.latency = time.Duration(float64(C.paCallbackSinkOutputLatency(stream)) * float64(time.Second))
+	cs.latencyNs.Store(int64(cs.latency))
+
+	return nil
+}
+
+// overflow counts audio bytes dropped without being played
+func (cs *portAudioCallbackSink) overflow(bytes int) {
+	if bytes <= 0 {
+		return
+	}
+	cs.overflows.Add(1)
+	cs.droppedFrames.Add(uint64(int64(bytes) / cs.frameByteSize.Load()))
+}
+
+func (cs *portAudioCallbackSink) closeStream() {
+	if cs.stream == nil {
+		return
+	}
+
+	C.Pa_StopStream(cs.stream)
+	// buffered audio is dropped when stopped before drain completes
+	cs.overflow(cs.ring.Load().Size())
+	C.Pa_CloseStream(cs.stream)
+	cs.handle.Delete()
+	cs.stream = nil
+}
+
+// fill runs on PortAudio callback thread, it must not block
+func (cs *portAudioCallbackSink) fill(out []byte, statusFlags C.PaStreamCallbackFlags) {
+	if statusFlags&C.paOutputUnderflow != 0 {
+		cs.underflows.Add(1)
+	}
+
+	ring := cs.ring.Load()
+	draining := cs.draining.Load()
+
+	if !cs.playing.Load() {
+		avail := int64(ring.Size())
+		if avail == 0 || (avail < cs.prebufferBytes.Load() && !draining) {
+			clear(out)
+			return
+		}
+		cs.playing.Store(true)
+	}
+
+	n := ring.Read(out)
+	if n < len(out) {
+		clear(out[n:])
+		if !draining {
+			// buffer ran dry, prebuffer again
+			cs.underflows.Add(1)
+			cs.playing.Store(false)
+		}
+	}
+
+	cs.playedFrames.Add(uint64(int64(n) / cs.frameByteSize.Load()))
+}
+
+func (cs *portAudioCallbackSink) Status() map[string]string {
+	attrs := make(map[string]string)
+
+	attrs["device"] = fmt.Sprintf("%d", cs.deviceIdx)
+	attrs["underflows"] = fmt.Sprintf("%d", cs.underflows.Load())
+	attrs["overflows"] = fmt.Sprintf("%d", cs.overflows.Load())
+	attrs["dropped_frames"] = fmt.Sprintf("%d", cs.droppedFrames.Load())
+	attrs["played_frames"] = fmt.Sprintf("%d", cs.playedFrames.Load())
+	attrs["prebuffer"] = cs.opt.Prebuffer.String()
+
+	ring := cs.ring.Load()
+	if ring == nil {
+		return attrs
+	}
+
+	fill := ring.Size()
+	attrs["buffer_fill"] = fmt.Sprintf("%.1f%%", 100*float64(fill)/float64(ring.Capacity()))
+
+	if bytesPerSecond := cs.bytesPerSecond.Load(); bytesPerSecond > 0 {
+		attrs["buffer_fill_ms"] = fmt.Sprintf("%d", int64(fill)*1000/bytesPerSecond)
+	}
+	attrs["latency"] = time.Duration(cs.latencyNs.Load()).String()
+
+	return attrs
+}
+
+func (cs *portAudioCallbackSink) Close(ctx context.Context) error {
+	fmt.Println("PortAudio callback - close")
+
+	cs.closeStream()
+
+	return nil
+}
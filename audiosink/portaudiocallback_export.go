@@ -0,0 +1,24 @@
+package audiosink
+
+/*
+#include <stdint.h>
+#include <portaudio.h>
+*/
+import "C"
+
+import (
+	"runtime/cgo"
+	"unsafe"
+)
+
+//export paCallbackSinkFill
+func paCallbackSinkFill(output unsafe.Pointer, frameCount C.ulong,
+	statusFlags C.PaStreamCallbackFlags, userData C.uintptr_t) C.int {
+
+	cs := cgo.Handle(userData).Value().(*portAudioCallbackSink)
+
+	out := unsafe.Slice((*byte)(output), int(frameCount)*int(cs.frameByteSize.Load()))
+	cs.fill(out, statusFlags)
+
+	return C.paContinue
+}
@@ -0,0 +1,75 @@
+package audiosink
+
+import (
+	"sync/atomic"
+)
+
+// spscRingBuffer is lock free byte ring buffer for single producer and single
+// consumer. Read and write positions grow monotonically, buffer index is
+// position modulo capacity.
+type spscRingBuffer struct {
+	buf      []byte
+	readPos  atomic.Uint64
+	writePos atomic.Uint64
+}
+
+func newSpscRingBuffer(capacity int) *spscRingBuffer {
+	return &spscRingBuffer{
+		buf: make([]byte, capacity),
+	}
+}
+
+func (rb *spscRingBuffer) Capacity() int {
+	return len(rb.buf)
+}
+
+// Size returns number of bytes available to read
+func (rb *spscRingBuffer) Size() int {
+	return int(rb.writePos.Load() - rb.readPos.Load())
+}
+
+// AvailableWriteSize returns number of bytes that can be written
+func (rb *spscRingBuffer) AvailableWriteSize() int {
+	return len(rb.buf) - rb.Size()
+}
+
+// Write copies as much of p as fits, returns number of bytes written.
+// Must be called from producer only.
+func (rb *spscRingBuffer) Write(p []byte) int {
+	writePos := rb.writePos.Load()
+	free := len(rb.buf) - int(writePos-rb.readPos.Load())
+	n := min(len(p), free)
+	if n == 0 {
+		return 0
+	}
+
+	idx := int(writePos % uint64(len(rb.buf)))
+	k := copy(rb.buf[idx:], p[:n])
+	copy(rb.buf, p[k:n])
+
+	rb.writePos.Store(writePos + uint64(n))
+	return n
+}
+
+// Read fills p with available data, returns number of bytes read.
+// Must be called from consumer only.
+func (rb *spscRingBuffer) Read(p []byte) int {
+	readPos := rb.readPos.Load()
+	avail := int(rb.writePos.Load() - readPos)
+	n := min(len(p), avail)
+	if n == 0 {
+		return 0
+	}
+
+	idx := int(readPos % uint64(len(rb.buf)))
+	k := copy(p[:n], rb.buf[idx:])
+	copy(p[k:n], rb.buf)
+
+	rb.readPos.Store(readPos + uint64(n))
+	return n
+}
+
+// Reset drops buffered data, must not run concurrently with Read or Write
+func (rb *spscRingBuffer) Reset() {
+	rb.readPos.Store(rb.writePos.Load())
+}
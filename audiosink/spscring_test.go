@@ -0,0 +1,79 @@
+package audiosink
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SpscRingBufferWrap(t *testing.T) {
+	rb := newSpscRingBuffer(8)
+
+	assert.Equal(t, 6, rb.Write([]byte{1, 2, 3, 4, 5, 6}))
+	assert.Equal(t, 2, rb.AvailableWriteSize())
+
+	out := make([]byte, 4)
+	assert.Equal(t, 4, rb.Read(out))
+	assert.Equal(t, []byte{1, 2, 3, 4}, out)
+
+	// wraps around the end of the buffer, only 6 bytes fit
+	assert.Equal(t, 6, rb.Write([]byte{7, 8, 9, 10, 11, 12, 13}))
+	assert.Equal(t, 8, rb.Size())
+	assert.Equal(t, 0, rb.Write([]byte{14}))
+
+	out = make([]byte, 10)
+	assert.Equal(t, 8, rb.Read(out))
+	assert.Equal(t, []byte{5, 6, 7, 8, 9, 10, 11, 12}, out[:8])
+	assert.Equal(t, 0, rb.Read(out))
+}
+
+func Test_SpscRingBufferConcurrent(t *testing.T) {
+	const total = 1 << 20
+
+	rb := newSpscRingBuffer(1000)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		data := make([]byte, 333)
+		pos := 0
+		for pos < total {
+			n := min(len(data), total-pos)
+			for i := range n {
+				data[i] = byte(pos + i)
+			}
+			written := 0
+			for written < n {
+				w := rb.Write(data[written:n])
+				if w == 0 {
+					runtime.Gosched()
+				}
+				written += w
+			}
+			pos += n
+		}
+	}()
+
+	buf := make([]byte, 257)
+	pos := 0
+	for pos < total {
+		n := rb.Read(buf)
+		if n == 0 {
+			runtime.Gosched()
+		}
+		for i := range n {
+			if buf[i] != byte(pos+i) {
+				assert.Failf(t, "data mismatch", "pos %d", pos+i)
+				return
+			}
+		}
+		pos += n
+	}
+	wg.Wait()
+
+	assert.Equal(t, 0, rb.Size())
+}
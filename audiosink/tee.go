@@ -0,0 +1,203 @@
+package audiosink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/drgolem/musiclab/audiosource"
+)
+
+// TeePolicy defines what tee does when branch consumer is slow
+type TeePolicy int
+
+const (
+	// TeeBlock waits for the branch, slows down all branches
+	TeeBlock TeePolicy = iota
+	// TeeDrop drops packet if the branch is not ready to receive it
+	TeeDrop
+	// TeeBuffer queues up to BufferSize packets, drops packets when queue is full
+	TeeBuffer
+)
+
+func (p TeePolicy) String() string {
+	switch p {
+	case TeeBlock:
+		return "block"
+	case TeeDrop:
+		return "drop"
+	case TeeBuffer:
+		return "buffer"
+	}
+	return fmt.Sprintf("TeePolicy(%d)", int(p))
+}
+
+type TeeBranch struct {
+	Policy TeePolicy
+	// queue size in packets for TeeBuffer policy
+	BufferSize int
+	// NewSink creates branch sink reading packets from the channel
+	NewSink func(audioPctChan <-chan audiosource.AudioSamplesPacket) (AudioSink, error)
+}
+
+type teeBranch struct {
+	policy  TeePolicy
+	sink    AudioSink
+	ch      chan audiosource.AudioSamplesPacket
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+type teeSink struct {
+	branches     []*teeBranch
+	audioPctChan <-chan audiosource.AudioSamplesPacket
+	mxClose      sync.Mutex
+	closed       bool
+}
+
+// NewTeeSink duplicates packets from the channel to every branch sink.
+// Packets are shared between branches, sinks must not modify audio data.
+// Branch sinks are played by the tee Play and closed by the tee Close.
+func NewTeeSink(audioPctChan <-chan audiosource.AudioSamplesPacket,
+	branches ...TeeBranch,
+) (AudioSink, error) {
+	ts := teeSink{
+		audioPctChan: audioPctChan,
+	}
+
+	for idx, b := range branches {
+		bufferSize := 0
+		switch b.Policy {
+		case TeeBlock, TeeDrop:
+		case TeeBuffer:
+			if b.BufferSize < 1 {
+				ts.Close(context.Background())
+				return nil, fmt.Errorf("tee branch %d: buffer size %d", idx, b.BufferSize)
+			}
+			bufferSize = b.BufferSize
+		default:
+			ts.Close(context.Background())
+			return nil, fmt.Errorf("tee branch %d: unknown policy %v", idx, b.Policy)
+		}
+
+		ch := make(chan audiosource.AudioSamplesPacket, bufferSize)
+		sink, err := b.NewSink(ch)
+		if err != nil {
+			ts.Close(context.Background())
+			return nil, fmt.Errorf("tee branch %d: %w", idx, err)
+		}
+
+		ts.branches = append(ts.branches, &teeBranch{
+			policy: b.Policy,
+			sink:   sink,
+			ch:     ch,
+			done:   make(chan struct{}),
+		})
+	}
+
+	return &ts, nil
+}
+
+// Play runs branch sinks until the input channel is closed (or context is
+// done) and all branches finished playing
+func (ts *teeSink) Play(ctx context.Context) error {
+	errs := make([]error, len(ts.branches))
+
+	var wg sync.WaitGroup
+	for idx, b := range ts.branches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(b.done)
+
+			errs[idx] = b.sink.Play(ctx)
+		}()
+	}
+
+LOOP:
+	for {
+		select {
+		case pkt, ok := <-ts.audioPctChan:
+			if !ok {
+				break LOOP
+			}
+			for _, b := range ts.branches {
+				b.send(ctx, pkt)
+			}
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+
+	// end of stream for all branches
+	for _, b := range ts.branches {
+		close(b.ch)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (b *teeBranch) send(ctx context.Context, pkt audiosource.AudioSamplesPacket) {
+	select {
+	case <-b.done:
+		// branch sink stopped playing
+		return
+	default:
+	}
+
+	if b.policy == TeeBlock {
+		select {
+		case b.ch <- pkt:
+		case <-b.done:
+		case <-ctx.Done():
+		}
+		return
+	}
+
+	select {
+	case b.ch <- pkt:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+func (ts *teeSink) Status() map[string]string {
+	attrs := make(map[string]string)
+
+	for idx, b := range ts.branches {
+		attrs[fmt.Sprintf("%d.policy", idx)] = b.policy.String()
+		attrs[fmt.Sprintf("%d.dropped", idx)] = fmt.Sprintf("%d", b.dropped.Load())
+		if b.policy == TeeBuffer {
+			attrs[fmt.Sprintf("%d.queued", idx)] = fmt.Sprintf("%d", len(b.ch))
+		}
+
+		if sr, ok := b.sink.(StatusReporter); ok {
+			for k, v := range sr.Status() {
+				attrs[fmt.Sprintf("%d.%s", idx, k)] = v
+			}
+		}
+	}
+
+	return attrs
+}
+
+// Close closes all branch sinks
+func (ts *teeSink) Close(ctx context.Context) error {
+	ts.mxClose.Lock()
+	defer ts.mxClose.Unlock()
+
+	if ts.closed {
+		return nil
+	}
+	ts.closed = true
+
+	errs := make([]error, 0, len(ts.branches))
+	for _, b := range ts.branches {
+		errs = append(errs, b.sink.Close(ctx))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,97 @@
+package audiosink
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+type testSink struct {
+	audioPctChan <-chan audiosource.AudioSamplesPacket
+	received     []int
+	delay        time.Duration
+	playErr      error
+	closed       bool
+}
+
+func (s *testSink) Play(ctx context.Context) error {
+	for pkt := range s.audioPctChan {
+		if s.playErr != nil {
+			return s.playErr
+		}
+		s.received = append(s.received, pkt.SamplesCount)
+		time.Sleep(s.delay)
+	}
+	return nil
+}
+
+func (s *testSink) Close(ctx context.Context) error {
+	s.closed = true
+	return nil
+}
+
+func testBranch(policy TeePolicy, bufferSize int, sink *testSink) TeeBranch {
+	return TeeBranch{
+		Policy:     policy,
+		BufferSize: bufferSize,
+		NewSink: func(audioPctChan <-chan audiosource.AudioSamplesPacket) (AudioSink, error) {
+			sink.audioPctChan = audioPctChan
+			return sink, nil
+		},
+	}
+}
+
+func Test_TeeSink(t *testing.T) {
+	const packets = 20
+
+	in := make(chan audiosource.AudioSamplesPacket)
+	go func() {
+		defer close(in)
+		for i := range packets {
+			in <- audiosource.AudioSamplesPacket{
+				Format:       types.FrameFormat{SampleRate: 44100, Channels: 2, BitsPerSample: 16},
+				SamplesCount: i,
+			}
+		}
+	}()
+
+	blockSink := &testSink{delay: time.Millisecond}
+	dropSink := &testSink{delay: 5 * time.Millisecond}
+	bufferSink := &testSink{delay: 5 * time.Millisecond}
+	failedSink := &testSink{playErr: errors.New("device lost")}
+
+	sink, err := NewTeeSink(in,
+		testBranch(TeeBlock, 0, blockSink),
+		testBranch(TeeDrop, 0, dropSink),
+		testBranch(TeeBuffer, packets, bufferSink),
+		testBranch(TeeBlock, 0, failedSink),
+	)
+	assert.NoError(t, err)
+
+	err = sink.Play(context.Background())
+	assert.ErrorIs(t, err, failedSink.playErr)
+
+	expAll := make([]int, packets)
+	for i := range expAll {
+		expAll[i] = i
+	}
+	assert.Equal(t, expAll, blockSink.received)
+	assert.Equal(t, expAll, bufferSink.received)
+	assert.Less(t, len(dropSink.received), packets)
+
+	status := sink.(StatusReporter).Status()
+	assert.Equal(t, "drop", status["1.policy"])
+	assert.NotEqual(t, "0", status["1.dropped"])
+	assert.Equal(t, "0", status["2.dropped"])
+
+	assert.NoError(t, sink.Close(context.Background()))
+	for _, s := range []*testSink{blockSink, dropSink, bufferSink, failedSink} {
+		assert.True(t, s.closed)
+	}
+}
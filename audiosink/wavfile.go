@@ -0,0 +1,194 @@
+package audiosink
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+const wavHeaderSize = 44
+
+type wavHeader struct {
+	RiffID        [4]byte
+	RiffSize      uint32
+	WaveID        [4]byte
+	FmtID         [4]byte
+	FmtSize       uint32
+	AudioFormat   uint16
+	NumChannels   uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+	DataID        [4]byte
+	DataSize      uint32
+}
+
+// WavHeader returns canonical 44 bytes PCM wav header, data size is clamped
+// to the maximum size a RIFF file can hold (streams can pass math.MaxUint32)
+func WavHeader(audioFormat types.FrameFormat, dataSize int64) []byte {
+	size := uint32(min(dataSize, math.MaxUint32-wavHeaderSize))
+	blockAlign := audioFormat.Channels * audioFormat.BitsPerSample / 8
+
+	hdr := wavHeader{
+		RiffID:        [4]byte{'R', 'I', 'F', 'F'},
+		RiffSize:      wavHeaderSize - 8 + size,
+		WaveID:        [4]byte{'W', 'A', 'V', 'E'},
+		FmtID:         [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1, // PCM
+		NumChannels:   uint16(audioFormat.Channels),
+		SampleRate:    uint32(audioFormat.SampleRate),
+		ByteRate:      uint32(audioFormat.SampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: uint16(audioFormat.BitsPerSample),
+		DataID:        [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      size,
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &hdr)
+	return buf.Bytes()
+}
+
+type wavFileSink struct {
+	file          *os.File
+	audioFormat   types.FrameFormat
+	headerWritten bool
+	dataSize      int64
+	audioPctChan  <-chan audiosource.AudioSamplesPacket
+	mx            sync.Mutex
+}
+
+// NewWavFileSink creates (or truncates) output wav file. Samples are written
+// as they arrive on the channel, RIFF sizes are updated on Close.
+func NewWavFileSink(fileName string,
+	audioPctChan <-chan audiosource.AudioSamplesPacket,
+) (AudioSink, error) {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := wavFileSink{
+		file: f,
+		audioFormat: types.FrameFormat{
+			SampleRate:    44100,
+			Channels:      2,
+			BitsPerSample: 16,
+		},
+		audioPctChan: audioPctChan,
+	}
+
+	return &ws, nil
+}
+
+func (ws *wavFileSink) Play(ctx context.Context) error {
+	for {
+		select {
+		case pkt, ok := <-ws.audioPctChan:
+			if !ok {
+				// channel closed, no data
+				return nil
+			}
+
+			err := ws.write(pkt)
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ws *wavFileSink) write(pkt audiosource.AudioSamplesPacket) error {
+	ws.mx.Lock()
+	defer ws.mx.Unlock()
+
+	if ws.file == nil {
+		return fmt.Errorf("wav sink closed")
+	}
+
+	if !ws.headerWritten {
+		ws.audioFormat = pkt.Format
+		err := ws.writeHeader()
+		if err != nil {
+			return err
+		}
+		ws.headerWritten = true
+	} else if ws.audioFormat != pkt.Format {
+		return fmt.Errorf("wav sink: format change %s -> %s not supported",
+			ws.audioFormat.String(), pkt.Format.String())
+	}
+
+	frameByteSize := pkt.Format.Channels * pkt.Format.BitsPerSample / 8
+	bytesSize := pkt.SamplesCount * frameByteSize
+
+	n, err := ws.file.Write(pkt.Audio[:bytesSize])
+	ws.dataSize += int64(n)
+
+	return err
+}
+
+func (ws *wavFileSink) writeHeader() error {
+	_, err := ws.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	hdr := WavHeader(ws.audioFormat, ws.dataSize)
+	if ws.dataSize%2 == 1 {
+		// RIFF chunk includes pad byte of odd sized data
+		riffSize := binary.LittleEndian.Uint32(hdr[4:])
+		binary.LittleEndian.PutUint32(hdr[4:], riffSize+1)
+	}
+
+	_, err = ws.file.Write(hdr)
+	if err != nil {
+		return err
+	}
+
+	_, err = ws.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (ws *wavFileSink) Close(ctx context.Context) error {
+	ws.mx.Lock()
+	defer ws.mx.Unlock()
+
+	if ws.file == nil {
+		return nil
+	}
+
+	if ws.dataSize%2 == 1 {
+		// RIFF chunks are word aligned
+		_, err := ws.file.Write([]byte{0})
+		if err != nil {
+			ws.file.Close()
+			ws.file = nil
+			return err
+		}
+	}
+
+	// patch RIFF and data chunk sizes
+	err := ws.writeHeader()
+	if err != nil {
+		ws.file.Close()
+		ws.file = nil
+		return err
+	}
+
+	err = ws.file.Close()
+	ws.file = nil
+
+	return err
+}
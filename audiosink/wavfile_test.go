@@ -0,0 +1,84 @@
+package audiosink
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+// writeWav writes audio packets of format through wav file sink
+func writeWav(t *testing.T, fileName string, format types.FrameFormat, packets ...[]byte) {
+	ctx := context.Background()
+
+	audioPktChan := make(chan audiosource.AudioSamplesPacket, len(packets))
+	frameBytes := format.Channels * format.BitsPerSample / 8
+	for _, audio := range packets {
+		audioPktChan <- audiosource.AudioSamplesPacket{
+			Format:       format,
+			Audio:        audio,
+			SamplesCount: len(audio) / frameBytes,
+		}
+	}
+	close(audioPktChan)
+
+	sink, err := NewWavFileSink(fileName, audioPktChan)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Play(ctx))
+	assert.NoError(t, sink.Close(ctx))
+}
+
+func Test_WavFileSink(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "out.wav")
+
+	format := types.FrameFormat{
+		SampleRate:    8000,
+		Channels:      2,
+		BitsPerSample: 16,
+	}
+	audio := make([]byte, 4*1000)
+	for i := range audio {
+		audio[i] = byte(i)
+	}
+	writeWav(t, fileName, format, audio[:1600], audio[1600:])
+
+	data, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, wavHeaderSize+len(audio), len(data))
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, uint32(wavHeaderSize-8+len(audio)), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, uint32(8000), binary.LittleEndian.Uint32(data[24:]))
+	assert.Equal(t, "data", string(data[36:40]))
+	assert.Equal(t, uint32(len(audio)), binary.LittleEndian.Uint32(data[40:]))
+	assert.Equal(t, audio, data[wavHeaderSize:])
+
+	// shorter rewrite truncates the file
+	writeWav(t, fileName, format, audio[:400])
+
+	data, err = os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, wavHeaderSize+400, len(data))
+	assert.Equal(t, uint32(400), binary.LittleEndian.Uint32(data[40:]))
+	assert.Equal(t, audio[:400], data[wavHeaderSize:])
+
+	// odd sized data is followed by pad byte
+	format8 := types.FrameFormat{
+		SampleRate:    8000,
+		Channels:      1,
+		BitsPerSample: 8,
+	}
+	writeWav(t, fileName, format8, []byte{1, 2, 3})
+
+	data, err = os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, wavHeaderSize+4, len(data))
+	assert.Equal(t, uint32(wavHeaderSize-8+4), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(data[40:]))
+	assert.Equal(t, []byte{1, 2, 3, 0}, data[wavHeaderSize:])
+}
@@ -1,11 +1,11 @@
 package audiosource
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"os/signal"
 	"syscall"
+
+	"github.com/drgolem/musiclab/types"
 )
 
 type AudioSamples struct {
@@ -13,82 +13,101 @@ type AudioSamples struct {
 	SampleRate int
 }
 
-func AudioSamplesFromFile(ctx context.Context, fileName string) (AudioSamples, error) {
+func AudioSamplesFromFile(ctx context.Context, fileName string, opts ...SetOptionsFn) (AudioSamples, error) {
 	var out AudioSamples
 
-	ctx, cancelFn := context.WithCancel(ctx)
-	defer cancelFn()
+	audioFormat, audioData, err := readAudioData(ctx, fileName, opts...)
+	if err != nil {
+		return out, err
+	}
 
-	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	sampleRate := audioFormat.SampleRate
 
-	const framesPerBuffer = 2048
+	channels := max(1, audioFormat.Channels)
+	nSamples := len(audioData) / (2 * channels)
 
-	audioStream, err := NewMusicAudioProducer(ctx, fileName, WithFramesPerBuffer(framesPerBuffer))
-	if err != nil {
-		return out, err
+	// mix all channels to mono, convert samples to float
+	audioSamples := make([]float64, nSamples)
+
+	idx := 0
+	for i := range audioSamples {
+		var sum float64
+		for range channels {
+			sum += float64(int16(uint16(audioData[idx]) | uint16(audioData[idx+1])<<8))
+			idx += 2
+		}
+		audioSamples[i] = sum / float64(channels) / 0x7FFF
 	}
-	defer audioStream.Close()
 
-	audioFormat := audioStream.GetFormat()
+	out.Audio = audioSamples
+	out.SampleRate = sampleRate
 
-	sampleRate := audioFormat.SampleRate
+	return out, nil
+}
 
-	inSamplesCnt := 0
+// AudioChannels is audio samples of each channel
+type AudioChannels struct {
+	Channels   [][]float64
+	SampleRate int
+}
 
-	audioData := make([]byte, 0)
+// AudioChannelsFromFile returns samples of each channel, samples are scaled
+// as in AudioSamplesFromFile
+func AudioChannelsFromFile(ctx context.Context, fileName string, opts ...SetOptionsFn) (AudioChannels, error) {
+	var out AudioChannels
 
-	for pct := range audioStream.Stream() {
-		inSamplesCnt += pct.SamplesCount
+	audioFormat, audioData, err := readAudioData(ctx, fileName, opts...)
+	if err != nil {
+		return out, err
+	}
 
-		audioData = append(audioData, pct.Audio[:pct.SamplesCount*4]...)
+	channels := audioFormat.Channels
+	nSamples := len(audioData) / (2 * channels)
+
+	out.SampleRate = audioFormat.SampleRate
+	out.Channels = make([][]float64, channels)
+	for ch := range channels {
+		out.Channels[ch] = make([]float64, nSamples)
 	}
 
-	// mix stereo to mono
-	if audioFormat.Channels == 2 {
-		var bufMono bytes.Buffer
-		bufMonoWriter := bufio.NewWriter(&bufMono)
+	idx := 0
+	for i := range nSamples {
+		for ch := range channels {
+			s := int16(uint16(audioData[idx]) | uint16(audioData[idx+1])<<8)
+			idx += 2
+			out.Channels[ch][i] = float64(s) / 0x7FFF
+		}
+	}
 
-		stereoData := audioData
-		idx := 0
-		for idx < len(stereoData) {
-			chSample := [2]int16{}
-			for ch := range 2 {
-				b0 := int16(stereoData[idx])
-				idx++
-				b1 := int16(stereoData[idx])
-				idx++
+	return out, nil
+}
 
-				chSample[ch] = int16((b1 << 8) | b0)
-			}
+// readAudioData returns format and 16 bit interleaved audio of the file
+func readAudioData(ctx context.Context, fileName string, opts ...SetOptionsFn) (types.FrameFormat, []byte, error) {
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
 
-			t := chSample[0]/2 + chSample[1]/2
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-			bufMonoWriter.WriteByte(byte(t & 0xFF))
-			bufMonoWriter.WriteByte(byte((t >> 8) & 0xFF))
-		}
+	const framesPerBuffer = 2048
 
-		bufMonoWriter.Flush()
-		audioData = bufMono.Bytes()
+	opts = append([]SetOptionsFn{WithFramesPerBuffer(framesPerBuffer)}, opts...)
+	audioStream, err := NewMusicAudioProducer(ctx, fileName, opts...)
+	if err != nil {
+		return types.FrameFormat{}, nil, err
 	}
+	defer audioStream.Close()
 
-	// convert samles to float
-	audioSamples := make([]float64, 0)
+	audioFormat := audioStream.GetFormat()
 
-	idx := 0
-	for idx < len(audioData) {
-		b0 := int16(audioData[idx])
-		idx++
-		b1 := int16(audioData[idx])
-		idx++
-		frameInt := int16((b1 << 8) | b0)
-		frame := float64(frameInt) / 0x7FFF
-
-		audioSamples = append(audioSamples, frame)
-	}
+	frameByteSize := audioFormat.Channels * audioFormat.BitsPerSample / 8
 
-	out.Audio = audioSamples
-	out.SampleRate = sampleRate
+	audioData := make([]byte, 0)
 
-	return out, nil
+	for pct := range audioStream.Stream() {
+		audioData = append(audioData, pct.Audio[:pct.SamplesCount*frameByteSize]...)
+	}
+
+	return audioFormat, audioData, nil
 }
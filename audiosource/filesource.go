@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -29,11 +31,21 @@ type musicDecoder interface {
 	Close() error
 }
 
+// samplesCounter is implemented by decoders knowing exact stream length,
+// 0 - length is unknown
+type samplesCounter interface {
+	TotalSamples() int64
+}
+
 type ProducerOptions struct {
 	FramesPerBuffer     int
 	Start               time.Duration
 	Duration            time.Duration
 	ProducerContextData string
+	// raw PCM format of stdin input without wav header
+	InputFormat types.FrameFormat
+	// producer messages, stdout by default
+	LogOutput io.Writer
 }
 
 type SetOptionsFn func(opt *ProducerOptions)
@@ -62,6 +74,20 @@ func WithContextData(data string) SetOptionsFn {
 	}
 }
 
+func WithInputFormat(audioFormat types.FrameFormat) SetOptionsFn {
+	return func(opt *ProducerOptions) {
+		opt.InputFormat = audioFormat
+	}
+}
+
+// WithLogOutput sets writer of producer messages, e.g. stderr when stdout
+// carries audio
+func WithLogOutput(w io.Writer) SetOptionsFn {
+	return func(opt *ProducerOptions) {
+		opt.LogOutput = w
+	}
+}
+
 type AudioStream interface {
 	GetFormat() types.FrameFormat
 	Status() map[string]string
@@ -69,6 +95,12 @@ type AudioStream interface {
 	Close() error
 }
 
+// SamplesCounter is implemented by audio streams knowing exact number of
+// samples, TotalSamples returns -1 if the length is unknown or only estimated
+type SamplesCounter interface {
+	TotalSamples() int64
+}
+
 type fileAudioStream struct {
 	audioFormat types.FrameFormat
 	stream      <-chan AudioSamplesPacket
@@ -91,11 +123,16 @@ func NewMusicAudioProducer(ctx context.Context,
 ) (AudioStream, error) {
 	opt := ProducerOptions{
 		FramesPerBuffer: 2048,
+		LogOutput:       os.Stdout,
 	}
 	for _, sf := range opts {
 		sf(&opt)
 	}
 
+	if fileName == StdinFileName {
+		return NewReaderAudioProducer(ctx, os.Stdin, opts...)
+	}
+
 	audioPacketStream := make(chan AudioSamplesPacket, 1)
 
 	audioStream := fileAudioStream{
@@ -118,7 +155,7 @@ func NewMusicAudioProducer(ctx context.Context,
 			return nil, err
 		}
 
-		fmt.Printf("Decoder: %s\n", mp3Decoder.CurrentDecoder())
+		fmt.Fprintf(opt.LogOutput, "Decoder: %s\n", mp3Decoder.CurrentDecoder())
 		decoder = mp3Decoder
 		closeFn = func() error {
 			decoder.Close()
@@ -131,7 +168,7 @@ func NewMusicAudioProducer(ctx context.Context,
 		if err != nil {
 			return nil, err
 		}
-		fmt.Printf("file %s, stream type: %v\n", fileName, streamType)
+		fmt.Fprintf(opt.LogOutput, "file %s, stream type: %v\n", fileName, streamType)
 		if streamType == decoders.StreamType_Vorbis {
 			vorbisDecoder, err := decoders.NewOggVorbisDecoder()
 			if err != nil {
@@ -168,6 +205,16 @@ func NewMusicAudioProducer(ctx context.Context,
 		closeFn = func() error {
 			return decoder.Close()
 		}
+	case types.FileFormat_M4A:
+		m4aDecoder, err := decoders.NewM4aDecoder()
+		if err != nil {
+			return nil, err
+		}
+		decoder = m4aDecoder
+		closeFn = func() error {
+			return decoder.Close()
+		}
+		seekFunc = m4aDecoder.Seek
 	default:
 		return nil, fmt.Errorf("unsupported file format: %s", ext)
 	}
@@ -196,7 +243,7 @@ func NewMusicAudioProducer(ctx context.Context,
 	audioStream.seekFunc = seekFunc
 
 	go func(ctx context.Context) {
-		startSamplesPos := int(opt.Start.Seconds() * float64(audioFormat.SampleRate))
+		startSamplesPos := int(math.Round(opt.Start.Seconds() * float64(audioFormat.SampleRate)))
 		outSamplesCnt := int(opt.Duration.Seconds() * float64(audioStream.audioFormat.SampleRate))
 		samplesPos := 0
 		samplesCnt := 0
@@ -204,7 +251,7 @@ func NewMusicAudioProducer(ctx context.Context,
 		if startSamplesPos > 0 && audioStream.seekFunc != nil {
 			_, err := audioStream.seekFunc(int64(startSamplesPos), io.SeekCurrent)
 			if err != nil {
-				fmt.Printf("ERR seek %v\n", err)
+				fmt.Fprintf(opt.LogOutput, "ERR seek %v\n", err)
 				return
 			}
 			samplesPos = startSamplesPos
@@ -232,7 +279,7 @@ func NewMusicAudioProducer(ctx context.Context,
 				break
 			}
 			if err != nil {
-				fmt.Printf("ERR: %v\n", err)
+				fmt.Fprintf(opt.LogOutput, "ERR: %v\n", err)
 				close(audioPacketStream)
 				return
 			}
@@ -246,8 +293,14 @@ func NewMusicAudioProducer(ctx context.Context,
 			}
 
 			skipPacket := false
-			if startSamplesPos > samplesPos+pct.SamplesCount {
+			if startSamplesPos >= samplesPos+nSamples {
 				skipPacket = true
+			} else if startSamplesPos > samplesPos {
+				// decoder can't seek, start inside the packet
+				offset := startSamplesPos - samplesPos
+				frameByteSize := audioFormat.Channels * audioFormat.BitsPerSample / 8
+				pct.Audio = pct.Audio[offset*frameByteSize:]
+				pct.SamplesCount -= offset
 			}
 
 			if !skipPacket {
@@ -255,7 +308,7 @@ func NewMusicAudioProducer(ctx context.Context,
 				select {
 				case audioPacketStream <- pct:
 				case <-ctx.Done():
-					fmt.Println("context done in MusicAudioProducer")
+					fmt.Fprintln(opt.LogOutput, "context done in MusicAudioProducer")
 					close(audioPacketStream)
 					return
 				case <-audioStream.done:
@@ -265,7 +318,7 @@ func NewMusicAudioProducer(ctx context.Context,
 				samplesCnt += pct.SamplesCount
 			}
 
-			samplesPos += pct.SamplesCount
+			samplesPos += nSamples
 
 			audioStream.mxStatus.Lock()
 			audioStream.elapsedSamples = samplesCnt
@@ -278,7 +331,7 @@ func NewMusicAudioProducer(ctx context.Context,
 
 			select {
 			case <-ctx.Done():
-				fmt.Println("context done in MusicAudioProducer")
+				fmt.Fprintln(opt.LogOutput, "context done in MusicAudioProducer")
 				close(audioPacketStream)
 				return
 			case <-audioStream.done:
@@ -287,7 +340,7 @@ func NewMusicAudioProducer(ctx context.Context,
 			default:
 			}
 		}
-		fmt.Println("exit MusicAudioProducer")
+		fmt.Fprintln(opt.LogOutput, "exit MusicAudioProducer")
 	}(ctx)
 
 	return &audioStream, nil
@@ -322,6 +375,20 @@ func (s *fileAudioStream) Status() map[string]string {
 	return attrs
 }
 
+// TotalSamples returns number of samples in the file, -1 if the decoder does
+// not know it exactly (mp3 length is estimated)
+func (s *fileAudioStream) TotalSamples() int64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if counter, ok := s.decoder.(samplesCounter); ok {
+		if n := counter.TotalSamples(); n > 0 {
+			return n
+		}
+	}
+	return -1
+}
+
 func (s *fileAudioStream) Stream() <-chan AudioSamplesPacket {
 	return s.stream
 }
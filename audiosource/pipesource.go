@@ -0,0 +1,262 @@
+package audiosource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drgolem/musiclab/types"
+)
+
+// StdinFileName is a file name to read audio from stdin
+const StdinFileName = "-"
+
+type readerAudioStream struct {
+	audioFormat types.FrameFormat
+	stream      <-chan AudioSamplesPacket
+
+	mxStatus       sync.RWMutex
+	elapsedSamples int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReaderAudioProducer reads PCM audio from the reader (stdin pipe). Format
+// is taken from wav header when input starts with one, otherwise raw PCM in
+// format given by WithInputFormat is expected. 24 bit input is converted to
+// 16 bit samples.
+func NewReaderAudioProducer(ctx context.Context,
+	r io.Reader,
+	opts ...SetOptionsFn,
+) (AudioStream, error) {
+	opt := ProducerOptions{
+		FramesPerBuffer: 2048,
+		LogOutput:       os.Stdout,
+	}
+	for _, sf := range opts {
+		sf(&opt)
+	}
+
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	inFormat, dataSize, isWav, err := readWavHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	var in io.Reader = br
+	if isWav {
+		fmt.Fprintf(opt.LogOutput, "Input: wav %s\n", inFormat.String())
+		if dataSize > 0 {
+			in = io.LimitReader(br, dataSize)
+		}
+	} else {
+		if opt.InputFormat == (types.FrameFormat{}) {
+			return nil, fmt.Errorf("input has no wav header, raw PCM format is required")
+		}
+		inFormat = opt.InputFormat
+		fmt.Fprintf(opt.LogOutput, "Input: raw PCM %s\n", inFormat.String())
+	}
+
+	if inFormat.BitsPerSample != 16 && inFormat.BitsPerSample != 24 {
+		return nil, fmt.Errorf("bits per sample %d not supported", inFormat.BitsPerSample)
+	}
+	if inFormat.SampleRate <= 0 || inFormat.Channels <= 0 {
+		return nil, fmt.Errorf("invalid input format %s", inFormat.String())
+	}
+
+	audioFormat := inFormat
+	audioFormat.BitsPerSample = 16
+
+	audioPacketStream := make(chan AudioSamplesPacket, 1)
+
+	audioStream := readerAudioStream{
+		audioFormat: audioFormat,
+		stream:      audioPacketStream,
+		done:        make(chan struct{}),
+	}
+
+	go func(ctx context.Context) {
+		defer close(audioPacketStream)
+
+		inFrameSize := inFormat.Channels * inFormat.BitsPerSample / 8
+		outFrameSize := audioFormat.Channels * audioFormat.BitsPerSample / 8
+
+		startSamplesPos := int64(opt.Start.Seconds() * float64(audioFormat.SampleRate))
+		outSamplesCnt := int(opt.Duration.Seconds() * float64(audioFormat.SampleRate))
+		samplesCnt := 0
+
+		if startSamplesPos > 0 {
+			// pipe is not seekable, skip audio before start position
+			_, err := io.CopyN(io.Discard, in, startSamplesPos*int64(inFrameSize))
+			if err != nil {
+				return
+			}
+		}
+
+		for {
+			framesPerBuffer := opt.FramesPerBuffer
+			if outSamplesCnt > 0 {
+				framesPerBuffer = min(framesPerBuffer, outSamplesCnt-samplesCnt)
+			}
+
+			inBuf := make([]byte, framesPerBuffer*inFrameSize)
+			n, err := io.ReadFull(in, inBuf)
+			nSamples := n / inFrameSize
+			if nSamples > 0 {
+				audio := inBuf[:nSamples*inFrameSize]
+				if inFormat.BitsPerSample == 24 {
+					audio = pcm24To16(audio)
+				}
+
+				pct := AudioSamplesPacket{
+					Format:       audioFormat,
+					Audio:        audio[:nSamples*outFrameSize],
+					SamplesCount: nSamples,
+				}
+
+				select {
+				case audioPacketStream <- pct:
+				case <-ctx.Done():
+					return
+				case <-audioStream.done:
+					return
+				}
+				samplesCnt += nSamples
+
+				audioStream.mxStatus.Lock()
+				audioStream.elapsedSamples = samplesCnt
+				audioStream.mxStatus.Unlock()
+			}
+
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					fmt.Fprintf(opt.LogOutput, "ERR: %v\n", err)
+				}
+				return
+			}
+			if outSamplesCnt > 0 && samplesCnt >= outSamplesCnt {
+				return
+			}
+		}
+	}(ctx)
+
+	return &audioStream, nil
+}
+
+// readWavHeader parses RIFF header up to the data chunk. Reader is not
+// consumed when input does not start with RIFF/WAVE.
+func readWavHeader(br *bufio.Reader) (types.FrameFormat, int64, bool, error) {
+	var audioFormat types.FrameFormat
+
+	hdr, err := br.Peek(12)
+	if err != nil || !bytes.Equal(hdr[:4], []byte("RIFF")) || !bytes.Equal(hdr[8:12], []byte("WAVE")) {
+		// not a wav stream (or too short to be one)
+		return audioFormat, 0, false, nil
+	}
+	br.Discard(12)
+
+	fmtFound := false
+	for {
+		var chunkHdr [8]byte
+		_, err := io.ReadFull(br, chunkHdr[:])
+		if err != nil {
+			return audioFormat, 0, true, fmt.Errorf("wav header: %w", err)
+		}
+		chunkID := string(chunkHdr[:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunkHdr[4:]))
+
+		switch chunkID {
+		case "fmt ":
+			if chunkSize < 16 {
+				return audioFormat, 0, true, fmt.Errorf("wav header: fmt chunk size %d", chunkSize)
+			}
+			chunk := make([]byte, chunkSize+chunkSize%2)
+			_, err := io.ReadFull(br, chunk)
+			if err != nil {
+				return audioFormat, 0, true, fmt.Errorf("wav header: %w", err)
+			}
+
+			// 1 - PCM, 0xFFFE - WAVE_FORMAT_EXTENSIBLE
+			formatTag := binary.LittleEndian.Uint16(chunk[0:])
+			if formatTag != 1 && formatTag != 0xFFFE {
+				return audioFormat, 0, true, fmt.Errorf("wav header: format %d not supported", formatTag)
+			}
+			audioFormat.Channels = int(binary.LittleEndian.Uint16(chunk[2:]))
+			audioFormat.SampleRate = int(binary.LittleEndian.Uint32(chunk[4:]))
+			audioFormat.BitsPerSample = int(binary.LittleEndian.Uint16(chunk[14:]))
+			fmtFound = true
+		case "data":
+			if !fmtFound {
+				return audioFormat, 0, true, fmt.Errorf("wav header: data chunk before fmt")
+			}
+			// streaming writers do not know data size
+			if chunkSize == 0 || chunkSize >= 0xFFFFFFFF-44 {
+				chunkSize = 0
+			}
+			return audioFormat, chunkSize, true, nil
+		default:
+			_, err := io.CopyN(io.Discard, br, chunkSize+chunkSize%2)
+			if err != nil {
+				return audioFormat, 0, true, fmt.Errorf("wav header: %w", err)
+			}
+		}
+	}
+}
+
+// pcm24To16 converts 24 bit samples to 16 bit in place
+func pcm24To16(audio []byte) []byte {
+	nSamples := len(audio) / 3
+	for i := range nSamples {
+		audio[2*i] = audio[3*i+1]
+		audio[2*i+1] = audio[3*i+2]
+	}
+	return audio[:2*nSamples]
+}
+
+func (s *readerAudioStream) GetFormat() types.FrameFormat {
+	return s.audioFormat
+}
+
+func (s *readerAudioStream) Status() map[string]string {
+	s.mxStatus.RLock()
+	defer s.mxStatus.RUnlock()
+
+	attrs := make(map[string]string)
+
+	attrs["format"] = fmt.Sprintf("%d:%d:%d",
+		s.audioFormat.SampleRate,
+		s.audioFormat.BitsPerSample,
+		s.audioFormat.Channels,
+	)
+
+	attrs["elapsed_samples"] = fmt.Sprintf("%d", s.elapsedSamples)
+
+	elapsed := float64(s.elapsedSamples) / float64(s.audioFormat.SampleRate)
+
+	dur := time.Second * time.Duration(elapsed)
+
+	attrs["elapsed_str"] = dur.String()
+
+	attrs["elapsed"] = fmt.Sprintf("%.6f", elapsed)
+
+	return attrs
+}
+
+func (s *readerAudioStream) Stream() <-chan AudioSamplesPacket {
+	return s.stream
+}
+
+func (s *readerAudioStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
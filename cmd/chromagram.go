@@ -9,6 +9,7 @@ import (
 	"log"
 	"math"
 	"os"
+	"strconv"
 
 	"github.com/drgolem/musiclab/audiosource"
 	"github.com/drgolem/musiclab/dsp"
@@ -36,7 +37,13 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(chromagramCmd)
 
-	chromagramCmd.Flags().String("file", "", "file to analyze")
+	chromagramCmd.Flags().String("file", "", "file to analyze, - to read stdin")
+	chromagramCmd.Flags().String("tuning", "auto", "tuning offset in semitones (-0.5..0.5) or auto")
+	chromagramCmd.Flags().Float64("log-compression", 0, "chroma log compression factor (0 - none)")
+	chromagramCmd.Flags().Bool("cens", false, "plot smoothed CENS chroma")
+	chromagramCmd.Flags().Bool("harmonic", false, "use harmonic part of HPSS, drums are removed")
+	chromagramCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	addSTFTFlags(chromagramCmd, "hann", 2048*2, "amplitude")
 }
 
 type noteInterval struct {
@@ -51,15 +58,54 @@ func doChromagramCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
-	if _, err := os.Stat(inFileName); os.IsNotExist(err) {
-		fmt.Printf("path [%s] does not exist\n", inFileName)
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	tuningStr, err := cmd.Flags().GetString("tuning")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	var tuning float64
+	if tuningStr != "auto" {
+		tuning, err = strconv.ParseFloat(tuningStr, 64)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			return
+		}
+	}
+
+	logCompression, err := cmd.Flags().GetFloat64("log-compression")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	withCens, err := cmd.Flags().GetBool("cens")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	harmonicOnly, err := cmd.Flags().GetBool("harmonic")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
 		return
 	}
 
-	fileNameBase := filenameWithoutExtension(inFileName)
+	fileNameBase := outputBaseName(inFileName)
 
 	ctx := context.Background()
-	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName)
+	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName, inFormatOpt)
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
 		return
@@ -72,43 +118,67 @@ func doChromagramCmd(cmd *cobra.Command, args []string) {
 	audioSamples := audioData.Audio
 	sampleRate := audioData.SampleRate
 
-	//wndSamplesLen := 2048 * 2
-	wndSamplesLen := 2048 * 2
-
-	stff := dsp.New(
-		int(float64(sampleRate)/100.0), // 0.01 sec
-		wndSamplesLen,
-	)
+	stff, scale, err := stftFromFlags(cmd, int(float64(sampleRate)/100.0)) // 0.01 sec
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	nfft := stff.FFTLen()
 
-	stffRes2 := stff.STFT(audioSamples)
-	spectrogram, _ := dsp.SplitSpectrogram(stffRes2)
+	spectrogram := stff.Magnitude(audioSamples)
+	if len(spectrogram) == 0 {
+		fmt.Printf("ERR: audio is shorter than %d samples\n", stff.FrameLen)
+		return
+	}
+	if harmonicOnly {
+		spectrogram = dsp.NewHPSS().Harmonic(spectrogram)
+	}
 
 	noteIntervals := make([]noteInterval, 0)
 
 	mx := make([][]float64, 0)
 
-	for frameIdx, freqFrame := range spectrogram {
-		freqMap := make(map[string]float64)
-		for idx, sf := range freqFrame {
-			if sf < 1.0 {
-				continue
-			}
-			freq := float64(idx) * float64(sampleRate) / float64(wndSamplesLen)
-			if math.Abs(freq) < 0.1 {
-				continue
+	if tuningStr == "auto" {
+		tuning = dsp.EstimateTuning(spectrogram, sampleRate, nfft)
+	}
+	fmt.Printf("Tuning: %+.0f cents\n", tuning*100)
+
+	chromaExtractor := dsp.NewChroma(sampleRate)
+	chromaExtractor.Tuning = tuning
+	chromaExtractor.LogCompression = logCompression
+
+	scaled := stff.ScaleSpectrogram(spectrogram, sampleRate, scale)
+
+	var chroma [][]float64
+	switch scale {
+	case dsp.ScaleAmplitude:
+		chroma = chromaExtractor.FromSpectrogram(scaled, nfft)
+	case dsp.ScaleDB:
+		chroma = chromaExtractor.FromPowerSpectrogram(levelsAboveFloor(scaled, 80), nfft)
+	default:
+		chroma = chromaExtractor.FromPowerSpectrogram(scaled, nfft)
+	}
+	if withCens {
+		// 41 frames smoothing, 10 Hz feature rate
+		chroma = dsp.CENS(chroma, 41, 10)
+	}
+
+	for frameIdx, chromaFrame := range chroma {
+		maxIdx := 0
+		for idx, v := range chromaFrame {
+			if v > chromaFrame[maxIdx] {
+				maxIdx = idx
 			}
-			note := freqToNote(freq)
-			freqMap[note] += sf
 		}
-		if len(freqMap) == 0 {
+		if chromaFrame[maxIdx] == 0 {
+			// silence
 			continue
 		}
 
-		maxNote := getMaxNote(freqMap)
+		maxNote := dsp.ChromaNoteNames[maxIdx]
 		//fmt.Printf("%d - %v\n", frameIdx, maxNote)
 
-		freqArray := freqMapToArray(freqMap)
-		mx = append(mx, freqArray)
+		mx = append(mx, chromaFrame)
 
 		if len(noteIntervals) == 0 {
 			noteIntervals = append(noteIntervals, noteInterval{
@@ -263,32 +333,26 @@ func doChromagramCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
-func freqMapToArray(freq map[string]float64) []float64 {
-	notes := []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
-
-	out := make([]float64, 0)
-
-	for _, nt := range notes {
-		val := 0.0
-		if v, ok := freq[nt]; ok {
-			val = v
+// levelsAboveFloor returns dB spectrogram levels above the floor of
+// dbRange below the maximum, levels under the floor are 0
+func levelsAboveFloor(spectrogram [][]float64, dbRange float64) [][]float64 {
+	mx := math.Inf(-1)
+	for _, frame := range spectrogram {
+		for _, v := range frame {
+			mx = max(mx, v)
 		}
-		out = append(out, val)
 	}
+	floor := mx - dbRange
 
-	return out
-}
-
-func getMaxNote(mp map[string]float64) string {
-	mx := -math.MaxFloat64
-	note := ""
-	for k, v := range mp {
-		if v > mx {
-			mx = v
-			note = k
+	levels := make([][]float64, len(spectrogram))
+	for i, frame := range spectrogram {
+		levels[i] = make([]float64, len(frame))
+		for k, v := range frame {
+			levels[i][k] = max(v-floor, 0)
 		}
 	}
-	return note
+
+	return levels
 }
 
 func freqToNote(freq float64) string {
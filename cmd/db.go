@@ -19,6 +19,7 @@ import (
 
 	badger "github.com/dgraph-io/badger/v4"
 
+	"github.com/drgolem/musiclab/audioproc"
 	"github.com/drgolem/musiclab/audiosource"
 	"github.com/drgolem/musiclab/dsp"
 	"github.com/drgolem/musiclab/scan"
@@ -58,6 +59,7 @@ func init() {
 	dbCmd.Flags().Bool("scan", false, "scan folder for music files")
 	dbCmd.Flags().String("music-root", "", "root folder of music collection")
 	dbCmd.Flags().String("db", "spectr.db", "database file")
+	dbCmd.Flags().Bool("key", false, "estimate musical key of songs while scanning")
 }
 
 func doDatabaseCmd(cmd *cobra.Command, args []string) {
@@ -83,13 +85,19 @@ func doDatabaseCmd(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	detectKey, err := cmd.Flags().GetBool("key")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
 	if doDbScan {
-		scanMusic(musicRoot, musicDb)
+		scanMusic(musicRoot, musicDb, detectKey)
 	}
 
 }
 
-func scanMusic(musicRoot string, musicDb string) {
+func scanMusic(musicRoot string, musicDb string, detectKey bool) {
 	ctx := context.Background()
 
 	var wgProcess *errgroup.Group
@@ -102,6 +110,7 @@ func scanMusic(musicRoot string, musicDb string) {
 		types.FileFormat_FLAC,
 		types.FileFormat_OGG,
 		types.FileFormat_WAV,
+		types.FileFormat_M4A,
 	}
 
 	songsChan, foldersChan, cuesheetChan, err := scan.MusicDocWalker(ctx, musicRoot,
@@ -190,10 +199,10 @@ func scanMusic(musicRoot string, musicDb string) {
 	//songDocs = append(songDocs, mrd)
 	songDocChan <- mrd
 
-	processSongs(ctx, musicDb, songDocChan)
+	processSongs(ctx, musicDb, songDocChan, detectKey)
 }
 
-func processSongs(ctx context.Context, musicDb string, songDocChan <-chan types.SongDocument) {
+func processSongs(ctx context.Context, musicDb string, songDocChan <-chan types.SongDocument, detectKey bool) {
 	// database
 	// songs: {idx, filePath}
 	// hashes: {key: hash, value: (timestamp, song idx)}
@@ -207,7 +216,7 @@ func processSongs(ctx context.Context, musicDb string, songDocChan <-chan types.
 	}
 	defer db.Close()
 
-	songs := make([]string, 0)
+	songs := make([]*types.SongInfo, 0)
 	songHashes := make(map[uint64][]SongHashLocator)
 
 	frameShift := 441
@@ -229,13 +238,19 @@ func processSongs(ctx context.Context, musicDb string, songDocChan <-chan types.
 
 		inFileName := sd.Song.FilePath
 
-		songs = append(songs, sd.Song.FilePath)
+		song := sd.Song
+		songs = append(songs, song)
 
 		idx := songIdx
 		wgProcess.Go(
 			func() error {
 				fileSampleRate, refFileSpectr := getFileSpectrogram(ctx, inFileName, frameShift, frameSamples)
 
+				if detectKey && len(refFileSpectr) > 0 {
+					key := estimateKey(refFileSpectr, fileSampleRate, frameSamples, dsp.KeyProfileKrumhansl)
+					song.Key = key.String()
+				}
+
 				sh := spectrToSongHashes(fileSampleRate, frameShift, idx, refFileSpectr)
 
 				hsMx.Lock()
@@ -258,7 +273,11 @@ func processSongs(ctx context.Context, musicDb string, songDocChan <-chan types.
 	wgProcess.Wait()
 
 	for idx, s := range songs {
-		fmt.Printf("idx: %d - song: %s\n", idx, s)
+		if s.Key != "" {
+			fmt.Printf("idx: %d - song: %s, key: %s\n", idx, s.FilePath, s.Key)
+			continue
+		}
+		fmt.Printf("idx: %d - song: %s\n", idx, s.FilePath)
 	}
 
 	t0 := time.Now()
@@ -284,7 +303,24 @@ func processSongs(ctx context.Context, musicDb string, songDocChan <-chan types.
 			binKey := make([]byte, 8)
 			binary.LittleEndian.PutUint64(binKey, uint64(idx))
 			binKey = append(prefix, binKey...)
-			err = txn.Set(binKey, []byte(song))
+			err = txn.Set(binKey, []byte(song.FilePath))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("ERR: %v", err)
+	}
+
+	err = db.Update(func(txn *badger.Txn) error {
+		prefix := []byte("skey")
+		for idx, song := range songs {
+			if song.Key == "" {
+				continue
+			}
+			binKey := make([]byte, 8)
+			binary.LittleEndian.PutUint64(binKey, uint64(idx))
+			binKey = append(prefix, binKey...)
+			err = txn.Set(binKey, []byte(song.Key))
 		}
 		return nil
 	})
@@ -332,16 +368,19 @@ func arrSongLocatorsToBytes(lst []SongHashLocator) []byte {
 
 func getFileSpectrogram(ctx context.Context,
 	fileName string, frameShift int, frameSamples int) (int, [][]float64) {
-	audioData, err := audiosource.AudioSamplesFromFile(ctx, fileName)
+	const framesPerBuffer = 2048
+
+	audioStream, err := audiosource.NewMusicAudioProducer(ctx, fileName,
+		audiosource.WithFramesPerBuffer(framesPerBuffer))
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
 		return 0, nil
 	}
+	defer audioStream.Close()
 
 	fmt.Printf("Spectrogram: %s\n", fileName)
 
-	audioSamples := audioData.Audio
-	sampleRate := audioData.SampleRate
+	sampleRate := audioStream.GetFormat().SampleRate
 
 	t0 := time.Now()
 	stft := dsp.New(
@@ -349,8 +388,13 @@ func getFileSpectrogram(ctx context.Context,
 		frameSamples,
 	)
 
-	stftRes := stft.STFT(audioSamples)
-	spectrogram, _ := dsp.SplitSpectrogram(stftRes)
+	// spectrogram frames are computed while decoding, the whole file audio
+	// is never kept in memory
+	spectrogram := make([][]float64, 0)
+	for frame := range audioproc.StreamSTFT(ctx, audioStream.Stream(), stft) {
+		amp, _ := dsp.SplitSpectrum(frame.Spectrum)
+		spectrogram = append(spectrogram, amp)
+	}
 
 	fmt.Printf("spectrogram done in %v\n", time.Since(t0))
 	return sampleRate, spectrogram
@@ -0,0 +1,229 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+)
+
+// denoiseCmd represents the denoise command
+var denoiseCmd = &cobra.Command{
+	Use:   "denoise",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doDenoiseCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(denoiseCmd)
+
+	denoiseCmd.Flags().String("in", "", "file to denoise, - to read stdin")
+	denoiseCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	denoiseCmd.Flags().String("out", "", "output file (default <in>.denoised.<format>)")
+	denoiseCmd.Flags().String("format", "wav", "output format: wav, flac")
+	denoiseCmd.Flags().String("noise-start", "", "start of a quiet region with noise only (default - lowest energy frames)")
+	denoiseCmd.Flags().String("noise-duration", "1s", "duration of the quiet region")
+	denoiseCmd.Flags().Float64("noise-fraction", 0.1, "fraction of the lowest energy frames used as noise without --noise-start")
+	denoiseCmd.Flags().Float64("reduction", 24, "noise reduction depth, dB")
+	denoiseCmd.Flags().Float64("threshold", 2, "gate threshold above noise level, standard deviations")
+	denoiseCmd.Flags().Int("smooth-frames", 5, "gate smoothing in time, STFT frames")
+	denoiseCmd.Flags().Int("smooth-bins", 3, "gate smoothing in frequency, bins")
+	denoiseCmd.Flags().Int("win-len", 2048, "STFT window length, samples")
+	denoiseCmd.Flags().Int("hop", 512, "STFT frame shift, samples")
+}
+
+func doDenoiseCmd(cmd *cobra.Command, args []string) {
+	inFileName, err := cmd.Flags().GetString("in")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	outFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	outFileName, err := cmd.Flags().GetString("out")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if outFileName == "" {
+		outFileName = outputBaseName(inFileName) + ".denoised." + outFormat
+	}
+
+	noiseStartStr, err := cmd.Flags().GetString("noise-start")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	var noiseStart time.Duration
+	if noiseStartStr != "" {
+		noiseStart, err = time.ParseDuration(noiseStartStr)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			return
+		}
+	}
+
+	noiseDurStr, err := cmd.Flags().GetString("noise-duration")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	noiseDur, err := time.ParseDuration(noiseDurStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	noiseFraction, err := cmd.Flags().GetFloat64("noise-fraction")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if noiseFraction <= 0 || noiseFraction > 1 {
+		fmt.Printf("ERR: invalid noise fraction: %.2f\n", noiseFraction)
+		return
+	}
+
+	gate := dsp.NewSpectralGate()
+	gate.ReductionDb, err = cmd.Flags().GetFloat64("reduction")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	gate.ThresholdStd, err = cmd.Flags().GetFloat64("threshold")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	gate.SmoothFrames, err = cmd.Flags().GetInt("smooth-frames")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	gate.SmoothBins, err = cmd.Flags().GetInt("smooth-bins")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if gate.ReductionDb < 0 {
+		fmt.Printf("ERR: invalid reduction: %.1f dB\n", gate.ReductionDb)
+		return
+	}
+
+	winLen, err := cmd.Flags().GetInt("win-len")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	hop, err := cmd.Flags().GetInt("hop")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if winLen < 2 || hop < 1 || hop > winLen {
+		fmt.Printf("ERR: invalid window length %d or hop %d\n", winLen, hop)
+		return
+	}
+
+	ctx := context.Background()
+	audioData, err := audiosource.AudioChannelsFromFile(ctx, inFileName, inFormatOpt)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	sampleRate := audioData.SampleRate
+
+	fmt.Printf("Denoise: %s\n", inFileName)
+	fmt.Printf("Channels: %d\n", len(audioData.Channels))
+	fmt.Printf("Sample Rate: %d\n", sampleRate)
+
+	stft := dsp.New(hop, winLen)
+
+	var noiseFrames []int
+	if noiseStartStr != "" {
+		from := int(noiseStart.Seconds() * float64(sampleRate))
+		to := from + int(noiseDur.Seconds()*float64(sampleRate))
+		noiseFrames = framesInRegion(stft, from, min(to, len(audioData.Channels[0])))
+		if len(noiseFrames) == 0 {
+			fmt.Printf("ERR: noise region [%v:%v] is shorter than %d samples window\n", noiseStart, noiseDur, winLen)
+			return
+		}
+		fmt.Printf("Noise region: [%v:%v], %d frames\n", noiseStart, noiseDur, len(noiseFrames))
+	}
+
+	denoised := make([][]float64, len(audioData.Channels))
+	for ch, samples := range audioData.Channels {
+		denoised[ch] = denoiseChannel(stft, gate, samples, noiseFrames, noiseFraction)
+	}
+
+	err = writeAudioFile(ctx, outFormat, outFileName, sampleRate, denoised, sourceSongInfo(inFileName))
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	fmt.Printf("File %s created\n", outFileName)
+}
+
+// framesInRegion returns indices of STFT frames within from..to samples
+func framesInRegion(stft *dsp.STFT, from int, to int) []int {
+	frames := make([]int, 0)
+	for i := (from + stft.FrameShift - 1) / stft.FrameShift; i*stft.FrameShift+stft.FrameLen <= to; i++ {
+		frames = append(frames, i)
+	}
+	return frames
+}
+
+// denoiseChannel returns samples with spectral gating by noise profile of
+// noiseFrames, or of noiseFraction of the lowest energy frames for nil
+// noiseFrames
+func denoiseChannel(stft *dsp.STFT, gate *dsp.SpectralGate, samples []float64,
+	noiseFrames []int, noiseFraction float64,
+) []float64 {
+	out := resynthesizeMasked(stft, samples, func(amp [][]float64, from int, to int) [][][]float64 {
+		// padding frames are not noise
+		var frames []int
+		if noiseFrames == nil {
+			frames = dsp.LowEnergyFrames(amp[from:to], noiseFraction)
+		} else {
+			frames = slices.Clone(noiseFrames)
+		}
+		for i := range frames {
+			frames[i] += from
+		}
+
+		profile := dsp.EstimateNoiseProfile(amp, frames)
+		return [][][]float64{gate.Mask(amp, profile)}
+	})
+
+	return out[0]
+}
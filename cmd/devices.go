@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/go-portaudio/portaudio"
+	"github.com/drgolem/musiclab/audiosink"
+)
+
+// devicesCmd represents the devices command
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doDevicesCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(devicesCmd)
+}
+
+func doDevicesCmd(cmd *cobra.Command, args []string) {
+	fmt.Printf("version text: %s\n", portaudio.GetVersionText())
+
+	err := portaudio.Initialize()
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	defer portaudio.Terminate()
+
+	hostApiCnt, err := portaudio.GetHostApiCount()
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	hostApiNames := make(map[int]string)
+
+	fmt.Printf("Host APIs (count: %d)\n", hostApiCnt)
+	for idx := 0; idx < hostApiCnt; idx++ {
+		hi, err := portaudio.GetHostApiInfo(idx)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			continue
+		}
+		hostApiNames[idx] = hi.Name
+		fmt.Printf("[%d] %s, devices: %d, default input: %d, default output: %d\n",
+			idx, hi.Name, hi.DeviceCount, hi.DefaultInputDevice, hi.DefaultOutputDevice)
+	}
+
+	defaultOutput, err := audiosink.DefaultOutputDevice()
+	if err != nil {
+		defaultOutput = -1
+	}
+
+	devCnt, err := portaudio.GetDeviceCount()
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Devices (count: %d)\n", devCnt)
+	for devIdx := 0; devIdx < devCnt; devIdx++ {
+		di, err := portaudio.GetDeviceInfo(devIdx)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			continue
+		}
+
+		mark := " "
+		if devIdx == defaultOutput {
+			mark = "*"
+		}
+		fmt.Printf("%s[%d] %s, host api: %s, in: %d, out: %d, default rate: %.0f\n",
+			mark, devIdx, di.Name, hostApiNames[di.HostApiIndex],
+			di.MaxInputChannels, di.MaxOutputChannels, di.DefaultSampleRate)
+	}
+}
@@ -4,16 +4,21 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"log"
 	"math"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/youpy/go-wav"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
 )
 
 type scoreNote struct {
@@ -37,8 +42,9 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(doremiCmd)
 
-	doremiCmd.Flags().String("out", "doremi.wav", "output wav file")
+	doremiCmd.Flags().String("out", "doremi.wav", "output file")
 	doremiCmd.Flags().String("score", "", "score data in csv format")
+	doremiCmd.Flags().String("format", "wav", "output format: wav, flac")
 }
 
 func doDoremiCmd(cmd *cobra.Command, args []string) {
@@ -48,6 +54,14 @@ func doDoremiCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
+	outFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if !cmd.Flags().Changed("out") {
+		outFileName = filenameWithoutExtension(outFileName) + "." + outFormat
+	}
 
 	scoreFileName, err := cmd.Flags().GetString("score")
 	if err != nil {
@@ -55,11 +69,11 @@ func doDoremiCmd(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	const sampleRate = 44100
-	const outNumChannels = 2
-	const bitsPerSample = 16
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
 
-	ampl := 0.7
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
 	if scoreFileName != "" {
 		if _, err := os.Stat(scoreFileName); os.IsNotExist(err) {
@@ -95,32 +109,12 @@ func doDoremiCmd(cmd *cobra.Command, args []string) {
 			}
 			dur := time.Duration(durVal) * time.Millisecond
 			score = append(score, scoreNote{note: note, dur: dur})
+		}
 
-			audio := make([]byte, 0)
-			nSamples := 0
-
-			for _, sc := range score {
-				freq := noteToFrequency(sc.note)
-
-				n1, a1 := generateTone(sc.dur, sampleRate, float32(freq),
-					sampleADSRAmpl(ampl, sampleRate, sc.dur))
-				nSamples += n1
-				audio = append(audio, a1...)
-			}
-
-			fOut2, err := os.OpenFile(outFileName, os.O_WRONLY|os.O_CREATE, 0600)
-			if err != nil {
-				panic(err)
-			}
-			defer fOut2.Close()
-
-			wavWriter2 := wav.NewWriter(fOut2,
-				uint32(nSamples),
-				uint16(outNumChannels),
-				uint32(sampleRate),
-				uint16(bitsPerSample))
-
-			wavWriter2.Write(audio)
+		err = renderScore(ctx, outFileName, outFormat, score)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			return
 		}
 	} else {
 
@@ -133,33 +127,18 @@ func doDoremiCmd(cmd *cobra.Command, args []string) {
 			"C8", "D8", "E8", "F8", "G8", "A8", "B8",
 		}
 
-		nSamples := 0
-		audio := make([]byte, 0)
-
 		dur := 800 * time.Millisecond
 
+		score := make([]scoreNote, 0, len(doremi))
 		for _, note := range doremi {
-			freq := noteToFrequency(note)
-
-			n1, a1 := generateTone(dur, sampleRate, float32(freq),
-				sampleADSRAmpl(ampl, sampleRate, dur))
-			nSamples += n1
-			audio = append(audio, a1...)
+			score = append(score, scoreNote{note: note, dur: dur})
 		}
 
-		fOut, err := os.OpenFile(outFileName, os.O_WRONLY|os.O_CREATE, 0600)
+		err = renderScore(ctx, outFileName, outFormat, score)
 		if err != nil {
-			panic(err)
+			fmt.Printf("ERR: %v\n", err)
+			return
 		}
-		defer fOut.Close()
-
-		wavWriter := wav.NewWriter(fOut,
-			uint32(nSamples),
-			uint16(outNumChannels),
-			uint32(sampleRate),
-			uint16(bitsPerSample))
-
-		wavWriter.Write(audio)
 
 		// BPM - 48
 		// 48 beats per minute
@@ -170,7 +149,7 @@ func doDoremiCmd(cmd *cobra.Command, args []string) {
 
 		const quarteNoteDur = 682 * time.Millisecond
 
-		score := []scoreNote{
+		score = []scoreNote{
 			{"G4", quarteNoteDur / 2},
 			{"G4", quarteNoteDur / 2},
 			{"G4", quarteNoteDur / 2},
@@ -181,33 +160,74 @@ func doDoremiCmd(cmd *cobra.Command, args []string) {
 			{"D4", quarteNoteDur * 2},
 		}
 
-		audio = make([]byte, 0)
-		nSamples = 0
+		err = renderScore(ctx, "b5test."+outFormat, outFormat, score)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			return
+		}
+	}
+}
+
+// restNote is score note with silence for its duration
+const restNote = "R"
+
+// renderScore generates tones for score notes and streams them into output file
+func renderScore(ctx context.Context, fileName string, outFormat string, score []scoreNote) error {
+	const sampleRate = 44100
+	const outNumChannels = 2
+	const bitsPerSample = 16
+
+	ampl := 0.7
+
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+
+	audioPktChan := make(chan audiosource.AudioSamplesPacket, 1)
+
+	sink, err := newFileSink(outFormat, fileName, audioPktChan, nil)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer close(audioPktChan)
+
+		audioFormat := types.FrameFormat{
+			SampleRate:    sampleRate,
+			Channels:      outNumChannels,
+			BitsPerSample: bitsPerSample,
+		}
 
 		for _, sc := range score {
 			freq := noteToFrequency(sc.note)
+			amplFn := sampleADSRAmpl(ampl, sampleRate, sc.dur)
+			if sc.note == restNote {
+				amplFn = func(int) float64 { return 0 }
+			}
 
-			n1, a1 := generateTone(sc.dur, sampleRate, float32(freq),
-				sampleADSRAmpl(ampl, sampleRate, sc.dur))
-			nSamples += n1
-			audio = append(audio, a1...)
-		}
+			nSamples, audio := generateTone(sc.dur, sampleRate, float32(freq), amplFn)
 
-		outFileName = "b5test.wav"
-		fOut2, err := os.OpenFile(outFileName, os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer fOut2.Close()
+			pkt := audiosource.AudioSamplesPacket{
+				Format:       audioFormat,
+				Audio:        audio,
+				SamplesCount: nSamples,
+			}
 
-		wavWriter2 := wav.NewWriter(fOut2,
-			uint32(nSamples),
-			uint16(outNumChannels),
-			uint32(sampleRate),
-			uint16(bitsPerSample))
+			select {
+			case audioPktChan <- pkt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-		wavWriter2.Write(audio)
+	err = sink.Play(ctx)
+	if err != nil {
+		sink.Close(ctx)
+		return err
 	}
+
+	return sink.Close(ctx)
 }
 
 func sampleADSRAmpl(ampl float64, sampleRate int, dur time.Duration) func(currentframe int) float64 {
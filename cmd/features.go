@@ -0,0 +1,208 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+)
+
+// featuresCmd represents the features command
+var featuresCmd = &cobra.Command{
+	Use:   "features",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doFeaturesCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(featuresCmd)
+
+	featuresCmd.Flags().String("file", "", "file to analyze, - to read stdin")
+	featuresCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	featuresCmd.Flags().String("out", "", "output csv file (default <file>.features.csv)")
+	featuresCmd.Flags().String("type", "mfcc", "features: mfcc, logmel")
+	featuresCmd.Flags().Int("mels", 40, "number of mel filters")
+	featuresCmd.Flags().Int("mfcc", 13, "number of mfcc coefficients")
+	featuresCmd.Flags().String("mel-scale", "slaney", "mel scale: htk, slaney")
+	featuresCmd.Flags().Float64("fmin", 0, "lowest filter frequency")
+	featuresCmd.Flags().Float64("fmax", 0, "highest filter frequency (0 - half of sample rate)")
+	featuresCmd.Flags().Bool("deltas", false, "append delta and delta-delta features")
+}
+
+func doFeaturesCmd(cmd *cobra.Command, args []string) {
+	inFileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	outFileName, err := cmd.Flags().GetString("out")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if outFileName == "" {
+		outFileName = outputBaseName(inFileName) + ".features.csv"
+	}
+
+	featuresType, err := cmd.Flags().GetString("type")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if featuresType != "mfcc" && featuresType != "logmel" {
+		fmt.Printf("ERR: unknown features type: %s\n", featuresType)
+		return
+	}
+
+	numMels, err := cmd.Flags().GetInt("mels")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	numCoeffs, err := cmd.Flags().GetInt("mfcc")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	melScaleStr, err := cmd.Flags().GetString("mel-scale")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	melScale, err := dsp.ParseMelScale(melScaleStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	minFreq, err := cmd.Flags().GetFloat64("fmin")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	maxFreq, err := cmd.Flags().GetFloat64("fmax")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	withDeltas, err := cmd.Flags().GetBool("deltas")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	ctx := context.Background()
+	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName, inFormatOpt)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Features: %s\n", inFileName)
+	fmt.Printf("Sample Rate: %d\n", audioData.SampleRate)
+
+	sampleRate := audioData.SampleRate
+
+	frameShift := int(float64(sampleRate) / 100.0) // 0.01 sec
+	frameLen := 2048
+
+	if len(audioData.Audio) < frameLen {
+		fmt.Printf("ERR: audio is shorter than %d samples\n", frameLen)
+		return
+	}
+
+	stft := dsp.New(frameShift, frameLen)
+	amp := stft.Magnitude(audioData.Audio)
+
+	fb := dsp.NewMelFilterbank(sampleRate, frameLen, numMels, minFreq, maxFreq, melScale)
+	features := dsp.LogMelSpectrogram(fb.MelSpectrogram(amp))
+	featureName := "mel"
+	if featuresType == "mfcc" {
+		features = dsp.MFCC(features, numCoeffs)
+		featureName = "mfcc"
+	}
+
+	header := []string{"time"}
+	for c := range features[0] {
+		header = append(header, fmt.Sprintf("%s_%d", featureName, c))
+	}
+
+	if withDeltas {
+		deltas := dsp.Deltas(features, 2)
+		deltas2 := dsp.Deltas(deltas, 2)
+
+		numFeatures := len(features[0])
+		for c := range numFeatures {
+			header = append(header, fmt.Sprintf("d_%s_%d", featureName, c))
+		}
+		for c := range numFeatures {
+			header = append(header, fmt.Sprintf("dd_%s_%d", featureName, c))
+		}
+
+		for i := range features {
+			row := append([]float64{}, features[i]...)
+			row = append(row, deltas[i]...)
+			features[i] = append(row, deltas2[i]...)
+		}
+	}
+
+	f, err := os.Create(outFileName)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(header)
+
+	for frameIdx, frame := range features {
+		// frame start time
+		ts := float64(frameIdx*frameShift) / float64(sampleRate)
+
+		record := make([]string, 0, len(frame)+1)
+		record = append(record, strconv.FormatFloat(ts, 'f', 3, 64))
+		for _, v := range frame {
+			record = append(record, strconv.FormatFloat(v, 'f', 4, 64))
+		}
+		w.Write(record)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fmt.Printf("frames: %d, features: %d\n", len(features), len(header)-1)
+	fmt.Printf("File %s created\n", outFileName)
+}
@@ -14,6 +14,7 @@ import (
 	"slices"
 
 	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
 
 	"github.com/fale/sit"
 	"github.com/spf13/cobra"
@@ -42,7 +43,10 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(fftCmd)
 
-	fftCmd.Flags().String("file", "", "file to analyze")
+	fftCmd.Flags().String("file", "", "file to analyze, - to read stdin")
+	fftCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	// window length 0 is FFT of the whole file
+	addSTFTFlags(fftCmd, "rectangular", 0, "amplitude")
 }
 
 func doFftCmd(cmd *cobra.Command, args []string) {
@@ -51,13 +55,20 @@ func doFftCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
-	if _, err := os.Stat(inFileName); os.IsNotExist(err) {
-		fmt.Printf("path [%s] does not exist\n", inFileName)
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
 		return
 	}
 
 	ctx := context.Background()
-	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName)
+	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName, inFormatOpt)
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
 		return
@@ -70,26 +81,36 @@ func doFftCmd(cmd *cobra.Command, args []string) {
 	audioSamples := audioData.Audio
 	sampleRate := audioData.SampleRate
 
+	winLen, err := cmd.Flags().GetInt("win-len")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
 	nSamples := len(audioSamples)
 	//nSamples := 44100 * 4
 	//audioSamples = audioSamples[:nSamples]
 
-	// Initialize an FFT and perform the analysis.
-	fft := fourier.NewFFT(nSamples)
-	coeff := fft.Coefficients(nil, audioSamples)
-
-	spectr := make([]float64, 0)
+	var spectr []float64
+	var scaledSpectr []float64
+	var scale dsp.SpectrumScale
+	var nfft int
+	if winLen == 0 {
+		spectr, scaledSpectr, nfft, scale, err = fileSpectrum(cmd, audioSamples, sampleRate)
+	} else {
+		spectr, scaledSpectr, nfft, scale, err = averageSpectrum(cmd, audioSamples, sampleRate)
+	}
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
 
 	var maxFreq, magnitude, mean float64
-	for i, c := range coeff {
-		m := cmplx.Abs(c)
-		spectr = append(spectr, m)
+	for i, m := range spectr {
 		mean += m
 		if m > magnitude {
 			magnitude = m
-			//maxFreq = fft.Freq(i) * float64(sampleRate) / float64(nSamples)
-			//maxFreq = float64(i) * float64(sampleRate) / float64(nSamples)
-			maxFreq = fft.Freq(i) * float64(sampleRate)
+			maxFreq = float64(i) * float64(sampleRate) / float64(nfft)
 		}
 	}
 	fmt.Printf("freq=%v Hz, magnitude=%.0f, mean=%.4f\n",
@@ -101,9 +122,9 @@ func doFftCmd(cmd *cobra.Command, args []string) {
 	}
 
 	pts := make(plotter.XYs, 0)
-	for i, m := range spectr {
+	for i, m := range scaledSpectr {
 		//fq := fft.Freq(i) * float64(sampleRate)
-		fq := float64(i) * float64(sampleRate) / (2 * float64(len(spectr)))
+		fq := float64(i) * float64(sampleRate) / float64(nfft)
 
 		if fq < 200.0 || fq > 600.0 {
 			continue
@@ -119,8 +140,8 @@ func doFftCmd(cmd *cobra.Command, args []string) {
 	p := plot.New()
 
 	p.Title.Text = "FFT example"
-	p.X.Label.Text = "X"
-	p.Y.Label.Text = "Y"
+	p.X.Label.Text = "Hz"
+	p.Y.Label.Text = scale.String()
 
 	err = plotutil.AddLinePoints(p,
 		"FFT", pts,
@@ -249,6 +270,93 @@ func doFftCmd(cmd *cobra.Command, args []string) {
 	fmt.Printf("hash: %d\n", h)
 }
 
+// fileSpectrum returns amplitude spectrum of the whole signal windowed and
+// zero-padded to --nfft, the spectrum in --scale, FFT size and the scale
+func fileSpectrum(cmd *cobra.Command, signal []float64, sampleRate int) ([]float64, []float64, int, dsp.SpectrumScale, error) {
+	windowName, err := cmd.Flags().GetString("window")
+	if err != nil {
+		return nil, nil, 0, dsp.ScaleAmplitude, err
+	}
+	windowFn, err := dsp.ParseWindow(windowName)
+	if err != nil {
+		return nil, nil, 0, dsp.ScaleAmplitude, err
+	}
+	nfft, err := cmd.Flags().GetInt("nfft")
+	if err != nil {
+		return nil, nil, 0, dsp.ScaleAmplitude, err
+	}
+	scaleName, err := cmd.Flags().GetString("scale")
+	if err != nil {
+		return nil, nil, 0, dsp.ScaleAmplitude, err
+	}
+	scale, err := dsp.ParseSpectrumScale(scaleName)
+	if err != nil {
+		return nil, nil, 0, dsp.ScaleAmplitude, err
+	}
+
+	if nfft == 0 {
+		nfft = len(signal)
+	}
+	if nfft < len(signal) {
+		return nil, nil, 0, dsp.ScaleAmplitude, fmt.Errorf("FFT size %d is less than %d file samples", nfft, len(signal))
+	}
+
+	win := make([]float64, len(signal))
+	for i := range win {
+		win[i] = 1
+	}
+	win = windowFn(win)
+
+	frame := make([]float64, nfft)
+	for i, v := range signal {
+		frame[i] = v * win[i]
+	}
+
+	// Initialize an FFT and perform the analysis.
+	fft := fourier.NewFFT(nfft)
+	coeff := fft.Coefficients(nil, frame)
+
+	spectr := make([]float64, len(coeff))
+	for i, c := range coeff {
+		spectr[i] = cmplx.Abs(c)
+	}
+
+	return spectr, dsp.ScaleSpectrum(spectr, win, sampleRate, scale), nfft, scale, nil
+}
+
+// averageSpectrum returns RMS of amplitude spectra of STFT frames configured
+// by flags (Welch method), the spectrum in --scale, FFT size and the scale
+func averageSpectrum(cmd *cobra.Command, signal []float64, sampleRate int) ([]float64, []float64, int, dsp.SpectrumScale, error) {
+	winLen, err := cmd.Flags().GetInt("win-len")
+	if err != nil {
+		return nil, nil, 0, dsp.ScaleAmplitude, err
+	}
+	// half overlapped frames
+	stft, scale, err := stftFromFlags(cmd, max(winLen/2, 1))
+	if err != nil {
+		return nil, nil, 0, dsp.ScaleAmplitude, err
+	}
+
+	amp := stft.Magnitude(signal)
+	if len(amp) == 0 {
+		return nil, nil, 0, dsp.ScaleAmplitude, fmt.Errorf("audio is shorter than %d samples", stft.FrameLen)
+	}
+
+	spectr := make([]float64, stft.NumBins())
+	for _, frame := range amp {
+		for k, a := range frame {
+			spectr[k] += a * a
+		}
+	}
+	for k := range spectr {
+		spectr[k] = math.Sqrt(spectr[k] / float64(len(amp)))
+	}
+
+	scaled := stft.ScaleSpectrogram([][]float64{spectr}, sampleRate, scale)
+
+	return spectr, scaled[0], stft.FFTLen(), scale, nil
+}
+
 func peaksHash(peaks []float64) uint64 {
 	h := uint64(0)
 	p := uint64(1)
@@ -0,0 +1,169 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+)
+
+// hpssCmd represents the hpss command
+var hpssCmd = &cobra.Command{
+	Use:   "hpss",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doHpssCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(hpssCmd)
+
+	hpssCmd.Flags().String("file", "", "file to separate, - to read stdin")
+	hpssCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	hpssCmd.Flags().String("out", "", "stems base name, <out>.harmonic.wav, <out>.percussive.wav, <out>.residual.wav (default input file name)")
+	hpssCmd.Flags().String("format", "wav", "output format: wav, flac")
+	hpssCmd.Flags().Int("win-len", 2048, "STFT window length, samples")
+	hpssCmd.Flags().Int("hop", 512, "STFT frame shift, samples")
+	hpssCmd.Flags().Int("harmonic-kernel", 17, "harmonic median filter length, frames")
+	hpssCmd.Flags().Int("percussive-kernel", 17, "percussive median filter length, bins")
+	hpssCmd.Flags().Float64("power", 2, "soft mask exponent")
+	hpssCmd.Flags().Float64("margin", 2, "separation margin, 1 - no residual stem")
+}
+
+func doHpssCmd(cmd *cobra.Command, args []string) {
+	inFileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	outBaseName, err := cmd.Flags().GetString("out")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if outBaseName == "" {
+		outBaseName = outputBaseName(inFileName)
+	}
+	outFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	winLen, err := cmd.Flags().GetInt("win-len")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	hop, err := cmd.Flags().GetInt("hop")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if winLen < 2 || hop < 1 || hop > winLen {
+		fmt.Printf("ERR: invalid window length %d or hop %d\n", winLen, hop)
+		return
+	}
+
+	hpss := dsp.NewHPSS()
+	hpss.HarmonicKernel, err = cmd.Flags().GetInt("harmonic-kernel")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	hpss.PercussiveKernel, err = cmd.Flags().GetInt("percussive-kernel")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	hpss.Power, err = cmd.Flags().GetFloat64("power")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	hpss.Margin, err = cmd.Flags().GetFloat64("margin")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if hpss.HarmonicKernel < 1 || hpss.PercussiveKernel < 1 || hpss.Power <= 0 || hpss.Margin < 1 {
+		fmt.Printf("ERR: invalid separation parameters\n")
+		return
+	}
+
+	ctx := context.Background()
+	audioData, err := audiosource.AudioChannelsFromFile(ctx, inFileName, inFormatOpt)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fmt.Printf("HPSS: %s\n", inFileName)
+	fmt.Printf("Channels: %d\n", len(audioData.Channels))
+	fmt.Printf("Sample Rate: %d\n", audioData.SampleRate)
+
+	stft := dsp.New(hop, winLen)
+
+	stems := []string{"harmonic", "percussive", "residual"}
+	if hpss.Margin == 1 {
+		// residual is silent
+		stems = stems[:2]
+	}
+
+	stemChannels := make([][][]float64, len(stems))
+	for i := range stemChannels {
+		stemChannels[i] = make([][]float64, len(audioData.Channels))
+	}
+	for ch, samples := range audioData.Channels {
+		parts := separateHPSS(stft, hpss, samples)
+		for i := range stemChannels {
+			stemChannels[i][ch] = parts[i]
+		}
+	}
+
+	songInfo := sourceSongInfo(inFileName)
+	for i, stem := range stems {
+		stemFileName := outBaseName + "." + stem + "." + outFormat
+		err = writeAudioFile(ctx, outFormat, stemFileName, audioData.SampleRate, stemChannels[i], songInfo)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			return
+		}
+		fmt.Printf("File %s created\n", stemFileName)
+	}
+}
+
+// separateHPSS returns harmonic, percussive and residual parts of samples
+// resynthesized by ISTFT, parts have length of samples
+func separateHPSS(stft *dsp.STFT, hpss *dsp.HPSS, samples []float64) [3][]float64 {
+	parts := resynthesizeMasked(stft, samples, func(amp [][]float64, from int, to int) [][][]float64 {
+		harmMask, percMask, residMask := hpss.Masks(amp)
+		return [][][]float64{harmMask, percMask, residMask}
+	})
+
+	return [3][]float64(parts)
+}
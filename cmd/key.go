@@ -0,0 +1,117 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+)
+
+// keyCmd represents the key command
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doKeyCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(keyCmd)
+
+	keyCmd.Flags().String("file", "", "file or folder to analyze, - to read stdin")
+	keyCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	keyCmd.Flags().String("profile", "krumhansl", "key profile: krumhansl, temperley")
+	keyCmd.Flags().Bool("harmonic", false, "use harmonic part of HPSS, drums are removed")
+}
+
+func doKeyCmd(cmd *cobra.Command, args []string) {
+	inFileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	profileStr, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	profile, err := dsp.ParseKeyProfile(profileStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	harmonicOnly, err := cmd.Flags().GetBool("harmonic")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fileNames, err := audioFilesInPath(inFileName)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	ctx := context.Background()
+
+	for _, fileName := range fileNames {
+		audioData, err := audiosource.AudioSamplesFromFile(ctx, fileName, inFormatOpt)
+		if err != nil {
+			fmt.Printf("ERR: %s: %v\n", fileName, err)
+			continue
+		}
+
+		const frameLen = 4096
+		if len(audioData.Audio) < frameLen {
+			fmt.Printf("ERR: %s: audio is shorter than %d samples\n", fileName, frameLen)
+			continue
+		}
+
+		stft := dsp.New(int(float64(audioData.SampleRate)/100.0), frameLen)
+		spectrogram := stft.Magnitude(audioData.Audio)
+		if harmonicOnly {
+			spectrogram = dsp.NewHPSS().Harmonic(spectrogram)
+		}
+
+		key := estimateKey(spectrogram, audioData.SampleRate, frameLen, profile)
+
+		fmt.Printf("%s: %s (%s), correlation: %.2f, confidence: %.2f\n",
+			fileName, key.String(), key.Camelot(), key.Correlation, key.Confidence)
+	}
+}
+
+// estimateKey returns the key of amplitude spectrogram of nfft points STFT,
+// chroma is corrected for the estimated tuning
+func estimateKey(spectrogram [][]float64, sampleRate int, nfft int, profile dsp.KeyProfile) dsp.Key {
+	chromaExtractor := dsp.NewChroma(sampleRate)
+	chromaExtractor.Tuning = dsp.EstimateTuning(spectrogram, sampleRate, nfft)
+
+	chroma := chromaExtractor.FromSpectrogram(spectrogram, nfft)
+
+	return dsp.EstimateKey(chroma, profile)
+}
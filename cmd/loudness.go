@@ -0,0 +1,152 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audioproc"
+	"github.com/drgolem/musiclab/audiosource"
+)
+
+// loudnessCmd represents the loudness command
+var loudnessCmd = &cobra.Command{
+	Use:   "loudness",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doLoudnessCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(loudnessCmd)
+
+	loudnessCmd.Flags().String("file", "", "file or folder to measure, - to read stdin")
+	loudnessCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	loudnessCmd.Flags().Float64("target", -14, "target integrated loudness, LUFS")
+	loudnessCmd.Flags().Float64("tolerance", 1, "allowed deviation from target loudness, LU")
+	loudnessCmd.Flags().Float64("max-true-peak", -1, "maximal true peak, dBTP")
+}
+
+func doLoudnessCmd(cmd *cobra.Command, args []string) {
+	inFileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	target, err := cmd.Flags().GetFloat64("target")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	tolerance, err := cmd.Flags().GetFloat64("tolerance")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	maxTruePeak, err := cmd.Flags().GetFloat64("max-true-peak")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fileNames, err := audioFilesInPath(inFileName)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	failed := 0
+	for _, fileName := range fileNames {
+		meter, err := measureLoudness(ctx, fileName, inFormatOpt)
+		if err != nil {
+			fmt.Printf("ERR: %s: %v\n", fileName, err)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		integrated := meter.Integrated()
+		truePeak := meter.TruePeak()
+
+		fmt.Printf("%s\n", fileName)
+		fmt.Printf("  Duration:       %v\n", meter.Duration())
+		fmt.Printf("  Integrated:     %.1f LUFS\n", integrated)
+		fmt.Printf("  Loudness range: %.1f LU\n", meter.LoudnessRange())
+		fmt.Printf("  Max momentary:  %.1f LUFS\n", meter.MaxMomentary())
+		fmt.Printf("  Max short-term: %.1f LUFS\n", meter.MaxShortTerm())
+		fmt.Printf("  True peak:      %.1f dBTP\n", truePeak)
+		fmt.Printf("  Sample peak:    %.1f dBFS\n", meter.SamplePeak())
+
+		status := "OK"
+		if integrated > target+tolerance || integrated < target-tolerance {
+			status = fmt.Sprintf("FAIL loudness %+.1f LU from %.1f LUFS", integrated-target, target)
+		}
+		if truePeak > maxTruePeak {
+			if status == "OK" {
+				status = "FAIL"
+			}
+			status += fmt.Sprintf(" true peak %.1f dBTP above %.1f dBTP", truePeak, maxTruePeak)
+		}
+		if status != "OK" {
+			failed++
+		}
+		fmt.Printf("  Spec:           %s\n", status)
+	}
+
+	if len(fileNames) > 1 {
+		fmt.Printf("files: %d, failed spec: %d\n", len(fileNames), failed)
+	}
+}
+
+// measureLoudness streams audio file through loudness meter
+func measureLoudness(ctx context.Context, fileName string, opts ...audiosource.SetOptionsFn) (*audioproc.LoudnessMeter, error) {
+	const framesPerBuffer = 4096
+
+	opts = append([]audiosource.SetOptionsFn{audiosource.WithFramesPerBuffer(framesPerBuffer)}, opts...)
+	audioStream, err := audiosource.NewMusicAudioProducer(ctx, fileName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer audioStream.Close()
+
+	meter := audioproc.NewLoudnessMeter()
+	for pkt := range audioStream.Stream() {
+		err = meter.Add(pkt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return meter, nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+// stdoutFileName is an output file name to write audio to stdout
+const stdoutFileName = "-"
+
+// messageOutput returns writer of command messages, stdout is kept for audio
+// data when it is the output file
+func messageOutput(outFileName string) io.Writer {
+	if outFileName == stdoutFileName {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// inputFormatOption returns producer option with raw PCM format of stdin
+// input, empty --pcm-format flag means input must have wav header
+func inputFormatOption(cmd *cobra.Command) (audiosource.SetOptionsFn, error) {
+	pcmFormat, err := cmd.Flags().GetString("pcm-format")
+	if err != nil {
+		return nil, err
+	}
+
+	var inFormat types.FrameFormat
+	if pcmFormat != "" {
+		inFormat, err = types.ParseFrameFormat(pcmFormat)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return audiosource.WithInputFormat(inFormat), nil
+}
+
+// outputBaseName returns base name for files created for the input file
+func outputBaseName(inFileName string) string {
+	if inFileName == audiosource.StdinFileName {
+		return "stdin"
+	}
+	return filenameWithoutExtension(inFileName)
+}
@@ -0,0 +1,225 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+)
+
+// pitchCmd represents the pitch command
+var pitchCmd = &cobra.Command{
+	Use:   "pitch",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doPitchCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(pitchCmd)
+
+	pitchCmd.Flags().String("file", "", "file to analyze, - to read stdin")
+	pitchCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	pitchCmd.Flags().String("out", "", "output notes csv file in doremi score format (default <file>.notes.csv)")
+	pitchCmd.Flags().String("contour", "", "output f0 contour csv file (default <file>.f0.csv)")
+	pitchCmd.Flags().String("method", "pyin", "pitch tracking method: pyin, yin")
+	pitchCmd.Flags().Float64("fmin", 65, "lowest f0 frequency")
+	pitchCmd.Flags().Float64("fmax", 1000, "highest f0 frequency")
+	pitchCmd.Flags().Float64("threshold", 0.1, "yin aperiodicity threshold")
+	pitchCmd.Flags().Int("min-note", 60, "minimal note duration, msec")
+}
+
+func doPitchCmd(cmd *cobra.Command, args []string) {
+	inFileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	outFileName, err := cmd.Flags().GetString("out")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if outFileName == "" {
+		outFileName = outputBaseName(inFileName) + ".notes.csv"
+	}
+	contourFileName, err := cmd.Flags().GetString("contour")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if contourFileName == "" {
+		contourFileName = outputBaseName(inFileName) + ".f0.csv"
+	}
+
+	method, err := cmd.Flags().GetString("method")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if method != "pyin" && method != "yin" {
+		fmt.Printf("ERR: unknown pitch tracking method: %s\n", method)
+		return
+	}
+
+	minFreq, err := cmd.Flags().GetFloat64("fmin")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	maxFreq, err := cmd.Flags().GetFloat64("fmax")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if minFreq <= 0 || maxFreq <= minFreq {
+		fmt.Printf("ERR: invalid f0 range: %.1f - %.1f\n", minFreq, maxFreq)
+		return
+	}
+
+	threshold, err := cmd.Flags().GetFloat64("threshold")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	minNoteMs, err := cmd.Flags().GetInt("min-note")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	ctx := context.Background()
+	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName, inFormatOpt)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Pitch: %s\n", inFileName)
+	fmt.Printf("Sample Rate: %d\n", audioData.SampleRate)
+
+	sampleRate := audioData.SampleRate
+
+	tracker := dsp.NewPitchTracker(sampleRate, minFreq, maxFreq)
+	tracker.Threshold = threshold
+
+	if tracker.NumFrames(audioData.Audio) == 0 {
+		fmt.Printf("ERR: audio is shorter than %d samples\n", tracker.FrameLen())
+		return
+	}
+
+	var frames []dsp.PitchFrame
+	if method == "yin" {
+		frames = tracker.YIN(audioData.Audio)
+	} else {
+		frames = tracker.PYIN(audioData.Audio)
+	}
+
+	frameDur := float64(tracker.FrameShift) / float64(sampleRate)
+	notes := dsp.SegmentNotes(frames, frameDur, float64(minNoteMs)/1000)
+
+	err = writePitchContour(contourFileName, frames)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	fmt.Printf("File %s created\n", contourFileName)
+
+	err = writePitchNotes(outFileName, notes)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fmt.Printf("frames: %d, notes: %d\n", len(frames), len(notes))
+	fmt.Printf("File %s created\n", outFileName)
+}
+
+// writePitchContour writes f0 per frame, f0 is 0 for unvoiced frames
+func writePitchContour(fileName string, frames []dsp.PitchFrame) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"time", "f0", "voiced", "probability"})
+
+	for _, frame := range frames {
+		w.Write([]string{
+			strconv.FormatFloat(frame.Time, 'f', 3, 64),
+			strconv.FormatFloat(frame.Freq, 'f', 2, 64),
+			strconv.FormatBool(frame.Voiced),
+			strconv.FormatFloat(frame.Probability, 'f', 3, 64),
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// writePitchNotes writes notes in doremi score format (note, duration in
+// msec), onset and cents deviation follow as extra columns. Gaps between notes
+// are written as rest rows.
+func writePitchNotes(fileName string, notes []dsp.PitchNote) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"note", "dur", "onset", "cents"})
+
+	pos := 0
+	for _, note := range notes {
+		onset := int(note.Onset * 1000)
+		if onset > pos {
+			w.Write([]string{
+				restNote,
+				strconv.Itoa(onset - pos),
+				strconv.Itoa(pos),
+				"",
+			})
+		}
+		pos = onset + int(note.Duration*1000)
+
+		w.Write([]string{
+			dsp.MidiNoteName(note.Midi),
+			strconv.Itoa(int(note.Duration * 1000)),
+			strconv.Itoa(onset),
+			strconv.FormatFloat(note.Cents, 'f', 1, 64),
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
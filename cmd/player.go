@@ -4,16 +4,21 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/drgolem/go-portaudio/portaudio"
+	"github.com/drgolem/musiclab/audioproc"
 	"github.com/drgolem/musiclab/audiosink"
 	"github.com/drgolem/musiclab/audiosource"
 )
@@ -34,9 +39,24 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(playerCmd)
 
-	playerCmd.Flags().String("file", "", "file to play")
+	playerCmd.Flags().String("file", "", "file to play, - to read stdin")
+	playerCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
 	playerCmd.Flags().String("start", "0", "start play at specified time")
 	playerCmd.Flags().String("duration", "0", "duration of play (0 - play all)")
+	playerCmd.Flags().String("device", "", "output device index or name (default output device if empty)")
+	playerCmd.Flags().Bool("callback", false, "use callback mode output with jitter buffer")
+	playerCmd.Flags().String("latency", "0", "suggested output latency in callback mode (0 - device default)")
+	playerCmd.Flags().String("prebuffer", "100ms", "audio buffered before playback starts in callback mode")
+	playerCmd.Flags().String("buffer", "500ms", "jitter buffer size in callback mode")
+	playerCmd.Flags().String("volume", "1.0", "volume, linear (0.5) or in dB (-6dB)")
+	playerCmd.Flags().Float64("pan", 0, "stereo balance, -1 (left) .. 1 (right)")
+	playerCmd.Flags().Bool("mute", false, "start muted")
+	playerCmd.Flags().Float64("tempo", 1.0, "practice speed keeping pitch, 0.5 - half speed")
+	playerCmd.Flags().Float64("semitones", 0, "pitch shift keeping tempo, semitones")
+	playerCmd.Flags().String("record", "", "record played audio to wav or flac file")
+	playerCmd.Flags().String("playlist", "", "playlist file to play instead of a single file")
+	playerCmd.Flags().String("crossfade", "0", "crossfade between playlist tracks (0 - gapless)")
+	playerCmd.Flags().String("crossfade-curve", "equal-power", "crossfade curve: linear, equal-power")
 }
 
 func doPlayerCmd(cmd *cobra.Command, args []string) {
@@ -45,8 +65,23 @@ func doPlayerCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		fmt.Printf("path [%s] does not exist\n", fileName)
+	playlist, err := cmd.Flags().GetString("playlist")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if playlist != "" {
+		fileName = playlist
+	}
+	if fileName != audiosource.StdinFileName {
+		if _, err := os.Stat(fileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", fileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
 		return
 	}
 
@@ -72,8 +107,129 @@ func doPlayerCmd(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if playlist != "" && (start != 0 || dur != 0) {
+		fmt.Printf("ERR: --start and --duration are not supported with --playlist\n")
+		return
+	}
+
+	device, err := cmd.Flags().GetString("device")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	callbackMode, err := cmd.Flags().GetBool("callback")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	latencyStr, err := cmd.Flags().GetString("latency")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	latency, err := time.ParseDuration(latencyStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	prebufferStr, err := cmd.Flags().GetString("prebuffer")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	prebuffer, err := time.ParseDuration(prebufferStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	bufferDurStr, err := cmd.Flags().GetString("buffer")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	bufferDur, err := time.ParseDuration(bufferDurStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	volumeStr, err := cmd.Flags().GetString("volume")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	volume, err := audioproc.ParseVolume(volumeStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	pan, err := cmd.Flags().GetFloat64("pan")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	mute, err := cmd.Flags().GetBool("mute")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	tempo, err := cmd.Flags().GetFloat64("tempo")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	semitones, err := cmd.Flags().GetFloat64("semitones")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	recordFile, err := cmd.Flags().GetString("record")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	crossfadeStr, err := cmd.Flags().GetString("crossfade")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	crossfade, err := time.ParseDuration(crossfadeStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	crossfadeCurveStr, err := cmd.Flags().GetString("crossfade-curve")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	crossfadeCurve, err := audioproc.ParseCrossfadeCurve(crossfadeCurveStr)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	gain := audioproc.NewGainStage()
+	gain.SetVolume(volume)
+	gain.SetPan(pan)
+	gain.SetMute(mute)
+
+	timePitch := audioproc.NewTimePitchStage()
+	timePitch.SetTempo(tempo)
+	timePitch.SetSemitones(semitones)
+
 	fmt.Printf("Playing: %s\n", fileName)
 	fmt.Printf("Press Ctrl-C to stop.\n")
+	if fileName != audiosource.StdinFileName {
+		fmt.Printf("Volume control: + / - (3dB), m (mute), v <volume>, p <pan>, then Enter\n")
+		fmt.Printf("Practice control: t <tempo>, s <semitones>, then Enter\n")
+	}
 
 	ctx, cancelFn := context.WithCancel(context.Background())
 	defer cancelFn()
@@ -83,10 +239,25 @@ func doPlayerCmd(cmd *cobra.Command, args []string) {
 
 	const framesPerBuffer = 2048
 
-	audioStream, err := audiosource.NewMusicAudioProducer(ctx, fileName,
-		audiosource.WithFramesPerBuffer(framesPerBuffer),
-		audiosource.WithPlayStartPos(start),
-		audiosource.WithPlayDuration(dur))
+	var audioStream audiosource.AudioStream
+	if playlist != "" {
+		var files []string
+		files, err = readPlaylist(playlist)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			return
+		}
+		audioStream, err = audioproc.NewCrossfadeStream(ctx, files,
+			audioproc.WithFramesPerBuffer(framesPerBuffer),
+			audioproc.WithCrossfadeDuration(crossfade),
+			audioproc.WithCrossfadeCurve(crossfadeCurve))
+	} else {
+		audioStream, err = audiosource.NewMusicAudioProducer(ctx, fileName,
+			audiosource.WithFramesPerBuffer(framesPerBuffer),
+			audiosource.WithPlayStartPos(start),
+			audiosource.WithPlayDuration(dur),
+			inFormatOpt)
+	}
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
 		return
@@ -101,13 +272,44 @@ func doPlayerCmd(cmd *cobra.Command, args []string) {
 	fmt.Printf("Encoding: Signed 16bit\n")
 	fmt.Printf("Sample Rate: %d\n", audioFormat.SampleRate)
 	fmt.Printf("Channels: %d\n", audioFormat.Channels)
-	deviceIdx := 1
 
 	portaudio.Initialize()
 	defer portaudio.Terminate()
 
-	sink, err := audiosink.NewPortAudioSink(deviceIdx,
-		framesPerBuffer, audioStream.Stream())
+	audioPktChan := gain.Process(ctx, timePitch.Process(ctx, audioStream.Stream()))
+
+	newDeviceSink := func(audioPktChan <-chan audiosource.AudioSamplesPacket) (audiosink.AudioSink, error) {
+		if callbackMode {
+			return audiosink.NewPortAudioCallbackSink(device,
+				framesPerBuffer, audioPktChan,
+				audiosink.WithLatency(latency),
+				audiosink.WithPrebuffer(prebuffer),
+				audiosink.WithBufferDuration(bufferDur))
+		}
+		return audiosink.NewPortAudioSink(device,
+			framesPerBuffer, audioPktChan)
+	}
+
+	var sink audiosink.AudioSink
+	if recordFile != "" {
+		// playback paces the stream, recording gets a queue so slow disk
+		// does not interrupt playback
+		recordFormat := strings.ToLower(strings.TrimPrefix(filepath.Ext(recordFile), "."))
+		sink, err = audiosink.NewTeeSink(audioPktChan,
+			audiosink.TeeBranch{
+				Policy:  audiosink.TeeBlock,
+				NewSink: newDeviceSink,
+			},
+			audiosink.TeeBranch{
+				Policy:     audiosink.TeeBuffer,
+				BufferSize: 256,
+				NewSink: func(audioPktChan <-chan audiosource.AudioSamplesPacket) (audiosink.AudioSink, error) {
+					return newFileSink(recordFormat, recordFile, audioPktChan, sourceSongInfo(fileName))
+				},
+			})
+	} else {
+		sink, err = newDeviceSink(audioPktChan)
+	}
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
 		return
@@ -136,10 +338,75 @@ func doPlayerCmd(cmd *cobra.Command, args []string) {
 			case <-ticker.C:
 				stat := audioStream.Status()
 				fmt.Printf("STATUS: %v\n", stat)
+				if sr, ok := sink.(audiosink.StatusReporter); ok {
+					fmt.Printf("SINK: %v\n", sr.Status())
+				}
 			}
 		}
 	}(ctx)
 
+	// stdin is busy with audio data when playing from pipe
+	if fileName != audiosource.StdinFileName {
+		go playerVolumeControl(ctx, gain, timePitch)
+	}
+
 	<-ctx.Done()
 	fmt.Printf("done\n")
 }
+
+// playerVolumeControl reads volume, tempo and pitch commands from stdin
+func playerVolumeControl(ctx context.Context, gain *audioproc.GainStage, timePitch *audioproc.TimePitchStage) {
+	const volumeStepDb = 3.0
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		switch cmd {
+		case "+":
+			gain.SetVolumeDb(gain.VolumeDb() + volumeStepDb)
+		case "-":
+			gain.SetVolumeDb(gain.VolumeDb() - volumeStepDb)
+		case "m":
+			gain.ToggleMute()
+		case "v":
+			volume, err := audioproc.ParseVolume(arg)
+			if err != nil {
+				fmt.Printf("ERR: %v\n", err)
+				continue
+			}
+			gain.SetVolume(volume)
+		case "p":
+			pan, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil {
+				fmt.Printf("ERR: %v\n", err)
+				continue
+			}
+			gain.SetPan(pan)
+		case "t":
+			tempo, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil {
+				fmt.Printf("ERR: %v\n", err)
+				continue
+			}
+			timePitch.SetTempo(tempo)
+			fmt.Printf("TEMPO: %v\n", timePitch.Status())
+			continue
+		case "s":
+			semitones, err := strconv.ParseFloat(strings.TrimSpace(arg), 64)
+			if err != nil {
+				fmt.Printf("ERR: %v\n", err)
+				continue
+			}
+			timePitch.SetSemitones(semitones)
+			fmt.Printf("TEMPO: %v\n", timePitch.Status())
+			continue
+		default:
+			continue
+		}
+		fmt.Printf("GAIN: %v\n", gain.Status())
+	}
+}
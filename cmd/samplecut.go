@@ -2,15 +2,19 @@ package cmd
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"math"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/drgolem/musiclab/audiosink"
 	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/scan"
+	"github.com/drgolem/musiclab/types"
 	"github.com/spf13/cobra"
-	"github.com/youpy/go-wav"
 )
 
 // fftCmd represents the spectrogram command
@@ -29,10 +33,12 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(samplecutCmd)
 
-	samplecutCmd.Flags().String("in", "", "file to cut")
-	samplecutCmd.Flags().String("out", "out_cut.wav", "output wav file")
+	samplecutCmd.Flags().String("in", "", "file to cut, - to read stdin")
+	samplecutCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	samplecutCmd.Flags().String("out", "out_cut.wav", "output file, - to write stdout")
 	samplecutCmd.Flags().String("start", "10s5ms", "start")
 	samplecutCmd.Flags().String("duration", "30s", "duration")
+	samplecutCmd.Flags().String("format", "wav", "output format: wav, flac, pcm (stdout only)")
 }
 
 func doSamplecutCmd(cmd *cobra.Command, args []string) {
@@ -41,8 +47,15 @@ func doSamplecutCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
-	if _, err := os.Stat(inFileName); os.IsNotExist(err) {
-		fmt.Printf("path [%s] does not exist\n", inFileName)
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
 		return
 	}
 	outFileName, err := cmd.Flags().GetString("out")
@@ -50,26 +63,35 @@ func doSamplecutCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
+	outFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if !cmd.Flags().Changed("out") {
+		outFileName = filenameWithoutExtension(outFileName) + "." + outFormat
+	}
+	msgOut := messageOutput(outFileName)
 
 	startStr, err := cmd.Flags().GetString("start")
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
 	start, err := time.ParseDuration(startStr)
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
 
 	durtStr, err := cmd.Flags().GetString("duration")
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
 	dur, err := time.ParseDuration(durtStr)
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
 
@@ -81,74 +103,188 @@ func doSamplecutCmd(cmd *cobra.Command, args []string) {
 
 	const framesPerBuffer = 2048
 
-	audioStream, err := audiosource.NewMusicAudioProducer(ctx, inFileName, audiosource.WithFramesPerBuffer(framesPerBuffer))
+	audioStream, err := audiosource.NewMusicAudioProducer(ctx, inFileName, audiosource.WithFramesPerBuffer(framesPerBuffer), audiosource.WithLogOutput(msgOut), inFormatOpt)
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
 	defer audioStream.Close()
 
 	audioFormat := audioStream.GetFormat()
 
-	fmt.Printf("Samplecut: %s\n", inFileName)
-	fmt.Printf("Channels: %d\n", audioFormat.Channels)
-	fmt.Printf("Input Sample Rate: %d\n", audioFormat.SampleRate)
+	fmt.Fprintf(msgOut, "Samplecut: %s\n", inFileName)
+	fmt.Fprintf(msgOut, "Channels: %d\n", audioFormat.Channels)
+	fmt.Fprintf(msgOut, "Input Sample Rate: %d\n", audioFormat.SampleRate)
 
 	outSamplesCnt := int(dur.Seconds() * float64(audioFormat.SampleRate))
 	startSamplesPos := int(start.Seconds() * float64(audioFormat.SampleRate))
 
-	fmt.Printf("in %s\n", inFileName)
-	fmt.Printf("out %s\n", outFileName)
-	fmt.Printf("[%v:%v]\n", start, dur)
+	fmt.Fprintf(msgOut, "in %s\n", inFileName)
+	fmt.Fprintf(msgOut, "out %s\n", outFileName)
+	fmt.Fprintf(msgOut, "[%v:%v]\n", start, dur)
 
-	fmt.Printf("out samples: %d\n", outSamplesCnt)
+	fmt.Fprintf(msgOut, "out samples: %d\n", outSamplesCnt)
 
 	// 1 sample - num channels * bits per sample
 	frameByteSize := audioFormat.Channels * audioFormat.BitsPerSample / 8
 
-	audioData := make([]byte, 0)
-	samplesCnt := 0
-	samplesPos := 0
-	for pct := range audioStream.Stream() {
+	audioPktChan := make(chan audiosource.AudioSamplesPacket, 1)
+
+	sink, err := newFileSink(outFormat, outFileName, audioPktChan, sourceSongInfo(inFileName))
+	if err != nil {
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+
+	go func() {
+		defer close(audioPktChan)
+
+		samplesCnt := 0
+		samplesPos := 0
+		for pct := range audioStream.Stream() {
+
+			if startSamplesPos >= samplesPos+pct.SamplesCount {
+				samplesPos += pct.SamplesCount
+				continue
+			}
+
+			pctStartPos := 0
+			if startSamplesPos > samplesPos {
+				pctStartPos = startSamplesPos - samplesPos
+			}
+			pctEndPos := min(pct.SamplesCount, pctStartPos+outSamplesCnt-samplesCnt)
 
-		if startSamplesPos > samplesPos+pct.SamplesCount {
 			samplesPos += pct.SamplesCount
-			continue
-		}
+			samplesCnt += pctEndPos - pctStartPos
 
-		pctStartPos := 0
-		pctSamplesCount := pct.SamplesCount
-		if startSamplesPos > samplesPos && startSamplesPos < samplesPos+pct.SamplesCount {
-			pctStartPos = startSamplesPos - samplesPos
-		}
+			outPkt := audiosource.AudioSamplesPacket{
+				Format:       pct.Format,
+				Audio:        pct.Audio[pctStartPos*frameByteSize : pctEndPos*frameByteSize],
+				SamplesCount: pctEndPos - pctStartPos,
+			}
 
-		if samplesCnt+pct.SamplesCount > outSamplesCnt {
-			pctSamplesCount = outSamplesCnt - samplesCnt
-		}
+			select {
+			case audioPktChan <- outPkt:
+			case <-ctx.Done():
+				return
+			}
 
-		samplesPos += pct.SamplesCount
-		samplesCnt += pct.SamplesCount
+			if samplesCnt >= outSamplesCnt {
+				break
+			}
+		}
+	}()
 
-		pctByteStart := pctStartPos * frameByteSize
-		pctByteEnd := pctSamplesCount * frameByteSize
-		audioData = append(audioData, pct.Audio[pctByteStart:pctByteEnd]...)
+	err = sink.Play(ctx)
+	if err != nil {
+		sink.Close(ctx)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+	// file is finalized on close
+	err = sink.Close(ctx)
+	if err != nil {
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+}
 
-		if samplesCnt >= outSamplesCnt {
-			break
+// newFileSink creates file sink for the output format
+func newFileSink(outFormat string,
+	fileName string,
+	audioPktChan <-chan audiosource.AudioSamplesPacket,
+	songInfo *types.SongInfo,
+) (audiosink.AudioSink, error) {
+	if fileName == stdoutFileName {
+		switch outFormat {
+		case "wav":
+			return audiosink.NewPipeSink(os.Stdout, true, audioPktChan)
+		case "pcm":
+			return audiosink.NewPipeSink(os.Stdout, false, audioPktChan)
 		}
+		return nil, fmt.Errorf("output format %s can not be written to stdout", outFormat)
+	}
+
+	switch outFormat {
+	case "wav":
+		return audiosink.NewWavFileSink(fileName, audioPktChan)
+	case "flac":
+		return audiosink.NewFlacFileSink(fileName, audioPktChan, songInfo)
 	}
+	return nil, fmt.Errorf("unsupported output format: %s", outFormat)
+}
+
+// sourceSongInfo reads tags of the input file, nil if not available
+func sourceSongInfo(fileName string) *types.SongInfo {
+	tagDecoder, err := scan.TagDecoderForFile(fileName)
+	if err != nil {
+		return nil
+	}
+	songInfo, err := tagDecoder.Decode(fileName)
+	if err != nil {
+		return nil
+	}
+	return songInfo
+}
 
-	fOut, err := os.OpenFile(outFileName, os.O_WRONLY|os.O_CREATE, 0600)
+// writeAudioFile writes samples of each channel (-1..1) as 16 bit audio file
+// of the output format, samples out of range are clipped
+func writeAudioFile(ctx context.Context, outFormat string, fileName string,
+	sampleRate int, channels [][]float64, songInfo *types.SongInfo,
+) error {
+	ctx, cancelFn := context.WithCancel(ctx)
+	defer cancelFn()
+
+	audioPktChan := make(chan audiosource.AudioSamplesPacket, 1)
+
+	sink, err := newFileSink(outFormat, fileName, audioPktChan, songInfo)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer fOut.Close()
 
-	wavWriter := wav.NewWriter(fOut,
-		uint32(outSamplesCnt),
-		uint16(audioFormat.Channels),
-		uint32(audioFormat.SampleRate),
-		uint16(audioFormat.BitsPerSample))
+	audioFormat := types.FrameFormat{
+		SampleRate:    sampleRate,
+		Channels:      len(channels),
+		BitsPerSample: 16,
+	}
+
+	go func() {
+		defer close(audioPktChan)
+
+		const framesPerBuffer = 2048
+
+		nSamples := len(channels[0])
+		for from := 0; from < nSamples; from += framesPerBuffer {
+			to := min(from+framesPerBuffer, nSamples)
+
+			audio := make([]byte, 0, (to-from)*len(channels)*2)
+			for i := from; i < to; i++ {
+				for _, samples := range channels {
+					v := math.Round(samples[i] * 0x7FFF)
+					v = min(max(v, math.MinInt16), math.MaxInt16)
+					audio = binary.LittleEndian.AppendUint16(audio, uint16(int16(v)))
+				}
+			}
+
+			pkt := audiosource.AudioSamplesPacket{
+				Format:       audioFormat,
+				Audio:        audio,
+				SamplesCount: to - from,
+			}
+
+			select {
+			case audioPktChan <- pkt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err = sink.Play(ctx)
+	if err != nil {
+		sink.Close(ctx)
+		return err
+	}
 
-	wavWriter.Write(audioData)
+	return sink.Close(ctx)
 }
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/httpstream"
+	"github.com/drgolem/musiclab/types"
+)
+
+// serveStreamCmd represents the serve-stream command
+var serveStreamCmd = &cobra.Command{
+	Use:   "serve-stream",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doServeStreamCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(serveStreamCmd)
+
+	serveStreamCmd.Flags().String("addr", ":8080", "http listen address")
+	serveStreamCmd.Flags().String("file", "", "file to stream")
+	serveStreamCmd.Flags().String("playlist", "", "playlist file, one music file per line")
+	serveStreamCmd.Flags().String("db", "", "database file to query songs")
+	serveStreamCmd.Flags().String("query", "", "stream database songs with path containing query")
+	serveStreamCmd.Flags().String("format", httpstream.FormatWav, "stream format: wav, pcm")
+	serveStreamCmd.Flags().Int("metaint", 16000, "audio bytes between icy metadata blocks")
+}
+
+func doServeStreamCmd(cmd *cobra.Command, args []string) {
+	addr, err := cmd.Flags().GetString("addr")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	fileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	playlist, err := cmd.Flags().GetString("playlist")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	musicDb, err := cmd.Flags().GetString("db")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	query, err := cmd.Flags().GetString("query")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	streamFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	metaInterval, err := cmd.Flags().GetInt("metaint")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	var files []string
+	switch {
+	case fileName != "":
+		files = []string{fileName}
+	case playlist != "":
+		files, err = readPlaylist(playlist)
+	case musicDb != "":
+		files, err = querySongs(musicDb, query)
+	default:
+		err = fmt.Errorf("one of --file, --playlist or --db is required")
+	}
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	tracks := make([]httpstream.Track, 0, len(files))
+	for _, f := range files {
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", f)
+			continue
+		}
+
+		songInfo := sourceSongInfo(f)
+		if songInfo == nil {
+			songInfo = &types.SongInfo{
+				Title:    filepath.Base(f),
+				FilePath: f,
+			}
+		}
+		fmt.Printf("%s\n", songInfo.String())
+
+		tracks = append(tracks, httpstream.FileTrack(f, songInfo))
+	}
+	if len(tracks) == 0 {
+		fmt.Printf("no tracks to stream\n")
+		return
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr: addr,
+		Handler: httpstream.NewStreamServer(tracks,
+			httpstream.WithFormat(streamFormat),
+			httpstream.WithMetaInterval(metaInterval)),
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Streaming %d tracks on %s\n", len(tracks), addr)
+	fmt.Printf("Press Ctrl-C to stop.\n")
+
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	fmt.Printf("done\n")
+}
+
+// readPlaylist reads music files from m3u like playlist, relative paths are
+// resolved against playlist folder
+func readPlaylist(playlist string) ([]string, error) {
+	f, err := os.Open(playlist)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir := filepath.Dir(playlist)
+
+	files := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		files = append(files, line)
+	}
+
+	return files, scanner.Err()
+}
+
+// querySongs returns songs stored in database with path containing query
+func querySongs(musicDb string, query string) ([]string, error) {
+	opts := badger.DefaultOptions(musicDb)
+	opts.Logger = nil
+	opts.ReadOnly = true
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query = strings.ToLower(query)
+
+	songs := make(map[uint64]string)
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("song")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			k := item.Key()
+			err := item.Value(func(v []byte) error {
+				song := string(v)
+				if strings.Contains(strings.ToLower(song), query) {
+					idx := binary.LittleEndian.Uint64(k[4:])
+					songs[idx] = song
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// keep scan order
+	idxs := make([]uint64, 0, len(songs))
+	for idx := range songs {
+		idxs = append(idxs, idx)
+	}
+	slices.Sort(idxs)
+
+	files := make([]string, 0, len(songs))
+	for _, idx := range idxs {
+		files = append(files, songs[idx])
+	}
+
+	return files, nil
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/drgolem/go-portaudio/portaudio"
+	"github.com/drgolem/musiclab/audiosink"
 )
 
 // sinewaveCmd represents the sinewave command
@@ -32,6 +33,8 @@ to quickly create a Cobra application.`,
 
 func init() {
 	rootCmd.AddCommand(sinewaveCmd)
+
+	sinewaveCmd.Flags().String("device", "", "output device index or name (default output device if empty)")
 }
 
 func doPlaySineCmd(cmd *cobra.Command, args []string) {
@@ -44,40 +47,19 @@ func doPlaySineCmd(cmd *cobra.Command, args []string) {
 	}
 	defer portaudio.Terminate()
 
-	devCnt, err := portaudio.GetDeviceCount()
+	device, err := cmd.Flags().GetString("device")
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
-	} else {
-		fmt.Printf("device count: %d\n", devCnt)
-	}
-
-	for devIdx := 0; devIdx < devCnt; devIdx++ {
-		di, err := portaudio.GetDeviceInfo(devIdx)
-		if err != nil {
-			fmt.Printf("ERR: %v\n", err)
-		} else {
-			fmt.Printf("[%d] device: %#v\n", devIdx, di)
-		}
+		return
 	}
-
-	hostApiCnt, err := portaudio.GetHostApiCount()
+	deviceIdx, err := audiosink.FindOutputDevice(device)
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
 
-	fmt.Printf("Host API Info (count: %d)\n", hostApiCnt)
-	for idx := 0; idx < hostApiCnt; idx++ {
-		hi, err := portaudio.GetHostApiInfo(idx)
-		if err != nil {
-			fmt.Printf("ERR: %v\n", err)
-		} else {
-			fmt.Printf("[%d] api info: %#v\n", idx, hi)
-		}
-	}
-
 	outStreamParams := portaudio.PaStreamParameters{
-		DeviceIndex:  1,
+		DeviceIndex:  deviceIdx,
 		ChannelCount: 2,
 		SampleFormat: portaudio.SampleFmtFloat32,
 		//SampleFormat: portaudio.SampleFmtInt24,
@@ -44,7 +44,107 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(spectrogramCmd)
 
-	spectrogramCmd.Flags().String("file", "", "file to analyze")
+	spectrogramCmd.Flags().String("file", "", "file to analyze, - to read stdin")
+	spectrogramCmd.Flags().Bool("cqt", false, "plot constant-Q transform")
+	spectrogramCmd.Flags().Float64("cqt-fmin", 32.70, "lowest CQT frequency (C1)")
+	spectrogramCmd.Flags().Int("cqt-bins", 36, "CQT bins per octave")
+	spectrogramCmd.Flags().Int("cqt-octaves", 7, "number of CQT octaves")
+	spectrogramCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	addSTFTFlags(spectrogramCmd, "hann", 2048, "amplitude")
+}
+
+// addSTFTFlags adds STFT analysis flags with command defaults of window,
+// window length and spectrum scale
+func addSTFTFlags(cmd *cobra.Command, windowName string, winLen int, scale string) {
+	cmd.Flags().String("window", windowName, "window: hann, hamming, blackman-harris, kaiser[:beta], flattop, rectangular")
+	cmd.Flags().Int("win-len", winLen, "window length, samples")
+	cmd.Flags().Int("nfft", 0, "FFT size, windowed frames are zero-padded to it (0 - window length)")
+	cmd.Flags().Int("hop", 0, "frame shift, samples (0 - command default)")
+	cmd.Flags().String("scale", scale, "spectrum scale: amplitude, power, db, psd")
+}
+
+// stftFromFlags returns STFT configured by addSTFTFlags flags and spectrum
+// scale, defaultHop is used when --hop is 0
+func stftFromFlags(cmd *cobra.Command, defaultHop int) (*dsp.STFT, dsp.SpectrumScale, error) {
+	windowName, err := cmd.Flags().GetString("window")
+	if err != nil {
+		return nil, dsp.ScaleAmplitude, err
+	}
+	windowFn, err := dsp.ParseWindow(windowName)
+	if err != nil {
+		return nil, dsp.ScaleAmplitude, err
+	}
+
+	winLen, err := cmd.Flags().GetInt("win-len")
+	if err != nil {
+		return nil, dsp.ScaleAmplitude, err
+	}
+	if winLen < 2 {
+		return nil, dsp.ScaleAmplitude, fmt.Errorf("invalid window length: %d", winLen)
+	}
+
+	nfft, err := cmd.Flags().GetInt("nfft")
+	if err != nil {
+		return nil, dsp.ScaleAmplitude, err
+	}
+	if nfft != 0 && nfft < winLen {
+		return nil, dsp.ScaleAmplitude, fmt.Errorf("FFT size %d is less than window length %d", nfft, winLen)
+	}
+
+	hop, err := cmd.Flags().GetInt("hop")
+	if err != nil {
+		return nil, dsp.ScaleAmplitude, err
+	}
+	if hop == 0 {
+		hop = defaultHop
+	}
+	if hop < 1 {
+		return nil, dsp.ScaleAmplitude, fmt.Errorf("invalid hop: %d", hop)
+	}
+
+	scaleName, err := cmd.Flags().GetString("scale")
+	if err != nil {
+		return nil, dsp.ScaleAmplitude, err
+	}
+	scale, err := dsp.ParseSpectrumScale(scaleName)
+	if err != nil {
+		return nil, dsp.ScaleAmplitude, err
+	}
+
+	stft := dsp.New(hop, winLen)
+	stft.Window = windowFn
+	stft.NFFT = nfft
+
+	return stft, scale, nil
+}
+
+// resynthesizeMasked returns samples resynthesized by ISTFT of the
+// spectrogram multiplied by each mask of masksFn, results have length of
+// samples. Silence is added on both sides so that every sample is covered by
+// all overlapping frames, masksFn gets amplitude spectrogram and frames
+// from..to within samples.
+func resynthesizeMasked(stft *dsp.STFT, samples []float64,
+	masksFn func(amp [][]float64, from int, to int) [][][]float64,
+) [][]float64 {
+	// leading silence of whole frame shifts keeps frame positions in samples
+	lead := (stft.FrameLen + stft.FrameShift - 1) / stft.FrameShift * stft.FrameShift
+	padded := make([]float64, lead+len(samples)+stft.FrameLen)
+	copy(padded[lead:], samples)
+
+	spectrogram := stft.STFT(padded)
+	amp, _ := dsp.SplitSpectrogram(spectrogram)
+
+	from := lead / stft.FrameShift
+	masks := masksFn(amp, from, from+max(1, stft.NumFrames(samples)))
+
+	out := make([][]float64, len(masks))
+	for i, mask := range masks {
+		signal := stft.ISTFT(dsp.ApplyComplexMask(spectrogram, mask))
+		out[i] = make([]float64, len(samples))
+		copy(out[i], signal[lead:])
+	}
+
+	return out
 }
 
 func doSpectrogramCmd(cmd *cobra.Command, args []string) {
@@ -53,15 +153,51 @@ func doSpectrogramCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
-	if _, err := os.Stat(inFileName); os.IsNotExist(err) {
-		fmt.Printf("path [%s] does not exist\n", inFileName)
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	plotCqt, err := cmd.Flags().GetBool("cqt")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	cqtMinFreq, err := cmd.Flags().GetFloat64("cqt-fmin")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	cqtBinsPerOctave, err := cmd.Flags().GetInt("cqt-bins")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	cqtOctaves, err := cmd.Flags().GetInt("cqt-octaves")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
 		return
 	}
 
-	fileNameBase := filenameWithoutExtension(inFileName)
+	//frameShift := 441 // 0.01 sec
+	stft, scale, err := stftFromFlags(cmd, 4410) // 0.1 sec
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	frameShift := stft.FrameShift
+
+	fileNameBase := outputBaseName(inFileName)
 
 	ctx := context.Background()
-	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName)
+	audioData, err := audiosource.AudioSamplesFromFile(ctx, inFileName, inFormatOpt)
 	if err != nil {
 		fmt.Printf("ERR: %v\n", err)
 		return
@@ -79,18 +215,28 @@ func doSpectrogramCmd(cmd *cobra.Command, args []string) {
 
 	audioSamplesCopy := slices.Clone(audioSamples)
 
-	//frameShift := 441 // 0.01 sec
-	frameShift := 4410 // 0.1 sec
-	frameSamples := 2048
+	if plotCqt {
+		t0 := time.Now()
+		cqt, err := dsp.NewCQT(sampleRate, cqtMinFreq, cqtBinsPerOctave, cqtOctaves, frameShift)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			return
+		}
+		cqtSpectrogram, _ := dsp.SplitSpectrogram(cqt.CQT(audioSamplesCopy))
+		fmt.Printf("cqt %v\n", time.Since(t0))
 
-	t0 := time.Now()
-	stft := dsp.New(
-		frameShift,
-		frameSamples,
-	)
+		plotFileName := fileNameBase + ".cqt.png"
+		plotCQT(plotFileName, cqt, cqtSpectrogram)
+		fmt.Printf("File %s created\n", plotFileName)
+		return
+	}
 
-	stftRes := stft.STFT(audioSamplesCopy)
-	spectrogram, _ := dsp.SplitSpectrogram(stftRes)
+	t0 := time.Now()
+	spectrogram := stft.Magnitude(audioSamplesCopy)
+	if len(spectrogram) == 0 {
+		fmt.Printf("ERR: audio is shorter than %d samples\n", stft.FrameLen)
+		return
+	}
 
 	fmt.Printf("spectrogram %v\n", time.Since(t0))
 
@@ -113,15 +259,21 @@ func doSpectrogramCmd(cmd *cobra.Command, args []string) {
 
 	t2 := time.Now()
 	plotFileName := fileNameBase + ".spectr.png"
-	plotSpectrogram(plotFileName, sampleRate, spectrogram, timeFreqPeaks)
+	maxFreq := getMaxFreq(spectrogram, sampleRate)
+	scaled := stft.ScaleSpectrogram(spectrogram, sampleRate, scale)
+	plotSpectrogram(plotFileName, sampleRate, stft.FFTLen(), scale, scaled, maxFreq, timeFreqPeaks)
 	fmt.Printf("plot %v\n", time.Since(t2))
 }
 
-func plotSpectrogram(fileName string, sampleRate int,
-	spectrogram [][]float64, timeFreqPeaks [][]float64) {
+// plotSpectrogram plots spectrogram of nfft points STFT in the scale up to
+// maxFreq
+func plotSpectrogram(fileName string, sampleRate int, nfft int, scale dsp.SpectrumScale,
+	spectrogram [][]float64, maxFreq float64, timeFreqPeaks [][]float64) {
 	hd := hmData{
 		mx:         spectrogram,
 		sampleRate: sampleRate,
+		nfft:       nfft,
+		floor:      plotFloor(spectrogram, scale),
 	}
 
 	//pal := palette.Heat(12, 1)
@@ -152,7 +304,7 @@ func plotSpectrogram(fileName string, sampleRate int,
 	}
 
 	p := plot.New()
-	p.Title.Text = "Heat map"
+	p.Title.Text = "Heat map, " + scale.String()
 
 	p.Add(h)
 
@@ -199,8 +351,6 @@ func plotSpectrogram(fileName string, sampleRate int,
 	//p.X.Max = 1.5
 	//p.Y.Max = 1.5
 
-	maxFreq := getMaxFreq(spectrogram, sampleRate)
-
 	p.Y.Max = maxFreq + 100.0
 	//p.Y.Max = 8000.0
 	//p.Y.Max = 1000.0
@@ -228,9 +378,105 @@ func plotSpectrogram(fileName string, sampleRate int,
 	}
 }
 
+// plotCQT plots constant-Q spectrogram in dB, frequency axis is logarithmic
+func plotCQT(fileName string, cqt *dsp.CQT, spectrogram [][]float64) {
+	const minDb = -80.0
+
+	mx := make([][]float64, len(spectrogram))
+	for i, frame := range spectrogram {
+		mx[i] = make([]float64, len(frame))
+		for k, v := range frame {
+			mx[i][k] = max(20*math.Log10(v+1e-12), minDb)
+		}
+	}
+
+	pal := moreland.SmoothBlueRed().Palette(32)
+	h := plotter.NewHeatMap(&cqtData{mx: mx}, pal)
+	h.Rasterized = true
+
+	p := plot.New()
+	p.Title.Text = "Constant-Q spectrogram"
+	p.Add(h)
+
+	// octave ticks labeled with frequency
+	freqs := cqt.Frequencies()
+	ticks := make([]plot.Tick, 0, cqt.NumOctaves)
+	for o := range cqt.NumOctaves {
+		bin := o * cqt.BinsPerOctave
+		ticks = append(ticks, plot.Tick{
+			Value: float64(bin),
+			Label: fmt.Sprintf("%.0f", freqs[bin]),
+		})
+	}
+	p.Y.Tick.Marker = plot.ConstantTicks(ticks)
+	p.Y.Label.Text = "Hz"
+	p.X.Padding = 0
+	p.Y.Padding = 0
+
+	img := vgimg.New(500, 500)
+	dc := draw.New(img)
+	p.Draw(dc)
+
+	w, err := os.Create(fileName)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer w.Close()
+	png := vgimg.PngCanvas{Canvas: img}
+	if _, err = png.WriteTo(w); err != nil {
+		log.Panic(err)
+	}
+}
+
+type cqtData struct {
+	mx [][]float64
+}
+
+func (hm *cqtData) Dims() (c, r int) {
+	return len(hm.mx), len(hm.mx[0])
+}
+
+func (hm *cqtData) Z(c, r int) float64 {
+	return hm.mx[c][r]
+}
+
+func (hm *cqtData) X(c int) float64 {
+	return float64(c)
+}
+
+func (hm *cqtData) Y(r int) float64 {
+	return float64(r)
+}
+
 type hmData struct {
 	mx         [][]float64
 	sampleRate int
+	// FFT size
+	nfft int
+	// values below floor are plotted as floor
+	floor float64
+}
+
+// plotFloor returns the lowest plotted value of spectrogram in the scale,
+// 80 dB below the maximum
+func plotFloor(spectrogram [][]float64, scale dsp.SpectrumScale) float64 {
+	var mx float64
+	if scale == dsp.ScaleDB {
+		mx = math.Inf(-1)
+	}
+	for _, frame := range spectrogram {
+		for _, v := range frame {
+			mx = max(mx, v)
+		}
+	}
+
+	switch scale {
+	case dsp.ScaleDB:
+		return mx - 80
+	case dsp.ScaleAmplitude:
+		return mx * 1e-4
+	}
+	return mx * 1e-8
 }
 
 func (hm *hmData) Dims() (c, r int) {
@@ -242,13 +488,7 @@ func (hm *hmData) Dims() (c, r int) {
 // Z returns the value of a grid value at (c, r).
 // It will panic if c or r are out of bounds for the grid.
 func (hm *hmData) Z(c, r int) float64 {
-	val := hm.mx[c][r]
-
-	if val < 0.5 {
-		val = 0
-	}
-
-	return val
+	return max(hm.mx[c][r], hm.floor)
 }
 
 // X returns the coordinate for the column at the index c.
@@ -260,7 +500,7 @@ func (hm *hmData) X(c int) float64 {
 // Y returns the coordinate for the row at the index r.
 // It will panic if r is out of bounds for the grid.
 func (hm *hmData) Y(r int) float64 {
-	return float64(r) * float64(hm.sampleRate) / (2 * 1024)
+	return float64(r) * float64(hm.sampleRate) / float64(hm.nfft)
 }
 
 func printMatrixAsGnuplotFormat(matrix [][]float64, sampleRate int) string {
@@ -0,0 +1,253 @@
+/*
+Copyright © 2024 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+	"github.com/drgolem/musiclab/scan"
+	"github.com/drgolem/musiclab/types"
+)
+
+// tempoCmd represents the tempo command
+var tempoCmd = &cobra.Command{
+	Use:   "tempo",
+	Short: "A brief description of your command",
+	Long: `A longer description that spans multiple lines and likely contains examples
+and usage of using your command. For example:
+
+Cobra is a CLI library for Go that empowers applications.
+This application is a tool to generate the needed files
+to quickly create a Cobra application.`,
+	Run: doTempoCmd,
+}
+
+func init() {
+	rootCmd.AddCommand(tempoCmd)
+
+	tempoCmd.Flags().String("file", "", "file or folder to analyze, - to read stdin")
+	tempoCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
+	tempoCmd.Flags().Float64("min-bpm", 40, "lowest tempo")
+	tempoCmd.Flags().Float64("max-bpm", 240, "highest tempo")
+	tempoCmd.Flags().Float64("tightness", 100, "beat tracking tightness to the tempo")
+	tempoCmd.Flags().Int("beats-per-bar", 4, "beats per bar for downbeat detection")
+	tempoCmd.Flags().Bool("beats", false, "write beat times to <file>.beats.csv")
+}
+
+// tempoInfo is rhythm analysis of a file
+type tempoInfo struct {
+	bpm float64
+	// beat times, seconds
+	beats []float64
+	// index of the first downbeat in beats
+	downbeat int
+}
+
+func doTempoCmd(cmd *cobra.Command, args []string) {
+	inFileName, err := cmd.Flags().GetString("file")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	minBPM, err := cmd.Flags().GetFloat64("min-bpm")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	maxBPM, err := cmd.Flags().GetFloat64("max-bpm")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if minBPM <= 0 || maxBPM <= minBPM {
+		fmt.Printf("ERR: invalid tempo range: %.1f - %.1f\n", minBPM, maxBPM)
+		return
+	}
+
+	tightness, err := cmd.Flags().GetFloat64("tightness")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	beatsPerBar, err := cmd.Flags().GetInt("beats-per-bar")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if beatsPerBar < 1 {
+		fmt.Printf("ERR: invalid beats per bar: %d\n", beatsPerBar)
+		return
+	}
+
+	writeBeats, err := cmd.Flags().GetBool("beats")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	fileNames, err := audioFilesInPath(inFileName)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+
+	ctx := context.Background()
+
+	for _, fileName := range fileNames {
+		audioData, err := audiosource.AudioSamplesFromFile(ctx, fileName, inFormatOpt)
+		if err != nil {
+			fmt.Printf("ERR: %s: %v\n", fileName, err)
+			continue
+		}
+
+		info := analyzeTempo(audioData, minBPM, maxBPM, tightness, beatsPerBar)
+		if info.bpm == 0 {
+			fmt.Printf("%s: tempo not detected\n", fileName)
+			continue
+		}
+
+		fmt.Printf("%s: BPM: %.1f, beats: %d", fileName, info.bpm, len(info.beats))
+		if len(info.beats) > 0 {
+			fmt.Printf(", first downbeat: %.3f sec", info.beats[info.downbeat])
+		}
+		fmt.Println()
+
+		if writeBeats {
+			beatsFileName := outputBaseName(fileName) + ".beats.csv"
+			err = writeTempoBeats(beatsFileName, info, beatsPerBar)
+			if err != nil {
+				fmt.Printf("ERR: %v\n", err)
+				return
+			}
+			fmt.Printf("File %s created\n", beatsFileName)
+		}
+	}
+}
+
+// audioFilesInPath returns fileName, or supported audio files of a folder
+// tree in lexical order
+func audioFilesInPath(fileName string) ([]string, error) {
+	if fileName == audiosource.StdinFileName {
+		return []string{fileName}, nil
+	}
+
+	st, err := os.Stat(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return []string{fileName}, nil
+	}
+
+	// wav files have no tags to scan, but can be decoded
+	musicFileTypes := append(scan.MusicFileTypes(), types.FileFormat_WAV)
+
+	fileNames := make([]string, 0)
+	err = filepath.WalkDir(fileName, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := types.FileFormatType(strings.ToLower(filepath.Ext(p)))
+		if !d.IsDir() && slices.Contains(musicFileTypes, ext) {
+			fileNames = append(fileNames, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return fileNames, nil
+}
+
+// analyzeTempo estimates tempo, beats and downbeats, beat times are centers
+// of STFT frames with onsets
+func analyzeTempo(audioData audiosource.AudioSamples, minBPM float64, maxBPM float64,
+	tightness float64, beatsPerBar int,
+) tempoInfo {
+	var info tempoInfo
+
+	sampleRate := audioData.SampleRate
+	frameShift := int(float64(sampleRate) / 100.0) // 0.01 sec
+	frameLen := 2048
+
+	if len(audioData.Audio) < frameLen {
+		return info
+	}
+
+	stft := dsp.New(frameShift, frameLen)
+	amp := stft.Magnitude(audioData.Audio)
+
+	frameRate := float64(sampleRate) / float64(frameShift)
+	env := dsp.OnsetStrength(amp)
+
+	info.bpm = dsp.EstimateTempo(env, frameRate, minBPM, maxBPM)
+	if info.bpm == 0 {
+		return info
+	}
+
+	beats := dsp.TrackBeats(env, frameRate, info.bpm, tightness)
+
+	// kick drum accents downbeats
+	const downbeatMaxFreq = 150
+	lowEnv := dsp.OnsetStrengthBand(amp, 0, downbeatMaxFreq*frameLen/sampleRate+1)
+	info.downbeat = dsp.DownbeatPhase(dsp.BeatStrength(lowEnv, beats, 3), beatsPerBar)
+
+	info.beats = make([]float64, len(beats))
+	for i, b := range beats {
+		info.beats[i] = float64(b*frameShift+frameLen/2) / float64(sampleRate)
+	}
+
+	return info
+}
+
+// writeTempoBeats writes beat times with bar number and beat position in the
+// bar, beat 1 is a downbeat, beats before the first downbeat are in bar 0
+func writeTempoBeats(fileName string, info tempoInfo, beatsPerBar int) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"time", "bar", "beat"})
+
+	for i, ts := range info.beats {
+		pos := i - info.downbeat + beatsPerBar
+		w.Write([]string{
+			strconv.FormatFloat(ts, 'f', 3, 64),
+			strconv.Itoa(pos / beatsPerBar),
+			strconv.Itoa(pos%beatsPerBar + 1),
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
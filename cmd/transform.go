@@ -10,11 +10,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 
+	"github.com/drgolem/musiclab/audioproc"
 	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/dsp"
+	"github.com/drgolem/musiclab/types"
 	"github.com/spf13/cobra"
-	"github.com/youpy/go-wav"
 
 	soxr "github.com/zaf/resample"
 )
@@ -35,10 +38,15 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(resampleCmd)
 
-	resampleCmd.Flags().String("in", "", "input file to resample")
+	resampleCmd.Flags().String("in", "", "input file to resample, - to read stdin")
+	resampleCmd.Flags().String("pcm-format", "", "raw PCM format of stdin input without wav header, rate:channels:bits (44100:2:16)")
 	resampleCmd.Flags().Int("new-samplerate", 48000, "new samplerate")
-	resampleCmd.Flags().String("out", "out_transformed.wav", "output wav file with a new samplerate")
+	resampleCmd.Flags().String("out", "out_transformed.wav", "output file with a new samplerate, - to write stdout")
 	resampleCmd.Flags().Bool("mono", false, "output to mono signal")
+	resampleCmd.Flags().String("format", "wav", "output format: wav, flac, pcm (stdout only)")
+	resampleCmd.Flags().String("eq", "", "parametric EQ bands applied before resampling: type:freq[:gain][:q],... (highpass:30,lowshelf:100:3,peak:2500:-4:2)")
+	resampleCmd.Flags().Float64("tempo", 1.0, "tempo change keeping pitch, 0.5 - half speed")
+	resampleCmd.Flags().Float64("semitones", 0, "pitch shift keeping tempo, semitones")
 }
 
 func doResampleCmd(cmd *cobra.Command, args []string) {
@@ -47,8 +55,15 @@ func doResampleCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
-	if _, err := os.Stat(inFileName); os.IsNotExist(err) {
-		fmt.Printf("path [%s] does not exist\n", inFileName)
+	if inFileName != audiosource.StdinFileName {
+		if _, err := os.Stat(inFileName); os.IsNotExist(err) {
+			fmt.Printf("path [%s] does not exist\n", inFileName)
+			return
+		}
+	}
+	inFormatOpt, err := inputFormatOption(cmd)
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
 		return
 	}
 
@@ -63,10 +78,49 @@ func doResampleCmd(cmd *cobra.Command, args []string) {
 		fmt.Printf("ERR: %v\n", err)
 		return
 	}
+	outFormat, err := cmd.Flags().GetString("format")
+	if err != nil {
+		fmt.Printf("ERR: %v\n", err)
+		return
+	}
+	if !cmd.Flags().Changed("out") {
+		outFileName = filenameWithoutExtension(outFileName) + "." + outFormat
+	}
+	msgOut := messageOutput(outFileName)
 
 	convertToMono, err := cmd.Flags().GetBool("mono")
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+
+	eqStr, err := cmd.Flags().GetString("eq")
+	if err != nil {
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+	eqBands, err := dsp.ParseEQ(eqStr)
+	if err != nil {
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+
+	tempo, err := cmd.Flags().GetFloat64("tempo")
+	if err != nil {
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+	if tempo < audioproc.MinTempo || tempo > audioproc.MaxTempo {
+		fmt.Fprintf(msgOut, "ERR: tempo %.2f out of range %.2f..%.2f\n", tempo, audioproc.MinTempo, audioproc.MaxTempo)
+		return
+	}
+	semitones, err := cmd.Flags().GetFloat64("semitones")
+	if err != nil {
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
+	if semitones < -audioproc.MaxSemitones || semitones > audioproc.MaxSemitones {
+		fmt.Fprintf(msgOut, "ERR: pitch shift %.1f out of range +-%.0f semitones\n", semitones, audioproc.MaxSemitones)
 		return
 	}
 
@@ -78,106 +132,180 @@ func doResampleCmd(cmd *cobra.Command, args []string) {
 
 	const framesPerBuffer = 2048
 
-	audioStream, err := audiosource.NewMusicAudioProducer(ctx, inFileName, audiosource.WithFramesPerBuffer(framesPerBuffer))
+	audioStream, err := audiosource.NewMusicAudioProducer(ctx, inFileName, audiosource.WithFramesPerBuffer(framesPerBuffer), audiosource.WithLogOutput(msgOut), inFormatOpt)
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
 	defer audioStream.Close()
 
 	audioFormat := audioStream.GetFormat()
 
-	fmt.Printf("Resamping: %s\n", inFileName)
-	fmt.Printf("Encoding: Signed 16bit\n")
-	fmt.Printf("Channels: %d\n", audioFormat.Channels)
-	fmt.Printf("Input Sample Rate: %d\n", audioFormat.SampleRate)
-	fmt.Printf("Output Sample Rate: %d\n", newSampleRate)
+	fmt.Fprintf(msgOut, "Resamping: %s\n", inFileName)
+	fmt.Fprintf(msgOut, "Encoding: Signed 16bit\n")
+	fmt.Fprintf(msgOut, "Channels: %d\n", audioFormat.Channels)
+	fmt.Fprintf(msgOut, "Input Sample Rate: %d\n", audioFormat.SampleRate)
+	fmt.Fprintf(msgOut, "Output Sample Rate: %d\n", newSampleRate)
 
-	inSamplesCnt := 0
+	audioIn := audioStream.Stream()
+	if len(eqBands) > 0 {
+		for _, b := range eqBands {
+			fmt.Fprintf(msgOut, "EQ: %s %.1f Hz, gain %+.1f dB, Q %.2f\n", b.Type, b.Freq, b.GainDb, b.Q)
+		}
+		audioIn = audioproc.NewEQStage(eqBands).Process(ctx, audioIn)
+	}
+	if tempo != 1 || semitones != 0 {
+		fmt.Fprintf(msgOut, "Tempo: %.2f, pitch shift: %+.1f semitones\n", tempo, semitones)
+		timePitch := audioproc.NewTimePitchStage()
+		timePitch.SetTempo(tempo)
+		timePitch.SetSemitones(semitones)
+		audioIn = timePitch.Process(ctx, audioIn)
+	}
+
+	audioPktChan := make(chan audiosource.AudioSamplesPacket, 1)
 
-	audioData := make([]byte, 0)
+	sink, err := newFileSink(outFormat, outFileName, audioPktChan, sourceSongInfo(inFileName))
+	if err != nil {
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		return
+	}
 
-	for pkt := range audioStream.Stream() {
-		inSamplesCnt += pkt.SamplesCount
-		audioData = append(audioData, pkt.Audio[:pkt.SamplesCount*4]...)
+	outNumChannels := audioFormat.Channels
+	if convertToMono && audioFormat.Channels == 2 {
+		outNumChannels = 1
 	}
 
-	var bufResampledAudio bytes.Buffer
+	pktWriter := &packetWriter{
+		ctx: ctx,
+		inFormat: types.FrameFormat{
+			SampleRate:    newSampleRate,
+			Channels:      audioFormat.Channels,
+			BitsPerSample: audioFormat.BitsPerSample,
+		},
+		toMono: outNumChannels == 1 && audioFormat.Channels == 2,
+		out:    audioPktChan,
+	}
 
-	bufWriter := bufio.NewWriter(&bufResampledAudio)
+	inSamplesCnt := 0
 
-	resampler, err := soxr.New(bufWriter,
-		float64(audioFormat.SampleRate),
-		float64(newSampleRate),
-		audioFormat.Channels,
-		soxr.I16,
-		soxr.HighQ)
+	go func() {
+		defer close(audioPktChan)
+
+		resampler, err := soxr.New(pktWriter,
+			float64(audioFormat.SampleRate),
+			float64(newSampleRate),
+			audioFormat.Channels,
+			soxr.I16,
+			soxr.HighQ)
+		if err != nil {
+			fmt.Fprintf(msgOut, "ERR: %v\n", err)
+			return
+		}
+
+		frameByteSize := audioFormat.Channels * audioFormat.BitsPerSample / 8
+
+		for pkt := range audioIn {
+			inSamplesCnt += pkt.SamplesCount
+			_, err := resampler.Write(pkt.Audio[:pkt.SamplesCount*frameByteSize])
+			if err != nil {
+				fmt.Fprintf(msgOut, "ERR: %v\n", err)
+				resampler.Close()
+				return
+			}
+		}
+
+		// flush resampler
+		err = resampler.Close()
+		if err != nil {
+			fmt.Fprintf(msgOut, "ERR: %v\n", err)
+		}
+	}()
+
+	err = sink.Play(ctx)
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		sink.Close(ctx)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
-
-	ns, err := resampler.Write(audioData)
+	// file is finalized on close
+	err = sink.Close(ctx)
 	if err != nil {
-		fmt.Printf("ERR: %v\n", err)
+		fmt.Fprintf(msgOut, "ERR: %v\n", err)
 		return
 	}
-	fmt.Printf("%v\n", ns)
-	resampler.Close()
-	bufWriter.Flush()
 
-	outSamplesCnt := bufResampledAudio.Len() / (audioFormat.Channels * audioFormat.BitsPerSample / 8)
+	fmt.Fprintf(msgOut, "input samples: %d\n", inSamplesCnt)
+	fmt.Fprintf(msgOut, "output samples: %d\n", pktWriter.samplesCnt)
+}
 
-	outNumChannels := audioFormat.Channels
+// packetWriter splits resampled audio into packets for the audio sink,
+// optionally mixing stereo to mono
+type packetWriter struct {
+	ctx        context.Context
+	inFormat   types.FrameFormat
+	toMono     bool
+	out        chan<- audiosource.AudioSamplesPacket
+	partial    []byte
+	samplesCnt int
+}
 
-	var outputData []byte
+func (w *packetWriter) Write(p []byte) (int, error) {
+	frameByteSize := w.inFormat.Channels * w.inFormat.BitsPerSample / 8
 
-	if convertToMono && audioFormat.Channels == 2 {
-		var bufMono bytes.Buffer
-		bufMonoWriter := bufio.NewWriter(&bufMono)
+	data := append(w.partial, p...)
+	nSamples := len(data) / frameByteSize
+	w.partial = slices.Clone(data[nSamples*frameByteSize:])
+	if nSamples == 0 {
+		return len(p), nil
+	}
+	data = data[:nSamples*frameByteSize]
 
-		stereoData := bufResampledAudio.Bytes()
+	outFormat := w.inFormat
+	if w.toMono {
+		data = stereoToMono(data)
+		outFormat.Channels = 1
+	}
 
-		idx := 0
-		for idx < len(stereoData) {
-			chSample := [2]int16{}
-			for ch := range 2 {
-				b0 := int16(stereoData[idx])
-				idx++
-				b1 := int16(stereoData[idx])
-				idx++
+	pkt := audiosource.AudioSamplesPacket{
+		Format:       outFormat,
+		Audio:        data,
+		SamplesCount: nSamples,
+	}
 
-				chSample[ch] = int16((b1 << 8) | b0)
-			}
+	select {
+	case w.out <- pkt:
+	case <-w.ctx.Done():
+		return 0, w.ctx.Err()
+	}
+	w.samplesCnt += nSamples
 
-			t := chSample[0]/2 + chSample[1]/2
+	return len(p), nil
+}
 
-			bufMonoWriter.WriteByte(byte(t & 0xFF))
-			bufMonoWriter.WriteByte(byte((t >> 8) & 0xFF))
+// stereoToMono mixes 16 bit stereo samples to mono
+func stereoToMono(stereoData []byte) []byte {
+	var bufMono bytes.Buffer
+	bufMonoWriter := bufio.NewWriter(&bufMono)
+
+	idx := 0
+	for idx < len(stereoData) {
+		chSample := [2]int16{}
+		for ch := range 2 {
+			b0 := int16(stereoData[idx])
+			idx++
+			b1 := int16(stereoData[idx])
+			idx++
+
+			chSample[ch] = int16((b1 << 8) | b0)
 		}
 
-		bufMonoWriter.Flush()
-
-		outputData = bufMono.Bytes()
-		outNumChannels = 1
-	} else {
-		outputData = bufResampledAudio.Bytes()
-	}
+		t := chSample[0]/2 + chSample[1]/2
 
-	fOut, err := os.OpenFile(outFileName, os.O_WRONLY|os.O_CREATE, 0600)
-	if err != nil {
-		panic(err)
+		bufMonoWriter.WriteByte(byte(t & 0xFF))
+		bufMonoWriter.WriteByte(byte((t >> 8) & 0xFF))
 	}
-	defer fOut.Close()
-
-	wavWriter := wav.NewWriter(fOut,
-		uint32(outSamplesCnt),
-		uint16(outNumChannels),
-		uint32(newSampleRate),
-		uint16(audioFormat.BitsPerSample))
 
-	wavWriter.Write(outputData)
+	bufMonoWriter.Flush()
 
-	fmt.Printf("input samples: %d\n", inSamplesCnt)
-	fmt.Printf("output samples: %d\n", outSamplesCnt)
+	return bufMono.Bytes()
 }
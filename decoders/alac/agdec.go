@@ -0,0 +1,152 @@
+package alac
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// adaptive Golomb decoding, port of ag_dec.c from Apple's ALAC reference decoder
+
+const (
+	qbShift       = 9
+	qb            = 1 << qbShift
+	mmulShift     = 2
+	mdenShift     = qbShift - mmulShift - 1
+	moff          = 1 << (mdenShift - 2)
+	bitOff        = 24
+	maxMeanClamp  = 0xffff
+	meanClampVal  = 0xffff
+	maxPrefix16   = 9
+	maxPrefix32   = 9
+	maxDataBits16 = 16
+)
+
+var errParam = errors.New("alac: invalid packet")
+
+type agParams struct {
+	mb uint32
+	pb uint32
+	kb uint32
+	wb uint32
+}
+
+func newAgParams(m, p, k uint32) agParams {
+	return agParams{
+		mb: m,
+		pb: p,
+		kb: k,
+		wb: (1 << k) - 1,
+	}
+}
+
+func lg3a(x uint32) uint32 {
+	return uint32(31 - bits.LeadingZeros32(x+3))
+}
+
+// dynGet decodes zero run length
+func dynGet(br *bitReader, m, k uint32) uint32 {
+	s := br.peek()
+	pre := uint32(bits.LeadingZeros64(^s))
+
+	if pre >= maxPrefix16 {
+		br.skip(maxPrefix16)
+		return br.read(maxDataBits16)
+	}
+
+	v := uint32((s << (pre + 1)) >> (64 - k))
+	if v < 2 {
+		br.skip(uint(pre + k))
+		return pre * m
+	}
+	br.skip(uint(pre + 1 + k))
+	return pre*m + v - 1
+}
+
+// dynGet32 decodes single sample residual
+func dynGet32(br *bitReader, m, k uint32, maxBits uint) uint32 {
+	s := br.peek()
+	pre := uint32(bits.LeadingZeros64(^s))
+
+	if pre >= maxPrefix32 {
+		br.skip(maxPrefix32)
+		return br.read(min(maxBits, 32))
+	}
+
+	if k == 1 {
+		br.skip(uint(pre + 1))
+		return pre
+	}
+
+	v := uint32((s << (pre + 1)) >> (64 - k))
+	if v < 2 {
+		br.skip(uint(pre + k))
+		return pre * m
+	}
+	br.skip(uint(pre + 1 + k))
+	return pre*m + v - 1
+}
+
+// dynDecomp decodes numSamples residuals into pc
+func dynDecomp(params agParams, br *bitReader, pc []int32, numSamples int, maxSize uint) error {
+	mb := params.mb
+	pb := params.pb
+	kb := params.kb
+	wb := params.wb
+
+	zmode := uint32(0)
+	c := 0
+
+	for c < numSamples {
+		if br.bitsLeft() <= 0 {
+			return errParam
+		}
+
+		m := mb >> qbShift
+		k := min(lg3a(m), kb)
+		m = (1 << k) - 1
+
+		n := dynGet32(br, m, k, maxSize)
+
+		// least significant bit is sign bit
+		ndecode := n + zmode
+		del := int32((ndecode + 1) >> 1)
+		if ndecode&1 != 0 {
+			del = -del
+		}
+		pc[c] = del
+		c++
+
+		mb = pb*(n+zmode) + mb - ((pb * mb) >> qbShift)
+
+		// update mean tracking
+		if n > maxMeanClamp {
+			mb = meanClampVal
+		}
+
+		zmode = 0
+
+		if (mb<<mmulShift) < qb && c < numSamples {
+			zmode = 1
+			k := uint32(bits.LeadingZeros32(mb)) - bitOff + ((mb + moff) >> mdenShift)
+			mz := ((uint32(1) << k) - 1) & wb
+
+			n := int(dynGet(br, mz, k))
+			if c+n > numSamples {
+				return errParam
+			}
+
+			for j := 0; j < n; j++ {
+				pc[c] = 0
+				c++
+			}
+
+			if n >= 65535 {
+				zmode = 0
+			}
+
+			mb = 0
+		}
+	}
+
+	return nil
+}
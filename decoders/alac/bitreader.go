@@ -0,0 +1,47 @@
+package alac
+
+// bitReader reads big-endian bit fields from a packet.
+// Reads past the end of the buffer return zero bits.
+type bitReader struct {
+	buf []byte
+	pos uint
+}
+
+func newBitReader(buf []byte) bitReader {
+	return bitReader{buf: buf}
+}
+
+// peek returns the next 64 bits starting at the current position
+func (b *bitReader) peek() uint64 {
+	idx := b.pos >> 3
+	var v uint64
+	for i := uint(0); i < 8; i++ {
+		v <<= 8
+		if idx+i < uint(len(b.buf)) {
+			v |= uint64(b.buf[idx+i])
+		}
+	}
+	return v << (b.pos & 7)
+}
+
+// read returns next n bits (n <= 32)
+func (b *bitReader) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	v := uint32(b.peek() >> (64 - n))
+	b.pos += n
+	return v
+}
+
+func (b *bitReader) skip(n uint) {
+	b.pos += n
+}
+
+func (b *bitReader) byteAlign() {
+	b.pos = (b.pos + 7) &^ 7
+}
+
+func (b *bitReader) bitsLeft() int {
+	return len(b.buf)*8 - int(b.pos)
+}
@@ -0,0 +1,63 @@
+package alac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const configSize = 24
+
+// Config is the ALAC magic cookie (ALACSpecificConfig) stored in the
+// 'alac' box of the MP4 sample description.
+type Config struct {
+	FrameLength       uint32
+	CompatibleVersion uint8
+	BitDepth          uint8
+	PB                uint8
+	MB                uint8
+	KB                uint8
+	NumChannels       uint8
+	MaxRun            uint16
+	MaxFrameBytes     uint32
+	AvgBitRate        uint32
+	SampleRate        uint32
+}
+
+// ParseConfig parses the ALAC magic cookie. The cookie may be prefixed
+// with 'frma' and 'alac' atoms as found in QuickTime sound descriptions.
+func ParseConfig(cookie []byte) (Config, error) {
+	var cfg Config
+
+	// skip 'frma' atom if present
+	if len(cookie) >= 12 && string(cookie[4:8]) == "frma" {
+		cookie = cookie[12:]
+	}
+	// skip 'alac' atom header (size, type, version/flags) if present
+	if len(cookie) >= 12 && string(cookie[4:8]) == "alac" {
+		cookie = cookie[12:]
+	}
+
+	if len(cookie) < configSize {
+		return cfg, fmt.Errorf("alac: invalid magic cookie size: %d", len(cookie))
+	}
+
+	err := binary.Read(bytes.NewReader(cookie[:configSize]), binary.BigEndian, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	if cfg.CompatibleVersion != 0 {
+		return cfg, fmt.Errorf("alac: unsupported version: %d", cfg.CompatibleVersion)
+	}
+	switch cfg.BitDepth {
+	case 16, 20, 24, 32:
+	default:
+		return cfg, fmt.Errorf("alac: unsupported bit depth: %d", cfg.BitDepth)
+	}
+	if cfg.NumChannels == 0 || cfg.FrameLength == 0 {
+		return cfg, fmt.Errorf("alac: invalid config: %+v", cfg)
+	}
+
+	return cfg, nil
+}
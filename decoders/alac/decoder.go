@@ -0,0 +1,355 @@
+package alac
+
+import (
+	"fmt"
+)
+
+// element tags
+const (
+	idSCE = 0 // single channel element
+	idCPE = 1 // channel pair element
+	idCCE = 2 // coupling channel element
+	idLFE = 3 // LFE channel element
+	idDSE = 4 // data stream element
+	idPCE = 5 // program config element
+	idFIL = 6 // filler element
+	idEND = 7 // frame end
+)
+
+const maxCoefs = 32
+
+// Decoder is a pure Go Apple Lossless (ALAC) packet decoder.
+type Decoder struct {
+	cfg Config
+
+	mixBufferU  []int32
+	mixBufferV  []int32
+	predictor   []int32
+	shiftBuffer []uint16
+}
+
+// NewDecoder returns ALAC decoder for a given magic cookie.
+func NewDecoder(cookie []byte) (*Decoder, error) {
+	cfg, err := ParseConfig(cookie)
+	if err != nil {
+		return nil, err
+	}
+
+	frameLen := int(cfg.FrameLength)
+
+	d := Decoder{
+		cfg:         cfg,
+		mixBufferU:  make([]int32, frameLen),
+		mixBufferV:  make([]int32, frameLen),
+		predictor:   make([]int32, frameLen),
+		shiftBuffer: make([]uint16, 2*frameLen),
+	}
+
+	return &d, nil
+}
+
+// Config returns decoder configuration.
+func (d *Decoder) Config() Config {
+	return d.cfg
+}
+
+// Decode decodes a single ALAC packet into interleaved samples.
+// Samples keep the stream bit depth (Config.BitDepth), out must hold
+// at least FrameLength * NumChannels values.
+// Returns number of decoded samples per channel.
+func (d *Decoder) Decode(packet []byte, out []int32) (int, error) {
+	numChannels := int(d.cfg.NumChannels)
+	if len(out) < int(d.cfg.FrameLength)*numChannels {
+		return 0, fmt.Errorf("alac: output buffer too small: %d", len(out))
+	}
+
+	br := newBitReader(packet)
+
+	channelIndex := 0
+	outNumSamples := 0
+
+	for channelIndex < numChannels {
+		if br.bitsLeft() < 3 {
+			break
+		}
+		tag := br.read(3)
+
+		switch tag {
+		case idSCE, idLFE:
+			n, err := d.decodeSCE(&br, out, channelIndex)
+			if err != nil {
+				return 0, err
+			}
+			outNumSamples = n
+			channelIndex++
+
+		case idCPE:
+			if channelIndex+2 > numChannels {
+				return outNumSamples, nil
+			}
+			n, err := d.decodeCPE(&br, out, channelIndex)
+			if err != nil {
+				return 0, err
+			}
+			outNumSamples = n
+			channelIndex += 2
+
+		case idDSE:
+			// skip data stream element
+			br.skip(4) // element instance tag
+			dataByteAlignFlag := br.read(1)
+			count := br.read(8)
+			if count == 255 {
+				count += br.read(8)
+			}
+			if dataByteAlignFlag != 0 {
+				br.byteAlign()
+			}
+			br.skip(uint(count) * 8)
+
+		case idFIL:
+			count := br.read(4)
+			if count == 15 {
+				count += br.read(8) - 1
+			}
+			br.skip(uint(count) * 8)
+
+		case idEND:
+			br.byteAlign()
+			return outNumSamples, nil
+
+		default:
+			return 0, fmt.Errorf("alac: unsupported element: %d", tag)
+		}
+
+		if br.bitsLeft() < 0 {
+			return 0, errParam
+		}
+	}
+
+	return outNumSamples, nil
+}
+
+type channelParams struct {
+	mode     uint32
+	denShift uint
+	pbFactor uint32
+	num      int
+	coefs    [maxCoefs]int16
+}
+
+func (cp *channelParams) read(br *bitReader) {
+	headerByte := br.read(8)
+	cp.mode = headerByte >> 4
+	cp.denShift = uint(headerByte & 0xf)
+
+	headerByte = br.read(8)
+	cp.pbFactor = headerByte >> 5
+	cp.num = int(headerByte & 0x1f)
+
+	for i := 0; i < cp.num; i++ {
+		cp.coefs[i] = int16(br.read(16))
+	}
+}
+
+type elementHeader struct {
+	numSamples   int
+	bytesShifted uint
+	escape       bool
+}
+
+func (d *Decoder) readElementHeader(br *bitReader) (elementHeader, error) {
+	var eh elementHeader
+
+	br.skip(4) // element instance tag
+
+	unusedHeader := br.read(12)
+	if unusedHeader != 0 {
+		return eh, errParam
+	}
+
+	// 1-bit "partial frame" flag, 2-bit "shift-off" flag & 1-bit "escape" flag
+	headerByte := br.read(4)
+	partialFrame := headerByte >> 3
+	eh.bytesShifted = uint((headerByte >> 1) & 0x3)
+	if eh.bytesShifted == 3 {
+		return eh, errParam
+	}
+	eh.escape = headerByte&0x1 != 0
+
+	eh.numSamples = int(d.cfg.FrameLength)
+	if partialFrame != 0 {
+		eh.numSamples = int(br.read(16)<<16 | br.read(16))
+		if eh.numSamples > int(d.cfg.FrameLength) {
+			return eh, errParam
+		}
+	}
+
+	return eh, nil
+}
+
+// decompress residuals and run predictor for a single channel
+func (d *Decoder) decodeChannel(br *bitReader, cp *channelParams, out []int32, numSamples int, chanBits uint) error {
+	pb := uint32(d.cfg.PB) * cp.pbFactor / 4
+	params := newAgParams(uint32(d.cfg.MB), pb, uint32(d.cfg.KB))
+
+	err := dynDecomp(params, br, d.predictor, numSamples, chanBits)
+	if err != nil {
+		return err
+	}
+
+	if cp.mode == 0 {
+		unpcBlock(d.predictor, out, numSamples, cp.coefs[:], cp.num, chanBits, cp.denShift)
+	} else {
+		// the special "numActive == 31" mode can be done in-place
+		unpcBlock(d.predictor, d.predictor, numSamples, nil, 31, chanBits, 0)
+		unpcBlock(d.predictor, out, numSamples, cp.coefs[:], cp.num, chanBits, cp.denShift)
+	}
+
+	return nil
+}
+
+func readVerbatim(br *bitReader, chanBits uint) int32 {
+	shift := 32 - chanBits
+	val := int32(br.read(chanBits))
+	return (val << shift) >> shift
+}
+
+func (d *Decoder) decodeSCE(br *bitReader, out []int32, channelIndex int) (int, error) {
+	eh, err := d.readElementHeader(br)
+	if err != nil {
+		return 0, err
+	}
+	numSamples := eh.numSamples
+	bytesShifted := eh.bytesShifted
+
+	chanBits := uint(d.cfg.BitDepth) - bytesShifted*8
+
+	var shiftBits bitReader
+
+	if !eh.escape {
+		// mixBits and mixRes are not used for mono
+		br.skip(16)
+
+		var cp channelParams
+		cp.read(br)
+
+		// if shift active, skip the shift buffer but remember where it starts
+		if bytesShifted != 0 {
+			shiftBits = *br
+			br.skip(bytesShifted * 8 * uint(numSamples))
+		}
+
+		err := d.decodeChannel(br, &cp, d.mixBufferU, numSamples, chanBits)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		// uncompressed frame
+		for i := 0; i < numSamples; i++ {
+			d.mixBufferU[i] = readVerbatim(br, chanBits)
+		}
+		bytesShifted = 0
+	}
+
+	// read the shifted values into the shift buffer
+	shift := bytesShifted * 8
+	if bytesShifted != 0 {
+		for i := 0; i < numSamples; i++ {
+			d.shiftBuffer[i] = uint16(shiftBits.read(shift))
+		}
+	}
+
+	numChannels := int(d.cfg.NumChannels)
+	for i, j := 0, channelIndex; i < numSamples; i, j = i+1, j+numChannels {
+		val := d.mixBufferU[i]
+		if bytesShifted != 0 {
+			val = (val << shift) | int32(d.shiftBuffer[i])
+		}
+		out[j] = val
+	}
+
+	return numSamples, nil
+}
+
+func (d *Decoder) decodeCPE(br *bitReader, out []int32, channelIndex int) (int, error) {
+	eh, err := d.readElementHeader(br)
+	if err != nil {
+		return 0, err
+	}
+	numSamples := eh.numSamples
+	bytesShifted := eh.bytesShifted
+
+	chanBits := min(uint(d.cfg.BitDepth)-bytesShifted*8+1, 32)
+
+	var mixBits uint
+	var mixRes int32
+	var shiftBits bitReader
+
+	if !eh.escape {
+		mixBits = uint(br.read(8))
+		mixRes = int32(int8(br.read(8)))
+
+		var cpU, cpV channelParams
+		cpU.read(br)
+		cpV.read(br)
+
+		// if shift active, skip the interleaved shifted values but remember where they start
+		if bytesShifted != 0 {
+			shiftBits = *br
+			br.skip(bytesShifted * 8 * 2 * uint(numSamples))
+		}
+
+		// "left" channel
+		err := d.decodeChannel(br, &cpU, d.mixBufferU, numSamples, chanBits)
+		if err != nil {
+			return 0, err
+		}
+
+		// "right" channel
+		err = d.decodeChannel(br, &cpV, d.mixBufferV, numSamples, chanBits)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		// uncompressed frame
+		chanBits = uint(d.cfg.BitDepth)
+		for i := 0; i < numSamples; i++ {
+			d.mixBufferU[i] = readVerbatim(br, chanBits)
+			d.mixBufferV[i] = readVerbatim(br, chanBits)
+		}
+		bytesShifted = 0
+	}
+
+	// read the shifted values into the shift buffer
+	shift := bytesShifted * 8
+	if bytesShifted != 0 {
+		for i := 0; i < 2*numSamples; i += 2 {
+			d.shiftBuffer[i+0] = uint16(shiftBits.read(shift))
+			d.shiftBuffer[i+1] = uint16(shiftBits.read(shift))
+		}
+	}
+
+	// un-mix the data
+	numChannels := int(d.cfg.NumChannels)
+	for i, j := 0, channelIndex; i < numSamples; i, j = i+1, j+numChannels {
+		u := d.mixBufferU[i]
+		v := d.mixBufferV[i]
+
+		l, r := u, v
+		if mixRes != 0 {
+			l = u + v - ((mixRes * v) >> mixBits)
+			r = l - v
+		}
+
+		if bytesShifted != 0 {
+			l = (l << shift) | int32(d.shiftBuffer[2*i+0])
+			r = (r << shift) | int32(d.shiftBuffer[2*i+1])
+		}
+
+		out[j] = l
+		out[j+1] = r
+	}
+
+	return numSamples, nil
+}
@@ -0,0 +1,261 @@
+package alac
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bitWriter struct {
+	buf []byte
+	pos uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		if w.pos/8 >= uint(len(w.buf)) {
+			w.buf = append(w.buf, 0)
+		}
+		if (v>>uint(i))&1 != 0 {
+			w.buf[w.pos/8] |= 0x80 >> (w.pos % 8)
+		}
+		w.pos++
+	}
+}
+
+// encoder side of dynamic predictor (dp_enc.c)
+func pcBlock(in []int32, pc1 []int32, num int, coefs []int16, numActive int, chanBits uint, denShift uint) {
+	chanShift := 32 - chanBits
+	denHalf := int32(1) << (denShift - 1)
+
+	pc1[0] = in[0]
+	for j := 1; j <= numActive; j++ {
+		del := in[j] - in[j-1]
+		pc1[j] = (del << chanShift) >> chanShift
+	}
+
+	lim := numActive + 1
+	for j := lim; j < num; j++ {
+		var sum1 int32
+		top := in[j-lim]
+		pout := j - 1
+		for k := 0; k < numActive; k++ {
+			sum1 -= int32(coefs[k]) * (top - in[pout-k])
+		}
+		del := in[j] - top - ((sum1 + denHalf) >> denShift)
+		del = (del << chanShift) >> chanShift
+		pc1[j] = del
+		del0 := del
+		sg := signOfInt(del)
+		if sg > 0 {
+			for k := numActive - 1; k >= 0; k-- {
+				dd := top - in[pout-k]
+				sgn := signOfInt(dd)
+				coefs[k] -= int16(sgn)
+				del0 -= int32(numActive-k) * ((sgn * dd) >> denShift)
+				if del0 <= 0 {
+					break
+				}
+			}
+		} else if sg < 0 {
+			for k := numActive - 1; k >= 0; k-- {
+				dd := top - in[pout-k]
+				sgn := signOfInt(dd)
+				coefs[k] += int16(sgn)
+				del0 -= int32(numActive-k) * ((-sgn * dd) >> denShift)
+				if del0 >= 0 {
+					break
+				}
+			}
+		}
+	}
+}
+
+// encoder side of adaptive Golomb coding (ag_enc.c)
+func dynComp(w *bitWriter, params agParams, pc []int32, maxBits uint) {
+	mb, pb, kb, wb := params.mb, params.pb, params.kb, params.wb
+	zmode := uint32(0)
+	c := 0
+	for c < len(pc) {
+		m := mb >> qbShift
+		k := min(lg3a(m), kb)
+		m = (1 << k) - 1
+
+		del := pc[c]
+		c++
+		abs := del
+		neg := uint32(0)
+		if del < 0 {
+			abs = -del
+			neg = 1
+		}
+		n := uint32(abs)<<1 - neg - zmode
+
+		div := n / m
+		if div < maxPrefix32 {
+			mod := n - m*div
+			de := uint32(0)
+			if mod == 0 {
+				de = 1
+			}
+			numBits := div + k + 1 - de
+			if numBits <= 25 {
+				w.write(((1<<div)-1)<<(numBits-div)+mod+1-de, uint(numBits))
+			} else {
+				w.write((1<<maxPrefix32)-1, maxPrefix32)
+				w.write(n, maxBits)
+			}
+		} else {
+			w.write((1<<maxPrefix32)-1, maxPrefix32)
+			w.write(n, maxBits)
+		}
+
+		mb = pb*(n+zmode) + mb - ((pb * mb) >> qbShift)
+		if n > maxMeanClamp {
+			mb = meanClampVal
+		}
+		zmode = 0
+
+		if (mb<<mmulShift) < qb && c < len(pc) {
+			zmode = 1
+			nz := uint32(0)
+			for c < len(pc) && pc[c] == 0 {
+				c++
+				nz++
+				if nz >= 65535 {
+					zmode = 0
+					break
+				}
+			}
+			k := uint32(bits.LeadingZeros32(mb)) - bitOff + ((mb + moff) >> mdenShift)
+			mz := ((uint32(1) << k) - 1) & wb
+
+			div := nz / mz
+			mod := nz - mz*div
+			de := uint32(0)
+			if mod == 0 {
+				de = 1
+			}
+			numBits := div + k + 1 - de
+			if div < maxPrefix16 && numBits <= 25 {
+				w.write(((1<<div)-1)<<(numBits-div)+mod+1-de, uint(numBits))
+			} else {
+				w.write((1<<maxPrefix16)-1, maxPrefix16)
+				w.write(nz, maxDataBits16)
+			}
+			mb = 0
+		}
+	}
+}
+
+func testCookie(frameLength uint32, numChannels uint8) []byte {
+	cookie := make([]byte, configSize)
+	binary.BigEndian.PutUint32(cookie[0:], frameLength)
+	cookie[5] = 16 // bit depth
+	cookie[6] = 40 // pb
+	cookie[7] = 10 // mb
+	cookie[8] = 14 // kb
+	cookie[9] = numChannels
+	binary.BigEndian.PutUint16(cookie[10:], 255)
+	binary.BigEndian.PutUint32(cookie[20:], 44100)
+	return cookie
+}
+
+func Test_DecodeEscapeFrame(t *testing.T) {
+	dec, err := NewDecoder(testCookie(4, 2))
+	assert.NoError(t, err)
+
+	samples := []int32{1, -1, 32767, -32768, 100, -200, 0, 5}
+
+	w := &bitWriter{}
+	w.write(idCPE, 3)
+	w.write(0, 4)  // element instance tag
+	w.write(0, 12) // unused
+	w.write(1, 4)  // escape flag
+	for _, s := range samples {
+		w.write(uint32(s)&0xffff, 16)
+	}
+	w.write(idEND, 3)
+
+	out := make([]int32, 8)
+	n, err := dec.Decode(w.buf, out)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, samples, out)
+}
+
+func Test_DecodeCompressedFrame(t *testing.T) {
+	const frameLength = 4096
+	const numSamples = 3000
+
+	dec, err := NewDecoder(testCookie(frameLength, 2))
+	assert.NoError(t, err)
+	cfg := dec.Config()
+
+	rnd := rand.New(rand.NewSource(1))
+	left := make([]int32, numSamples)
+	right := make([]int32, numSamples)
+	for i := range left {
+		// silence in the middle exercises zero runs
+		if i > 1000 && i < 1500 {
+			continue
+		}
+		left[i] = int32(12000*math.Sin(2*math.Pi*440*float64(i)/44100)) + int32(rnd.Intn(64)-32)
+		right[i] = int32(9000*math.Sin(2*math.Pi*660*float64(i)/44100)) + int32(rnd.Intn(64)-32)
+	}
+
+	const mixBits = 2
+	const mixRes = 1
+	const denShift = 9
+	const chanBits = 17
+	initCoefs := []int16{160, -190, 170, -130}
+
+	u := make([]int32, numSamples)
+	v := make([]int32, numSamples)
+	for i := range left {
+		u[i] = (mixRes*left[i] + ((1<<mixBits)-mixRes)*right[i]) >> mixBits
+		v[i] = left[i] - right[i]
+	}
+
+	w := &bitWriter{}
+	w.write(idCPE, 3)
+	w.write(0, 4)  // element instance tag
+	w.write(0, 12) // unused
+	w.write(8, 4)  // partial frame
+	w.write(numSamples>>16, 16)
+	w.write(numSamples&0xffff, 16)
+	w.write(mixBits, 8)
+	w.write(mixRes, 8)
+	for range 2 {
+		w.write(denShift, 8) // mode 0
+		w.write(4<<5|uint32(len(initCoefs)), 8)
+		for _, c := range initCoefs {
+			w.write(uint32(uint16(c)), 16)
+		}
+	}
+
+	params := newAgParams(uint32(cfg.MB), uint32(cfg.PB)*4/4, uint32(cfg.KB))
+	for _, ch := range [][]int32{u, v} {
+		coefs := append([]int16{}, initCoefs...)
+		pc := make([]int32, numSamples)
+		pcBlock(ch, pc, numSamples, coefs, len(coefs), chanBits, denShift)
+		dynComp(w, params, pc, chanBits)
+	}
+	w.write(idEND, 3)
+
+	out := make([]int32, 2*frameLength)
+	n, err := dec.Decode(w.buf, out)
+	assert.NoError(t, err)
+	assert.Equal(t, numSamples, n)
+
+	for i := 0; i < numSamples; i++ {
+		if !assert.Equal(t, left[i], out[2*i], "left %d", i) ||
+			!assert.Equal(t, right[i], out[2*i+1], "right %d", i) {
+			break
+		}
+	}
+}
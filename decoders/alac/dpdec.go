@@ -0,0 +1,82 @@
+package alac
+
+// dynamic predictor decoding, port of dp_dec.c from Apple's ALAC reference decoder
+
+func signOfInt(i int32) int32 {
+	negishift := int32(uint32(-i) >> 31)
+	return negishift | (i >> 31)
+}
+
+// unpcBlock reverses the adaptive FIR prediction. pc1 and out may be the same
+// slice only when numActive is 31.
+func unpcBlock(pc1 []int32, out []int32, num int, coefs []int16, numActive int, chanBits uint, denShift uint) {
+	chanShift := 32 - chanBits
+	var denHalf int32
+	if denShift > 0 {
+		denHalf = 1 << (denShift - 1)
+	}
+
+	out[0] = pc1[0]
+
+	if numActive == 0 {
+		if num > 1 {
+			copy(out[1:num], pc1[1:num])
+		}
+		return
+	}
+
+	if numActive == 31 {
+		prev := out[0]
+		for j := 1; j < num; j++ {
+			del := pc1[j] + prev
+			prev = (del << chanShift) >> chanShift
+			out[j] = prev
+		}
+		return
+	}
+
+	for j := 1; j <= numActive && j < num; j++ {
+		del := pc1[j] + out[j-1]
+		out[j] = (del << chanShift) >> chanShift
+	}
+
+	lim := numActive + 1
+
+	for j := lim; j < num; j++ {
+		var sum1 int32
+		top := out[j-lim]
+		pout := j - 1
+
+		for k := 0; k < numActive; k++ {
+			sum1 += int32(coefs[k]) * (out[pout-k] - top)
+		}
+
+		del := pc1[j]
+		del0 := del
+		sg := signOfInt(del)
+		del += top + ((sum1 + denHalf) >> denShift)
+		out[j] = (del << chanShift) >> chanShift
+
+		if sg > 0 {
+			for k := numActive - 1; k >= 0; k-- {
+				dd := top - out[pout-k]
+				sgn := signOfInt(dd)
+				coefs[k] -= int16(sgn)
+				del0 -= int32(numActive-k) * ((sgn * dd) >> denShift)
+				if del0 <= 0 {
+					break
+				}
+			}
+		} else if sg < 0 {
+			for k := numActive - 1; k >= 0; k-- {
+				dd := top - out[pout-k]
+				sgn := signOfInt(dd)
+				coefs[k] += int16(sgn)
+				del0 -= int32(numActive-k) * ((-sgn * dd) >> denShift)
+				if del0 >= 0 {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package decoders
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/drgolem/ringbuffer"
+
+	"github.com/drgolem/musiclab/decoders/alac"
+	"github.com/drgolem/musiclab/decoders/mp4"
+)
+
+type m4aDecoder struct {
+	file       *os.File
+	track      *mp4.Track
+	decoder    *alac.Decoder
+	ringBuffer ringbuffer.RingBuffer
+	channels   int
+	bitDepth   int
+	sampleRate int
+	samplesReq int
+
+	sampleIdx     int
+	skipSamples   int
+	currentSample int64
+
+	packet []byte
+	pcm    []int32
+}
+
+func NewM4aDecoder() (*m4aDecoder, error) {
+	dec := m4aDecoder{}
+
+	return &dec, nil
+}
+
+func (d *m4aDecoder) Open(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+
+	mp4File, err := mp4.Parse(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	track, err := mp4File.AudioTrack()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if track.SampleEntry.Format != "alac" {
+		f.Close()
+		return fmt.Errorf("unsupported m4a codec: %s", track.SampleEntry.Format)
+	}
+
+	decoder, err := alac.NewDecoder(track.SampleEntry.DecoderConfig)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	cfg := decoder.Config()
+
+	d.file = f
+	d.track = track
+	d.decoder = decoder
+	d.channels = int(cfg.NumChannels)
+	d.bitDepth = int(cfg.BitDepth)
+	d.sampleRate = int(cfg.SampleRate)
+	if d.sampleRate == 0 {
+		d.sampleRate = track.SampleEntry.SampleRate
+	}
+
+	d.samplesReq = 4096
+	frameLen := int(cfg.FrameLength)
+	d.pcm = make([]int32, frameLen*d.channels)
+	d.ringBuffer = ringbuffer.NewRingBuffer(2 * d.channels * (frameLen + d.samplesReq))
+
+	return nil
+}
+
+func (d *m4aDecoder) Close() error {
+	if d.file != nil {
+		return d.file.Close()
+	}
+	return nil
+}
+
+func (d *m4aDecoder) GetFormat() (int, int, int) {
+	return d.sampleRate, d.channels, 16
+}
+
+func (d *m4aDecoder) DecodeSamples(samples int, audio []byte) (int, error) {
+	outputBytesPerSample := 2
+	frameBytes := d.channels * outputBytesPerSample
+
+	if samples > d.samplesReq {
+		samples = d.samplesReq
+	}
+
+	for {
+		samplesAvail := d.ringBuffer.Size() / frameBytes
+		eof := d.sampleIdx >= len(d.track.Samples)
+		if samplesAvail >= samples || (eof && samplesAvail > 0) {
+			samplesRead := min(samples, samplesAvail)
+			_, err := d.ringBuffer.Read(samplesRead*frameBytes, audio)
+			if err != nil {
+				return 0, err
+			}
+			d.currentSample += int64(samplesRead)
+			return samplesRead, nil
+		}
+		if eof {
+			return 0, nil
+		}
+
+		nSamples, err := d.decodePacket()
+		if err != nil {
+			return 0, err
+		}
+
+		// drop samples before seek position
+		skip := min(d.skipSamples, nSamples)
+		d.skipSamples -= skip
+
+		shift := d.bitDepth - 16
+		var b16 [2]byte
+		for idx := skip * d.channels; idx < nSamples*d.channels; idx++ {
+			sv := d.pcm[idx] >> shift
+
+			b16[0] = byte(sv & 0xFF)
+			b16[1] = byte(sv >> 8)
+			d.ringBuffer.Write(b16[:2])
+		}
+	}
+}
+
+// Seek sets position in PCM frames
+func (d *m4aDecoder) Seek(offset int64, whence int) (int64, error) {
+	pos := offset
+	switch whence {
+	case io.SeekCurrent:
+		pos = d.currentSample + offset
+	case io.SeekEnd:
+		pos = int64(d.lengthInSamples()) + offset
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	// sample table is in track timescale units
+	ts := uint64(pos)
+	if d.track.Timescale != 0 && int(d.track.Timescale) != d.sampleRate {
+		ts = uint64(float64(pos) * float64(d.track.Timescale) / float64(d.sampleRate))
+	}
+	idx, packetOffset := d.track.FindSample(ts)
+	if d.track.Timescale != 0 && int(d.track.Timescale) != d.sampleRate {
+		packetOffset = uint64(float64(packetOffset) * float64(d.sampleRate) / float64(d.track.Timescale))
+	}
+
+	d.sampleIdx = idx
+	d.skipSamples = int(packetOffset)
+	d.currentSample = pos
+	d.ringBuffer.Reset()
+
+	return d.currentSample, nil
+}
+
+// TotalSamples returns number of samples in the track
+func (d *m4aDecoder) TotalSamples() int64 {
+	if d.track == nil {
+		return 0
+	}
+	return int64(d.lengthInSamples())
+}
+
+func (d *m4aDecoder) lengthInSamples() uint64 {
+	if len(d.track.Samples) == 0 {
+		return 0
+	}
+	last := d.track.Samples[len(d.track.Samples)-1]
+	length := last.Time + uint64(last.Duration)
+	if d.track.Timescale != 0 && int(d.track.Timescale) != d.sampleRate {
+		length = uint64(float64(length) * float64(d.sampleRate) / float64(d.track.Timescale))
+	}
+	return length
+}
+
+func (d *m4aDecoder) decodePacket() (int, error) {
+	sample := d.track.Samples[d.sampleIdx]
+	d.sampleIdx++
+
+	if cap(d.packet) < int(sample.Size) {
+		d.packet = make([]byte, sample.Size)
+	}
+	d.packet = d.packet[:sample.Size]
+
+	_, err := d.file.ReadAt(d.packet, sample.Offset)
+	if err != nil {
+		return 0, err
+	}
+
+	return d.decoder.Decode(d.packet, d.pcm)
+}
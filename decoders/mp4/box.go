@@ -0,0 +1,117 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// box is a parsed MP4 box (atom) header with its payload
+type box struct {
+	Type    string
+	Payload []byte
+}
+
+// readBoxHeader reads box header from reader.
+// Returns box type, header size and total box size (0 - box extends to the end of file).
+func readBoxHeader(r io.Reader) (string, int64, int64, error) {
+	var hdr [8]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", 0, 0, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(hdr[0:4]))
+	boxType := string(hdr[4:8])
+	hdrSize := int64(8)
+
+	if size == 1 {
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return "", 0, 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(ext[:]))
+		hdrSize += 8
+	}
+
+	if size != 0 && size < hdrSize {
+		return "", 0, 0, fmt.Errorf("mp4: invalid box size %d, type: %q", size, boxType)
+	}
+
+	return boxType, hdrSize, size, nil
+}
+
+// parseBoxes splits buffer into a list of child boxes
+func parseBoxes(data []byte) ([]box, error) {
+	boxes := make([]box, 0)
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			// some writers pad containers with zero bytes
+			break
+		}
+		size := uint64(binary.BigEndian.Uint32(data[0:4]))
+		boxType := string(data[4:8])
+		hdrSize := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return nil, fmt.Errorf("mp4: truncated box: %q", boxType)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+			hdrSize = 16
+		}
+
+		if size < hdrSize || size > uint64(len(data)) {
+			return nil, fmt.Errorf("mp4: invalid box size %d, type: %q", size, boxType)
+		}
+
+		boxes = append(boxes, box{
+			Type:    boxType,
+			Payload: data[hdrSize:size],
+		})
+
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+func findBox(boxes []box, boxType string) (box, bool) {
+	for _, b := range boxes {
+		if b.Type == boxType {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// findPath returns first box at a given path, e.g. "mdia", "minf", "stbl"
+func findPath(boxes []box, path ...string) (box, bool) {
+	var b box
+	for idx, boxType := range path {
+		var ok bool
+		b, ok = findBox(boxes, boxType)
+		if !ok {
+			return b, false
+		}
+		if idx < len(path)-1 {
+			var err error
+			boxes, err = parseBoxes(b.Payload)
+			if err != nil {
+				return b, false
+			}
+		}
+	}
+	return b, true
+}
+
+// fullBoxPayload skips version and flags of a full box
+func fullBoxPayload(b box) (byte, []byte, error) {
+	if len(b.Payload) < 4 {
+		return 0, nil, fmt.Errorf("mp4: truncated full box: %q", b.Type)
+	}
+	return b.Payload[0], b.Payload[4:], nil
+}
@@ -0,0 +1,82 @@
+package mp4
+
+import (
+	"strings"
+)
+
+// iTunes metadata item types
+const (
+	itemTitle       = "\xa9nam"
+	itemArtist      = "\xa9ART"
+	itemAlbumArtist = "aART"
+	itemAlbum       = "\xa9alb"
+)
+
+func parseMeta(meta box) (Metadata, error) {
+	var md Metadata
+
+	// ISO 'meta' is a full box, QuickTime 'meta' is a plain container
+	payload := meta.Payload
+	if len(payload) >= 8 && string(payload[4:8]) != "hdlr" {
+		payload = payload[4:]
+	}
+
+	boxes, err := parseBoxes(payload)
+	if err != nil {
+		return md, err
+	}
+
+	ilst, ok := findBox(boxes, "ilst")
+	if !ok {
+		return md, nil
+	}
+
+	items, err := parseBoxes(ilst.Payload)
+	if err != nil {
+		return md, err
+	}
+
+	for _, item := range items {
+		value, ok := itemData(item)
+		if !ok {
+			continue
+		}
+
+		switch item.Type {
+		case itemTitle:
+			md.Title = itemText(value)
+		case itemArtist:
+			md.Artist = itemText(value)
+		case itemAlbumArtist:
+			md.AlbumArtist = itemText(value)
+		case itemAlbum:
+			md.Album = itemText(value)
+		}
+	}
+
+	if md.Artist == "" {
+		md.Artist = md.AlbumArtist
+	}
+
+	return md, nil
+}
+
+// itemData returns value of the first 'data' box of the metadata item
+func itemData(item box) ([]byte, bool) {
+	children, err := parseBoxes(item.Payload)
+	if err != nil {
+		return nil, false
+	}
+	data, ok := findBox(children, "data")
+	if !ok || len(data.Payload) < 8 {
+		return nil, false
+	}
+
+	// 1 byte version, 3 bytes type, 4 bytes locale
+	return data.Payload[8:], true
+}
+
+func itemText(value []byte) string {
+	s := strings.ReplaceAll(string(value), "\x00", "")
+	return strings.ToValidUTF8(s, "")
+}
@@ -0,0 +1,550 @@
+package mp4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+const maxMoovSize = 256 << 20
+
+var ErrNoAudioTrack = errors.New("mp4: no audio track")
+
+// SampleEntry describes coded audio format of the track (stsd entry)
+type SampleEntry struct {
+	// Format is a codec four character code: alac, mp4a, ...
+	Format        string
+	Channels      int
+	BitsPerSample int
+	SampleRate    int
+	// DecoderConfig is a payload of codec configuration box
+	// ('alac' magic cookie or 'esds' descriptor) without version and flags
+	DecoderConfig []byte
+}
+
+// Sample is a single coded packet location in the file
+type Sample struct {
+	Offset int64
+	Size   uint32
+	// Time is a decoding timestamp in track timescale units
+	Time     uint64
+	Duration uint32
+}
+
+type Track struct {
+	ID          uint32
+	HandlerType string
+	Timescale   uint32
+	// Duration in track timescale units
+	Duration    uint64
+	SampleEntry SampleEntry
+	Samples     []Sample
+}
+
+type Metadata struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+}
+
+type File struct {
+	Brand    string
+	Tracks   []Track
+	Metadata Metadata
+}
+
+// ParseFile parses MP4 container structure of a given file.
+func ParseFile(fileName string) (*File, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse parses MP4 container: file type, tracks sample tables and iTunes metadata.
+// Media data is not loaded.
+func Parse(r io.ReadSeeker) (*File, error) {
+	mp4File := File{}
+
+	var moov []byte
+	// sample table is checked against media data size
+	var mediaSize int64
+	pos := int64(0)
+	for {
+		boxType, hdrSize, size, err := readBoxHeader(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			// box extends to the end of file
+			end, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			size = end - pos
+			if _, err := r.Seek(pos+hdrSize, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		switch boxType {
+		case "ftyp":
+			payload := make([]byte, size-hdrSize)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return nil, err
+			}
+			if len(payload) >= 4 {
+				mp4File.Brand = string(payload[0:4])
+			}
+		case "moov":
+			if size-hdrSize > maxMoovSize {
+				return nil, fmt.Errorf("mp4: moov box too large: %d", size)
+			}
+			moov = make([]byte, size-hdrSize)
+			if _, err := io.ReadFull(r, moov); err != nil {
+				return nil, err
+			}
+		case "mdat":
+			mediaSize += size - hdrSize
+			if _, err := r.Seek(pos+size, io.SeekStart); err != nil {
+				return nil, err
+			}
+		default:
+			if _, err := r.Seek(pos+size, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		pos += size
+	}
+
+	if moov == nil {
+		return nil, fmt.Errorf("mp4: moov box not found")
+	}
+
+	moovBoxes, err := parseBoxes(moov)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range moovBoxes {
+		switch b.Type {
+		case "trak":
+			track, err := parseTrack(b, mediaSize)
+			if err != nil {
+				return nil, err
+			}
+			mp4File.Tracks = append(mp4File.Tracks, track)
+		case "udta":
+			udta, err := parseBoxes(b.Payload)
+			if err != nil {
+				return nil, err
+			}
+			if meta, ok := findBox(udta, "meta"); ok {
+				mp4File.Metadata, err = parseMeta(meta)
+				if err != nil {
+					return nil, err
+				}
+			}
+		case "meta":
+			mp4File.Metadata, err = parseMeta(b)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &mp4File, nil
+}
+
+// AudioTrack returns first sound track of the file
+func (f *File) AudioTrack() (*Track, error) {
+	for idx := range f.Tracks {
+		if f.Tracks[idx].HandlerType == "soun" {
+			return &f.Tracks[idx], nil
+		}
+	}
+	return nil, ErrNoAudioTrack
+}
+
+// Length returns track duration
+func (t *Track) Length() time.Duration {
+	if t.Timescale == 0 {
+		return 0
+	}
+	dur := t.Duration
+	if dur == 0 && len(t.Samples) > 0 {
+		last := t.Samples[len(t.Samples)-1]
+		dur = last.Time + uint64(last.Duration)
+	}
+	return time.Duration(float64(dur) / float64(t.Timescale) * float64(time.Second))
+}
+
+// FindSample returns index of the sample containing timestamp ts
+// (in track timescale units) and offset of ts from the sample start.
+// Returns len(Samples) if ts is beyond the end of the track.
+func (t *Track) FindSample(ts uint64) (int, uint64) {
+	idx := sort.Search(len(t.Samples), func(i int) bool {
+		s := t.Samples[i]
+		return s.Time+uint64(s.Duration) > ts
+	})
+	if idx == len(t.Samples) {
+		return idx, 0
+	}
+	return idx, ts - t.Samples[idx].Time
+}
+
+func parseTrack(trak box, mediaSize int64) (Track, error) {
+	var track Track
+
+	boxes, err := parseBoxes(trak.Payload)
+	if err != nil {
+		return track, err
+	}
+
+	if tkhd, ok := findBox(boxes, "tkhd"); ok {
+		version, p, err := fullBoxPayload(tkhd)
+		if err != nil {
+			return track, err
+		}
+		// creation and modification time precede track ID
+		idOffset := 8
+		if version == 1 {
+			idOffset = 16
+		}
+		if len(p) >= idOffset+4 {
+			track.ID = binary.BigEndian.Uint32(p[idOffset:])
+		}
+	}
+
+	if mdhd, ok := findPath(boxes, "mdia", "mdhd"); ok {
+		version, p, err := fullBoxPayload(mdhd)
+		if err != nil {
+			return track, err
+		}
+		if version == 1 {
+			if len(p) < 28 {
+				return track, fmt.Errorf("mp4: truncated mdhd")
+			}
+			track.Timescale = binary.BigEndian.Uint32(p[16:20])
+			track.Duration = binary.BigEndian.Uint64(p[20:28])
+		} else {
+			if len(p) < 16 {
+				return track, fmt.Errorf("mp4: truncated mdhd")
+			}
+			track.Timescale = binary.BigEndian.Uint32(p[8:12])
+			track.Duration = uint64(binary.BigEndian.Uint32(p[12:16]))
+		}
+	}
+
+	if hdlr, ok := findPath(boxes, "mdia", "hdlr"); ok {
+		_, p, err := fullBoxPayload(hdlr)
+		if err != nil {
+			return track, err
+		}
+		if len(p) >= 8 {
+			track.HandlerType = string(p[4:8])
+		}
+	}
+
+	stbl, ok := findPath(boxes, "mdia", "minf", "stbl")
+	if !ok {
+		return track, nil
+	}
+
+	stblBoxes, err := parseBoxes(stbl.Payload)
+	if err != nil {
+		return track, err
+	}
+
+	if stsd, ok := findBox(stblBoxes, "stsd"); ok {
+		track.SampleEntry, err = parseStsd(stsd)
+		if err != nil {
+			return track, err
+		}
+	}
+
+	track.Samples, err = parseSampleTable(stblBoxes, mediaSize)
+	if err != nil {
+		return track, err
+	}
+
+	return track, nil
+}
+
+func parseStsd(stsd box) (SampleEntry, error) {
+	var se SampleEntry
+
+	_, p, err := fullBoxPayload(stsd)
+	if err != nil {
+		return se, err
+	}
+	if len(p) < 4 {
+		return se, fmt.Errorf("mp4: truncated stsd")
+	}
+
+	entries, err := parseBoxes(p[4:])
+	if err != nil {
+		return se, err
+	}
+	if len(entries) == 0 {
+		return se, fmt.Errorf("mp4: empty stsd")
+	}
+
+	entry := entries[0]
+	se.Format = entry.Type
+
+	// audio sample entry
+	const audioEntrySize = 28
+	p = entry.Payload
+	if len(p) < audioEntrySize {
+		return se, fmt.Errorf("mp4: truncated audio sample entry: %q", entry.Type)
+	}
+
+	version := binary.BigEndian.Uint16(p[8:10])
+	se.Channels = int(binary.BigEndian.Uint16(p[16:18]))
+	se.BitsPerSample = int(binary.BigEndian.Uint16(p[18:20]))
+	se.SampleRate = int(binary.BigEndian.Uint32(p[24:28]) >> 16)
+
+	childOffset := audioEntrySize
+	switch version {
+	case 1:
+		// QuickTime sound description v1
+		childOffset += 16
+	case 2:
+		// QuickTime sound description v2
+		childOffset += 36
+		if len(p) >= childOffset {
+			ext := p[audioEntrySize:]
+			se.SampleRate = int(math.Float64frombits(binary.BigEndian.Uint64(ext[4:12])))
+			se.Channels = int(binary.BigEndian.Uint32(ext[12:16]))
+			se.BitsPerSample = int(binary.BigEndian.Uint32(ext[20:24]))
+		}
+	}
+	if len(p) < childOffset {
+		return se, fmt.Errorf("mp4: truncated audio sample entry: %q", entry.Type)
+	}
+
+	children, err := parseBoxes(p[childOffset:])
+	if err != nil {
+		return se, err
+	}
+
+	var cfg box
+	var found bool
+	switch se.Format {
+	case "alac":
+		cfg, found = findBox(children, "alac")
+		if !found {
+			cfg, found = findPath(children, "wave", "alac")
+		}
+	case "mp4a":
+		cfg, found = findBox(children, "esds")
+		if !found {
+			cfg, found = findPath(children, "wave", "esds")
+		}
+	}
+	if found {
+		_, se.DecoderConfig, err = fullBoxPayload(cfg)
+		if err != nil {
+			return se, err
+		}
+	}
+
+	return se, nil
+}
+
+func parseSampleTable(stblBoxes []box, mediaSize int64) ([]Sample, error) {
+	// sample sizes
+	var sampleSizes []uint32
+	if stsz, ok := findBox(stblBoxes, "stsz"); ok {
+		_, p, err := fullBoxPayload(stsz)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 8 {
+			return nil, fmt.Errorf("mp4: truncated stsz")
+		}
+		sampleSize := binary.BigEndian.Uint32(p[0:4])
+		sampleCount := int(binary.BigEndian.Uint32(p[4:8]))
+		if sampleSize == 0 && len(p) < 8+4*sampleCount {
+			return nil, fmt.Errorf("mp4: truncated stsz")
+		}
+		if sampleSize != 0 && int64(sampleCount) > mediaSize/int64(sampleSize) {
+			return nil, fmt.Errorf("mp4: stsz samples exceed media data: %d", sampleCount)
+		}
+		sampleSizes = make([]uint32, sampleCount)
+		for i := range sampleSizes {
+			if sampleSize != 0 {
+				sampleSizes[i] = sampleSize
+			} else {
+				sampleSizes[i] = binary.BigEndian.Uint32(p[8+4*i:])
+			}
+		}
+	} else if stz2, ok := findBox(stblBoxes, "stz2"); ok {
+		_, p, err := fullBoxPayload(stz2)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 8 {
+			return nil, fmt.Errorf("mp4: truncated stz2")
+		}
+		fieldSize := int(p[3])
+		if fieldSize != 4 && fieldSize != 8 && fieldSize != 16 {
+			return nil, fmt.Errorf("mp4: invalid stz2 field size: %d", fieldSize)
+		}
+		sampleCount := int(binary.BigEndian.Uint32(p[4:8]))
+		if len(p) < 8+(fieldSize*sampleCount+7)/8 {
+			return nil, fmt.Errorf("mp4: truncated stz2")
+		}
+		sampleSizes = make([]uint32, sampleCount)
+		for i := range sampleSizes {
+			switch fieldSize {
+			case 4:
+				v := p[8+i/2]
+				if i%2 == 0 {
+					v >>= 4
+				}
+				sampleSizes[i] = uint32(v & 0xf)
+			case 8:
+				sampleSizes[i] = uint32(p[8+i])
+			case 16:
+				sampleSizes[i] = uint32(binary.BigEndian.Uint16(p[8+2*i:]))
+			}
+		}
+	}
+
+	// chunk offsets
+	var chunkOffsets []int64
+	if stco, ok := findBox(stblBoxes, "stco"); ok {
+		_, p, err := fullBoxPayload(stco)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 4 {
+			return nil, fmt.Errorf("mp4: truncated stco")
+		}
+		cnt := int(binary.BigEndian.Uint32(p[0:4]))
+		if len(p) < 4+4*cnt {
+			return nil, fmt.Errorf("mp4: truncated stco")
+		}
+		chunkOffsets = make([]int64, cnt)
+		for i := range chunkOffsets {
+			chunkOffsets[i] = int64(binary.BigEndian.Uint32(p[4+4*i:]))
+		}
+	} else if co64, ok := findBox(stblBoxes, "co64"); ok {
+		_, p, err := fullBoxPayload(co64)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 4 {
+			return nil, fmt.Errorf("mp4: truncated co64")
+		}
+		cnt := int(binary.BigEndian.Uint32(p[0:4]))
+		if len(p) < 4+8*cnt {
+			return nil, fmt.Errorf("mp4: truncated co64")
+		}
+		chunkOffsets = make([]int64, cnt)
+		for i := range chunkOffsets {
+			chunkOffsets[i] = int64(binary.BigEndian.Uint64(p[4+8*i:]))
+		}
+	}
+
+	// sample to chunk
+	type stscEntry struct {
+		firstChunk      int
+		samplesPerChunk int
+	}
+	stscEntries := make([]stscEntry, 0)
+	if stsc, ok := findBox(stblBoxes, "stsc"); ok {
+		_, p, err := fullBoxPayload(stsc)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 4 {
+			return nil, fmt.Errorf("mp4: truncated stsc")
+		}
+		cnt := int(binary.BigEndian.Uint32(p[0:4]))
+		if len(p) < 4+12*cnt {
+			return nil, fmt.Errorf("mp4: truncated stsc")
+		}
+		for i := 0; i < cnt; i++ {
+			e := p[4+12*i:]
+			stscEntries = append(stscEntries, stscEntry{
+				firstChunk:      int(binary.BigEndian.Uint32(e[0:4])),
+				samplesPerChunk: int(binary.BigEndian.Uint32(e[4:8])),
+			})
+		}
+	}
+
+	// time to sample
+	sampleDurations := make([]uint32, 0, len(sampleSizes))
+	if stts, ok := findBox(stblBoxes, "stts"); ok {
+		_, p, err := fullBoxPayload(stts)
+		if err != nil {
+			return nil, err
+		}
+		if len(p) < 4 {
+			return nil, fmt.Errorf("mp4: truncated stts")
+		}
+		cnt := int(binary.BigEndian.Uint32(p[0:4]))
+		if len(p) < 4+8*cnt {
+			return nil, fmt.Errorf("mp4: truncated stts")
+		}
+		for i := 0; i < cnt; i++ {
+			e := p[4+8*i:]
+			sampleCount := int(binary.BigEndian.Uint32(e[0:4]))
+			sampleDelta := binary.BigEndian.Uint32(e[4:8])
+			for j := 0; j < sampleCount && len(sampleDurations) < len(sampleSizes); j++ {
+				sampleDurations = append(sampleDurations, sampleDelta)
+			}
+		}
+	}
+
+	samples := make([]Sample, 0, len(sampleSizes))
+	sampleIdx := 0
+	stscIdx := 0
+	ts := uint64(0)
+	for chunkIdx, chunkOffset := range chunkOffsets {
+		chunkNum := chunkIdx + 1
+		for stscIdx+1 < len(stscEntries) && stscEntries[stscIdx+1].firstChunk <= chunkNum {
+			stscIdx++
+		}
+		samplesPerChunk := 0
+		if len(stscEntries) > 0 && stscEntries[stscIdx].firstChunk <= chunkNum {
+			samplesPerChunk = stscEntries[stscIdx].samplesPerChunk
+		}
+
+		offset := chunkOffset
+		for j := 0; j < samplesPerChunk && sampleIdx < len(sampleSizes); j++ {
+			dur := uint32(0)
+			if sampleIdx < len(sampleDurations) {
+				dur = sampleDurations[sampleIdx]
+			}
+			samples = append(samples, Sample{
+				Offset:   offset,
+				Size:     sampleSizes[sampleIdx],
+				Time:     ts,
+				Duration: dur,
+			})
+			offset += int64(sampleSizes[sampleIdx])
+			ts += uint64(dur)
+			sampleIdx++
+		}
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,132 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mkBox(boxType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	out = append(out, boxType...)
+	return append(out, data...)
+}
+
+func mkFullBox(boxType string, payload ...[]byte) []byte {
+	return mkBox(boxType, append([][]byte{{0, 0, 0, 0}}, payload...)...)
+}
+
+func u32(vals ...uint32) []byte {
+	out := make([]byte, 0)
+	for _, v := range vals {
+		out = binary.BigEndian.AppendUint32(out, v)
+	}
+	return out
+}
+
+func mkDataItem(itemType string, dataType uint32, value []byte) []byte {
+	return mkBox(itemType, mkBox("data", u32(dataType, 0), value))
+}
+
+func Test_ParseAlacM4a(t *testing.T) {
+	cookie := make([]byte, 24)
+	binary.BigEndian.PutUint32(cookie[0:], 4096)
+
+	audioEntry := make([]byte, 28)
+	binary.BigEndian.PutUint16(audioEntry[6:], 1)   // data reference index
+	binary.BigEndian.PutUint16(audioEntry[16:], 2)  // channels
+	binary.BigEndian.PutUint16(audioEntry[18:], 16) // sample size
+	binary.BigEndian.PutUint32(audioEntry[24:], 44100<<16)
+
+	stbl := mkBox("stbl",
+		mkFullBox("stsd", u32(1), mkBox("alac", audioEntry, mkFullBox("alac", cookie))),
+		mkFullBox("stts", u32(2, 4, 4096, 1, 100)),
+		mkFullBox("stsc", u32(2, 1, 3, 1, 2, 2, 1)),
+		mkFullBox("stsz", u32(0, 5, 10, 11, 12, 13, 14)),
+		mkFullBox("stco", u32(2, 1000, 2000)),
+	)
+
+	trak := mkBox("trak",
+		mkFullBox("tkhd", u32(0, 0, 7)),
+		mkBox("mdia",
+			mkFullBox("mdhd", u32(0, 0, 44100, 4*4096+100)),
+			mkFullBox("hdlr", u32(0), []byte("soun")),
+			mkBox("minf", stbl),
+		),
+	)
+
+	udta := mkBox("udta",
+		mkFullBox("meta",
+			mkFullBox("hdlr", u32(0), []byte("mdir")),
+			mkBox("ilst",
+				mkDataItem("\xa9nam", 1, []byte("Title")),
+				mkDataItem("\xa9ART", 1, []byte("Artist")),
+				mkDataItem("\xa9alb", 1, []byte("Album")),
+			),
+		),
+	)
+
+	data := bytes.Join([][]byte{
+		mkBox("ftyp", []byte("M4A "), u32(0)),
+		mkBox("moov", trak, udta),
+		mkBox("mdat", make([]byte, 16)),
+	}, nil)
+
+	f, err := Parse(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "M4A ", f.Brand)
+	assert.Equal(t, "Title", f.Metadata.Title)
+	assert.Equal(t, "Artist", f.Metadata.Artist)
+	assert.Equal(t, "Album", f.Metadata.Album)
+
+	track, err := f.AudioTrack()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(7), track.ID)
+	assert.Equal(t, uint32(44100), track.Timescale)
+	assert.Equal(t, "alac", track.SampleEntry.Format)
+	assert.Equal(t, 2, track.SampleEntry.Channels)
+	assert.Equal(t, 44100, track.SampleEntry.SampleRate)
+	assert.Equal(t, cookie, track.SampleEntry.DecoderConfig)
+
+	expSamples := []Sample{
+		{Offset: 1000, Size: 10, Time: 0, Duration: 4096},
+		{Offset: 1010, Size: 11, Time: 4096, Duration: 4096},
+		{Offset: 1021, Size: 12, Time: 8192, Duration: 4096},
+		{Offset: 2000, Size: 13, Time: 12288, Duration: 4096},
+		{Offset: 2013, Size: 14, Time: 16384, Duration: 100},
+	}
+	assert.Equal(t, expSamples, track.Samples)
+
+	idx, offset := track.FindSample(5000)
+	assert.Equal(t, 1, idx)
+	assert.Equal(t, uint64(5000-4096), offset)
+
+	idx, _ = track.FindSample(4*4096 + 100)
+	assert.Equal(t, len(expSamples), idx)
+}
+
+func Test_ParseSampleTableCount(t *testing.T) {
+	stbl, err := parseBoxes(bytes.Join([][]byte{
+		mkFullBox("stsz", u32(100, 0xffffffff)),
+	}, nil))
+	assert.NoError(t, err)
+
+	_, err = parseSampleTable(stbl, 1000)
+	assert.Error(t, err)
+
+	stbl, err = parseBoxes(bytes.Join([][]byte{
+		mkFullBox("stts", u32(1, 10, 1024)),
+		mkFullBox("stsc", u32(1, 1, 10, 1)),
+		mkFullBox("stsz", u32(100, 10)),
+		mkFullBox("stco", u32(1, 0)),
+	}, nil))
+	assert.NoError(t, err)
+
+	samples, err := parseSampleTable(stbl, 1000)
+	assert.NoError(t, err)
+	assert.Len(t, samples, 10)
+}
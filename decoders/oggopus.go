@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"os"
 
 	"github.com/drgolem/go-ogg/ogg"
@@ -65,8 +64,6 @@ func (d *oggOpusDecoder) Open(fileName string) error {
 				}
 			}
 
-			fmt.Printf("stream type: %v\n", streamType)
-
 			switch streamType {
 			case StreamType_Opus:
 				headersCount = 2
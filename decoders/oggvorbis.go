@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"fmt"
 	"math"
 	"os"
 
@@ -73,8 +72,6 @@ func (d *oggVorbisDecoder) Open(fileName string) error {
 				}
 			}
 
-			fmt.Printf("stream type: %v\n", streamType)
-
 			switch streamType {
 			case StreamType_Vorbis:
 				headersCount = 3
@@ -2,6 +2,7 @@ package decoders
 
 import (
 	"io"
+	"math"
 	"os"
 
 	"github.com/drgolem/ringbuffer"
@@ -102,6 +103,28 @@ func (wd *wavDecoder) Open(fileName string) error {
 	return nil
 }
 
+// TotalSamples returns number of samples in the data chunk, 0 if unknown
+func (wd *wavDecoder) TotalSamples() int64 {
+	if wd.reader == nil {
+		return 0
+	}
+
+	ft, err := wd.reader.Format()
+	if err != nil || ft.BlockAlign == 0 {
+		return 0
+	}
+	// Duration loads data chunk header
+	if _, err := wd.reader.Duration(); err != nil {
+		return 0
+	}
+	if wd.reader.WavData.Size == math.MaxUint32 {
+		// streamed wav, size was not patched
+		return 0
+	}
+
+	return int64(wd.reader.WavData.Size) / int64(ft.BlockAlign)
+}
+
 func (wd *wavDecoder) Close() error {
 	if wd.file != nil {
 		return wd.file.Close()
@@ -0,0 +1,269 @@
+package dsp
+
+import (
+	"math"
+	"slices"
+
+	"gonum.org/v1/gonum/dsp/window"
+)
+
+// ChromaNoteNames are names of 12 chroma bins, bin 0 is C
+var ChromaNoteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+type ChromaNorm int
+
+const (
+	// ChromaNormMax scales frame maximum to 1
+	ChromaNormMax ChromaNorm = iota
+	ChromaNormL1
+	ChromaNormL2
+	ChromaNormNone
+)
+
+// c4Freq is C4 frequency for A4 = 440 Hz
+var c4Freq = 440 * math.Pow(2, -9.0/12)
+
+// Chroma folds spectra into pitch classes
+type Chroma struct {
+	SampleRate int
+	// number of chroma bins per octave, bin 0 is C
+	NumChroma int
+	// tuning offset in semitones (-0.5..0.5), positive when instruments
+	// are tuned sharp
+	Tuning float64
+	// analyzed frequency range
+	MinFreq float64
+	MaxFreq float64
+	// log(1 + LogCompression*x) compression of energies, 0 - no compression
+	LogCompression float64
+	Norm           ChromaNorm
+}
+
+// NewChroma returns 12 bin chroma for frequencies C2..C8 with max norm
+func NewChroma(sampleRate int) *Chroma {
+	c := &Chroma{
+		SampleRate: sampleRate,
+		NumChroma:  12,
+		MinFreq:    c4Freq / 4,
+		MaxFreq:    c4Freq * 16,
+		Norm:       ChromaNormMax,
+	}
+
+	return c
+}
+
+// bin returns chroma bin of the frequency
+func (c *Chroma) bin(freq float64) int {
+	pos := float64(c.NumChroma)*math.Log2(freq/c4Freq) - c.Tuning*float64(c.NumChroma)/12
+	bin := int(math.Round(pos)) % c.NumChroma
+	if bin < 0 {
+		bin += c.NumChroma
+	}
+	return bin
+}
+
+// FromSpectrogram returns chroma frames of amplitude spectrogram of nfft
+// points STFT (as returned by SplitSpectrogram)
+func (c *Chroma) FromSpectrogram(amp [][]float64, nfft int) [][]float64 {
+	power := make([][]float64, len(amp))
+	for i, frame := range amp {
+		power[i] = make([]float64, len(frame))
+		for k, a := range frame {
+			power[i][k] = a * a
+		}
+	}
+
+	return c.FromPowerSpectrogram(power, nfft)
+}
+
+// FromPowerSpectrogram returns chroma frames of power spectrogram of nfft
+// points STFT, chroma bins are sums of FFT bins energies
+func (c *Chroma) FromPowerSpectrogram(power [][]float64, nfft int) [][]float64 {
+	numBins := nfft/2 + 1
+
+	// chroma bin of each FFT bin, -1 for bins out of range
+	binChroma := make([]int, numBins)
+	for k := range binChroma {
+		freq := float64(k) * float64(c.SampleRate) / float64(nfft)
+		binChroma[k] = -1
+		if freq >= c.MinFreq && freq <= c.MaxFreq && freq > 0 {
+			binChroma[k] = c.bin(freq)
+		}
+	}
+
+	chroma := create2DSlice(len(power), c.NumChroma)
+	for i, frame := range power {
+		for k, e := range frame[:min(len(frame), numBins)] {
+			if binChroma[k] >= 0 {
+				chroma[i][binChroma[k]] += e
+			}
+		}
+		c.finish(chroma[i])
+	}
+
+	return chroma
+}
+
+// FromCQT returns chroma frames of CQT amplitude spectrogram, CQT bins per
+// octave must be a multiple of NumChroma and CQT must start at a C note
+func (c *Chroma) FromCQT(cqt *CQT, amp [][]float64) [][]float64 {
+	freqs := cqt.Frequencies()
+
+	chroma := create2DSlice(len(amp), c.NumChroma)
+	for i, frame := range amp {
+		for k, a := range frame {
+			if freqs[k] < c.MinFreq || freqs[k] > c.MaxFreq {
+				continue
+			}
+			chroma[i][c.bin(freqs[k])] += a * a
+		}
+		c.finish(chroma[i])
+	}
+
+	return chroma
+}
+
+// finish compresses and normalizes chroma frame
+func (c *Chroma) finish(frame []float64) {
+	if c.LogCompression > 0 {
+		for j, v := range frame {
+			frame[j] = math.Log1p(c.LogCompression * v)
+		}
+	}
+	NormalizeVector(frame, c.Norm)
+}
+
+// NormalizeVector normalizes vector in place, near zero vectors are set to 0
+func NormalizeVector(v []float64, norm ChromaNorm) {
+	const minNorm = 1e-10
+
+	var n float64
+	switch norm {
+	case ChromaNormMax:
+		for _, x := range v {
+			n = max(n, math.Abs(x))
+		}
+	case ChromaNormL1:
+		for _, x := range v {
+			n += math.Abs(x)
+		}
+	case ChromaNormL2:
+		for _, x := range v {
+			n += x * x
+		}
+		n = math.Sqrt(n)
+	default:
+		return
+	}
+
+	if n < minNorm {
+		clear(v)
+		return
+	}
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// EstimateTuning returns tuning offset in semitones (-0.5..0.5) from
+// deviations of spectral peaks from equal temperament (A4 = 440 Hz)
+func EstimateTuning(amp [][]float64, sampleRate int, nfft int) float64 {
+	const resolution = 0.01
+	hist := make([]float64, int(1/resolution))
+
+	minBin := int(math.Ceil(c4Freq / 4 * float64(nfft) / float64(sampleRate)))
+	for _, frame := range amp {
+		// peaks above frame median
+		threshold := slices.Clone(frame)
+		slices.Sort(threshold)
+		median := threshold[len(threshold)/2]
+
+		for k := max(minBin, 1); k < len(frame)-1; k++ {
+			a := frame[k]
+			if a <= median || a <= frame[k-1] || a < frame[k+1] {
+				continue
+			}
+
+			// parabolic interpolation of log amplitude
+			l, m, r := math.Log(frame[k-1]+1e-12), math.Log(a), math.Log(frame[k+1]+1e-12)
+			shift := 0.0
+			if d := l - 2*m + r; d != 0 {
+				shift = 0.5 * (l - r) / d
+			}
+			freq := (float64(k) + shift) * float64(sampleRate) / float64(nfft)
+
+			pitch := 12 * math.Log2(freq/440)
+			dev := pitch - math.Round(pitch) // -0.5..0.5
+			idx := int(math.Floor((dev + 0.5) / resolution))
+			idx = min(max(idx, 0), len(hist)-1)
+			hist[idx] += a
+		}
+	}
+
+	best := 0
+	for i, v := range hist {
+		if v > hist[best] {
+			best = i
+		}
+	}
+
+	return (float64(best)+0.5)*resolution - 0.5
+}
+
+// CENS returns chroma energy normalized statistics: frames are L1
+// normalized and quantized, smoothed over window frames with Hann window,
+// downsampled by downsample and L2 normalized
+func CENS(chroma [][]float64, smoothWindow int, downsample int) [][]float64 {
+	if len(chroma) == 0 {
+		return nil
+	}
+	numChroma := len(chroma[0])
+
+	quantized := create2DSlice(len(chroma), numChroma)
+	for i, frame := range chroma {
+		copy(quantized[i], frame)
+		NormalizeVector(quantized[i], ChromaNormL1)
+		for j, v := range quantized[i] {
+			switch {
+			case v >= 0.4:
+				quantized[i][j] = 4
+			case v >= 0.2:
+				quantized[i][j] = 3
+			case v >= 0.1:
+				quantized[i][j] = 2
+			case v >= 0.05:
+				quantized[i][j] = 1
+			default:
+				quantized[i][j] = 0
+			}
+		}
+	}
+
+	win := make([]float64, max(smoothWindow, 1))
+	for i := range win {
+		win[i] = 1
+	}
+	if len(win) > 2 {
+		win = window.Hann(win)
+	}
+	half := len(win) / 2
+	downsample = max(downsample, 1)
+
+	cens := make([][]float64, 0, len(chroma)/downsample+1)
+	for t := 0; t < len(chroma); t += downsample {
+		frame := make([]float64, numChroma)
+		for i, w := range win {
+			idx := t + i - half
+			if idx < 0 || idx >= len(quantized) {
+				continue
+			}
+			for j, v := range quantized[idx] {
+				frame[j] += w * v
+			}
+		}
+		NormalizeVector(frame, ChromaNormL2)
+		cens = append(cens, frame)
+	}
+
+	return cens
+}
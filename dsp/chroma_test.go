@@ -0,0 +1,42 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ChromaTuning(t *testing.T) {
+	sampleRate := 22050
+	nfft := 4096
+
+	// A4 and E5 tuned 30 cents sharp
+	input := make([]float64, sampleRate*2)
+	for i := range input {
+		ts := float64(i) / float64(sampleRate)
+		input[i] = math.Sin(2*math.Pi*440*math.Pow(2, 0.3/12)*ts) +
+			0.5*math.Sin(2*math.Pi*659.26*math.Pow(2, 0.3/12)*ts)
+	}
+
+	amp, _ := SplitSpectrogram(New(512, nfft).STFT(input))
+
+	tuning := EstimateTuning(amp, sampleRate, nfft)
+	assert.InDelta(t, 0.3, tuning, 0.03)
+
+	c := NewChroma(sampleRate)
+	c.Tuning = tuning
+	chroma := c.FromSpectrogram(amp, nfft)
+	assert.Equal(t, 12, len(chroma[0]))
+	assert.Equal(t, 1.0, chroma[10][9]) // A
+	assert.Greater(t, chroma[10][4], 0.1)
+	assert.Less(t, chroma[10][0], 0.01)
+
+	cens := CENS(chroma, 9, 4)
+	assert.Equal(t, (len(chroma)+3)/4, len(cens))
+	var norm float64
+	for _, v := range cens[3] {
+		norm += v * v
+	}
+	assert.InDelta(t, 1, norm, 1e-9)
+}
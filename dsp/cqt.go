@@ -0,0 +1,231 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/dsp/window"
+)
+
+// maximum CQT frequency relative to sample rate, keeps the top octave of
+// the decimated signal in the lowpass filter passband
+const cqtMaxRelFreq = 0.42
+
+// CQT is a constant-Q transform with geometrically spaced bins starting at
+// MinFreq. Octaves are computed one by one with the same spectral kernel on
+// the signal decimated by 2 for each lower octave.
+type CQT struct {
+	SampleRate    int
+	MinFreq       float64
+	BinsPerOctave int
+	NumOctaves    int
+	FrameShift    int
+
+	fftLen  int
+	kernels []cqtKernel
+	lowpass []float64
+}
+
+// cqtKernel is a sparse spectral kernel of one top octave bin
+type cqtKernel struct {
+	idx []int
+	val []complex128
+}
+
+// NewCQT returns constant-Q transform of numOctaves*binsPerOctave bins
+// starting at minFreq, computed every frameShift samples
+func NewCQT(sampleRate int, minFreq float64, binsPerOctave int, numOctaves int, frameShift int) (*CQT, error) {
+	if binsPerOctave < 1 || numOctaves < 1 || frameShift < 1 || minFreq <= 0 {
+		return nil, fmt.Errorf("invalid CQT parameters")
+	}
+
+	maxFreq := minFreq * math.Pow(2, float64(numOctaves))
+	if maxFreq > cqtMaxRelFreq*float64(sampleRate) {
+		return nil, fmt.Errorf("CQT max frequency %.1f Hz is too high for sample rate %d", maxFreq, sampleRate)
+	}
+
+	c := CQT{
+		SampleRate:    sampleRate,
+		MinFreq:       minFreq,
+		BinsPerOctave: binsPerOctave,
+		NumOctaves:    numOctaves,
+		FrameShift:    frameShift,
+	}
+
+	// top octave kernels, the longest one is for the lowest frequency
+	q := 1 / (math.Pow(2, 1/float64(binsPerOctave)) - 1)
+	topFreq := minFreq * math.Pow(2, float64(numOctaves-1))
+	maxLen := int(math.Ceil(q * float64(sampleRate) / topFreq))
+
+	c.fftLen = 1
+	for c.fftLen < maxLen {
+		c.fftLen *= 2
+	}
+
+	fft := fourier.NewCmplxFFT(c.fftLen)
+	kernel := make([]complex128, c.fftLen)
+
+	for j := range binsPerOctave {
+		freq := topFreq * math.Pow(2, float64(j)/float64(binsPerOctave))
+		n := int(math.Ceil(q * float64(sampleRate) / freq))
+
+		win := make([]float64, n)
+		for i := range win {
+			win[i] = 1
+		}
+		win = window.Hann(win)
+		var winSum float64
+		for _, w := range win {
+			winSum += w
+		}
+
+		// kernel centered in fft frame, scaled to sinusoid amplitude
+		clear(kernel)
+		offset := (c.fftLen - n) / 2
+		for i, w := range win {
+			phase := 2 * math.Pi * freq * float64(i-n/2) / float64(sampleRate)
+			kernel[offset+i] = complex(2*w/winSum, 0) * cmplx.Exp(complex(0, phase))
+		}
+
+		spec := fft.Coefficients(nil, kernel)
+
+		// signal is real, positive frequencies are enough for analytic kernel
+		var maxAbs float64
+		for _, v := range spec[:c.fftLen/2+1] {
+			maxAbs = max(maxAbs, cmplx.Abs(v))
+		}
+
+		const sparseThreshold = 0.0054
+		var k cqtKernel
+		for i, v := range spec[:c.fftLen/2+1] {
+			if cmplx.Abs(v) < sparseThreshold*maxAbs {
+				continue
+			}
+			k.idx = append(k.idx, i)
+			k.val = append(k.val, cmplx.Conj(v)/complex(float64(c.fftLen), 0))
+		}
+		c.kernels = append(c.kernels, k)
+	}
+
+	c.lowpass = halfbandLowpass(129)
+
+	return &c, nil
+}
+
+// NumBins returns number of CQT bins
+func (c *CQT) NumBins() int {
+	return c.BinsPerOctave * c.NumOctaves
+}
+
+// Frequencies returns center frequencies of CQT bins
+func (c *CQT) Frequencies() []float64 {
+	freqs := make([]float64, c.NumBins())
+	for k := range freqs {
+		freqs[k] = c.MinFreq * math.Pow(2, float64(k)/float64(c.BinsPerOctave))
+	}
+	return freqs
+}
+
+// NumFrames returns the number of CQT frames, frames are centered at
+// multiples of FrameShift
+func (c *CQT) NumFrames(input []float64) int {
+	return len(input)/c.FrameShift + 1
+}
+
+// CQT returns complex constant-Q spectrogram, bins go from the lowest
+// frequency
+func (c *CQT) CQT(input []float64) [][]complex128 {
+	numFrames := c.NumFrames(input)
+	numBins := c.NumBins()
+
+	spectrogram := make([][]complex128, numFrames)
+	for t := range spectrogram {
+		spectrogram[t] = make([]complex128, numBins)
+	}
+
+	fft := fourier.NewFFT(c.fftLen)
+	frame := make([]float64, c.fftLen)
+	var coeffs []complex128
+
+	signal := input
+	for o := range c.NumOctaves {
+		if o > 0 {
+			signal = decimate(signal, c.lowpass)
+		}
+		decimation := float64(int(1) << o)
+		binOffset := (c.NumOctaves - 1 - o) * c.BinsPerOctave
+
+		for t := range numFrames {
+			center := int(math.Round(float64(t*c.FrameShift) / decimation))
+			start := center - c.fftLen/2
+			for i := range frame {
+				frame[i] = 0
+				if start+i >= 0 && start+i < len(signal) {
+					frame[i] = signal[start+i]
+				}
+			}
+
+			coeffs = fft.Coefficients(coeffs, frame)
+
+			for j, k := range c.kernels {
+				var sum complex128
+				for i, idx := range k.idx {
+					sum += coeffs[idx] * k.val[i]
+				}
+				spectrogram[t][binOffset+j] = sum
+			}
+		}
+	}
+
+	return spectrogram
+}
+
+// halfbandLowpass returns Blackman windowed-sinc lowpass filter with cutoff
+// at quarter of sample rate and unity DC gain
+func halfbandLowpass(taps int) []float64 {
+	const cutoff = 0.23
+
+	h := make([]float64, taps)
+	for i := range h {
+		h[i] = 1
+	}
+	h = window.Blackman(h)
+
+	var sum float64
+	mid := (taps - 1) / 2
+	for i := range h {
+		x := float64(i - mid)
+		sinc := 2 * cutoff
+		if x != 0 {
+			sinc = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		h[i] *= sinc
+		sum += h[i]
+	}
+	for i := range h {
+		h[i] /= sum
+	}
+
+	return h
+}
+
+// decimate filters signal with zero phase lowpass and drops every other sample
+func decimate(signal []float64, h []float64) []float64 {
+	mid := (len(h) - 1) / 2
+
+	out := make([]float64, (len(signal)+1)/2)
+	for n := range out {
+		var sum float64
+		for k, w := range h {
+			idx := 2*n + mid - k
+			if idx >= 0 && idx < len(signal) {
+				sum += w * signal[idx]
+			}
+		}
+		out[n] = sum
+	}
+
+	return out
+}
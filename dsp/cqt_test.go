@@ -0,0 +1,44 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CQTPeak(t *testing.T) {
+	sampleRate := 22050
+
+	cqt, err := NewCQT(sampleRate, 55, 12, 6, 512)
+	assert.NoError(t, err)
+	assert.Equal(t, 72, cqt.NumBins())
+	assert.InDelta(t, 110, cqt.Frequencies()[12], 1e-9)
+
+	// tones in the top and in the bottom octave
+	for _, bin := range []int{3, 64} {
+		freq := cqt.Frequencies()[bin]
+
+		input := make([]float64, sampleRate*2)
+		for i := range input {
+			input[i] = 0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))
+		}
+
+		spectrogram := cqt.CQT(input)
+		assert.Equal(t, cqt.NumFrames(input), len(spectrogram))
+
+		frame := spectrogram[len(spectrogram)/2]
+		maxIdx := 0
+		for k, v := range frame {
+			if cmplx.Abs(v) > cmplx.Abs(frame[maxIdx]) {
+				maxIdx = k
+			}
+		}
+		assert.Equal(t, bin, maxIdx)
+		assert.InDelta(t, 0.5, cmplx.Abs(frame[bin]), 0.05)
+	}
+
+	_, err = NewCQT(sampleRate, 55, 12, 8, 512)
+	assert.Error(t, err)
+}
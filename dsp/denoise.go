@@ -0,0 +1,223 @@
+package dsp
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// NoiseProfile is noise level statistics of each frequency bin, dB
+type NoiseProfile struct {
+	Mean []float64
+	Std  []float64
+}
+
+// amplitude floor of dB conversion
+const noiseMinAmplitude = 1e-10
+
+// EstimateNoiseProfile returns noise profile of amplitude spectrogram frames
+// with the indices, all frames for nil indices
+func EstimateNoiseProfile(amp [][]float64, frames []int) NoiseProfile {
+	if frames == nil {
+		frames = make([]int, len(amp))
+		for i := range frames {
+			frames[i] = i
+		}
+	}
+
+	var profile NoiseProfile
+	if len(amp) == 0 || len(frames) == 0 {
+		return profile
+	}
+	numBins := len(amp[0])
+
+	profile.Mean = make([]float64, numBins)
+	profile.Std = make([]float64, numBins)
+
+	for _, i := range frames {
+		for k, a := range amp[i] {
+			profile.Mean[k] += ampToDb(a)
+		}
+	}
+	for k := range profile.Mean {
+		profile.Mean[k] /= float64(len(frames))
+	}
+
+	for _, i := range frames {
+		for k, a := range amp[i] {
+			d := ampToDb(a) - profile.Mean[k]
+			profile.Std[k] += d * d
+		}
+	}
+	for k := range profile.Std {
+		profile.Std[k] = math.Sqrt(profile.Std[k] / float64(len(frames)))
+	}
+
+	return profile
+}
+
+// LowEnergyFrames returns indices of the fraction of frames with the lowest
+// energy in time order, at least one frame
+func LowEnergyFrames(amp [][]float64, fraction float64) []int {
+	if len(amp) == 0 {
+		return []int{}
+	}
+
+	energy := make([]float64, len(amp))
+	frames := make([]int, len(amp))
+	for i, frame := range amp {
+		for _, a := range frame {
+			energy[i] += a * a
+		}
+		frames[i] = i
+	}
+
+	slices.SortStableFunc(frames, func(a, b int) int {
+		return cmp.Compare(energy[a], energy[b])
+	})
+
+	n := min(len(frames), max(1, int(fraction*float64(len(frames)))))
+	frames = frames[:n]
+	slices.Sort(frames)
+
+	return frames
+}
+
+func ampToDb(a float64) float64 {
+	return 20 * math.Log10(max(a, noiseMinAmplitude))
+}
+
+// SpectralGate attenuates bins below noise threshold of the noise profile,
+// gate mask is smoothed in time and frequency to avoid musical noise
+type SpectralGate struct {
+	// threshold above noise mean in standard deviations
+	ThresholdStd float64
+	// attenuation of gated bins, dB
+	ReductionDb float64
+	// mask smoothing length, frames and bins
+	SmoothFrames int
+	SmoothBins   int
+	// bins passing the gate in fewer consecutive frames stay closed
+	MinRunFrames int
+}
+
+func NewSpectralGate() *SpectralGate {
+	return &SpectralGate{
+		ThresholdStd: 2,
+		ReductionDb:  24,
+		SmoothFrames: 5,
+		SmoothBins:   3,
+		MinRunFrames: 3,
+	}
+}
+
+// Mask returns gain mask of amplitude spectrogram for the noise profile
+func (g *SpectralGate) Mask(amp [][]float64, profile NoiseProfile) [][]float64 {
+	if len(amp) == 0 {
+		return [][]float64{}
+	}
+	numFrames, numBins := len(amp), len(amp[0])
+
+	floor := math.Pow(10, -g.ReductionDb/20)
+
+	gate := create2DSlice(numFrames, numBins)
+	for i, frame := range amp {
+		for k, a := range frame {
+			threshold := profile.Mean[k] + g.ThresholdStd*profile.Std[k]
+			if ampToDb(a) > threshold {
+				gate[i][k] = 1
+			}
+		}
+	}
+	// noise randomly passes the gate in isolated frames
+	closeShortRuns(gate, g.MinRunFrames)
+
+	// smoothing only opens gate around passed bins, they keep full gain
+	smoothed := smoothMask(gate, g.SmoothFrames, g.SmoothBins)
+	mask := create2DSlice(numFrames, numBins)
+	for i := range mask {
+		for k, v := range smoothed[i] {
+			mask[i][k] = floor + (1-floor)*max(v, gate[i][k])
+		}
+	}
+
+	return mask
+}
+
+// closeShortRuns zeroes runs of open gate shorter than minRun frames in each
+// bin
+func closeShortRuns(gate [][]float64, minRun int) {
+	if minRun <= 1 || len(gate) == 0 {
+		return
+	}
+	numFrames, numBins := len(gate), len(gate[0])
+
+	for k := range numBins {
+		start := -1
+		for i := 0; i <= numFrames; i++ {
+			open := i < numFrames && gate[i][k] > 0
+			if open && start < 0 {
+				start = i
+			}
+			if !open && start >= 0 {
+				if i-start < minRun {
+					for j := start; j < i; j++ {
+						gate[j][k] = 0
+					}
+				}
+				start = -1
+			}
+		}
+	}
+}
+
+// smoothMask returns mask averaged with triangular kernel of frames x bins
+// size, kernel is truncated at edges
+func smoothMask(mask [][]float64, frames int, bins int) [][]float64 {
+	out := mask
+	if frames > 1 {
+		out = smoothAxis(out, triangleKernel(frames), true)
+	}
+	if bins > 1 {
+		out = smoothAxis(out, triangleKernel(bins), false)
+	}
+	return out
+}
+
+func triangleKernel(n int) []float64 {
+	kernel := make([]float64, n)
+	for i := range kernel {
+		kernel[i] = float64(min(i+1, n-i))
+	}
+	return kernel
+}
+
+// smoothAxis convolves matrix with normalized kernel over frames (time) or
+// bins
+func smoothAxis(mx [][]float64, kernel []float64, time bool) [][]float64 {
+	numFrames, numBins := len(mx), len(mx[0])
+	out := create2DSlice(numFrames, numBins)
+	half := len(kernel) / 2
+
+	for i := range numFrames {
+		for k := range numBins {
+			var sum, weight float64
+			for j, w := range kernel {
+				fi, bi := i, k
+				if time {
+					fi += j - half
+				} else {
+					bi += j - half
+				}
+				if fi < 0 || fi >= numFrames || bi < 0 || bi >= numBins {
+					continue
+				}
+				sum += w * mx[fi][bi]
+				weight += w
+			}
+			out[i][k] = sum / weight
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,65 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rms(x []float64) float64 {
+	var sum float64
+	for _, v := range x {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(x)))
+}
+
+func Test_SpectralGate(t *testing.T) {
+	const sampleRate = 16000
+
+	rnd := rand.New(rand.NewSource(1))
+
+	// noise over the whole signal, tone in the second half
+	input := make([]float64, 4*sampleRate)
+	for i := range input {
+		input[i] = 0.01 * rnd.NormFloat64()
+		if i >= len(input)/2 {
+			input[i] += 0.5 * math.Sin(2*math.Pi*1000*float64(i)/sampleRate)
+		}
+	}
+
+	stft := New(256, 1024)
+	spectrogram := stft.STFT(input)
+	amp, _ := SplitSpectrogram(spectrogram)
+
+	frames := LowEnergyFrames(amp, 0.2)
+	assert.Equal(t, len(amp)/5, len(frames))
+	for _, i := range frames {
+		assert.LessOrEqual(t, i*256+1024, len(input)/2)
+	}
+
+	gate := NewSpectralGate()
+	mask := gate.Mask(amp, EstimateNoiseProfile(amp, frames))
+	output := stft.ISTFT(ApplyComplexMask(spectrogram, mask))
+
+	// noise bins passing the gate alone are not opened to full gain
+	for i := range len(input) / 2 / 256 {
+		if i*256+1024 > len(input)/2 {
+			break
+		}
+		for k, v := range mask[i] {
+			assert.Less(t, v, 0.5, "frame %d bin %d", i, k)
+		}
+	}
+
+	half := len(input) / 2
+	noiseIn := rms(input[4096 : half-4096])
+	noiseOut := rms(output[4096 : half-4096])
+	assert.Less(t, 20*math.Log10(noiseOut/noiseIn), -20.0)
+
+	toneIn := rms(input[half+4096 : len(output)-4096])
+	toneOut := rms(output[half+4096 : len(output)-4096])
+	assert.InDelta(t, 0, 20*math.Log10(toneOut/toneIn), 0.1)
+}
@@ -0,0 +1,473 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// Filter processes signal sample by sample keeping its state between calls
+type Filter interface {
+	Process(x float64) float64
+	// Reset clears filter state
+	Reset()
+}
+
+// Biquad is a second order IIR filter in direct form I, coefficients are
+// normalized by a0
+type Biquad struct {
+	B0, B1, B2 float64
+	A1, A2     float64
+
+	x1, x2 float64
+	y1, y2 float64
+}
+
+func (f *Biquad) Process(x float64) float64 {
+	y := f.B0*x + f.B1*f.x1 + f.B2*f.x2 - f.A1*f.y1 - f.A2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+func (f *Biquad) Reset() {
+	f.x1, f.x2, f.y1, f.y2 = 0, 0, 0, 0
+}
+
+// Response returns complex frequency response at freq Hz
+func (f *Biquad) Response(freq float64, sampleRate int) complex128 {
+	z1 := cmplx.Exp(complex(0, -2*math.Pi*freq/float64(sampleRate)))
+	z2 := z1 * z1
+	num := complex(f.B0, 0) + complex(f.B1, 0)*z1 + complex(f.B2, 0)*z2
+	den := 1 + complex(f.A1, 0)*z1 + complex(f.A2, 0)*z2
+	return num / den
+}
+
+// newBiquad returns biquad with coefficients normalized by a0
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) Biquad {
+	return Biquad{
+		B0: b0 / a0,
+		B1: b1 / a0,
+		B2: b2 / a0,
+		A1: a1 / a0,
+		A2: a2 / a0,
+	}
+}
+
+// rbjParams returns cos(w0) and alpha of RBJ audio EQ cookbook
+func rbjParams(sampleRate int, freq float64, q float64) (float64, float64) {
+	w0 := 2 * math.Pi * freq / float64(sampleRate)
+	return math.Cos(w0), math.Sin(w0) / (2 * q)
+}
+
+// LowPass returns RBJ cookbook second order lowpass filter
+func LowPass(sampleRate int, freq float64, q float64) Biquad {
+	c, alpha := rbjParams(sampleRate, freq, q)
+	return newBiquad((1-c)/2, 1-c, (1-c)/2, 1+alpha, -2*c, 1-alpha)
+}
+
+// HighPass returns RBJ cookbook second order highpass filter
+func HighPass(sampleRate int, freq float64, q float64) Biquad {
+	c, alpha := rbjParams(sampleRate, freq, q)
+	return newBiquad((1+c)/2, -(1 + c), (1+c)/2, 1+alpha, -2*c, 1-alpha)
+}
+
+// BandPass returns RBJ cookbook bandpass filter with 0 dB peak gain
+func BandPass(sampleRate int, freq float64, q float64) Biquad {
+	c, alpha := rbjParams(sampleRate, freq, q)
+	return newBiquad(alpha, 0, -alpha, 1+alpha, -2*c, 1-alpha)
+}
+
+// Notch returns RBJ cookbook notch filter
+func Notch(sampleRate int, freq float64, q float64) Biquad {
+	c, alpha := rbjParams(sampleRate, freq, q)
+	return newBiquad(1, -2*c, 1, 1+alpha, -2*c, 1-alpha)
+}
+
+// Peaking returns RBJ cookbook peaking EQ filter with gain in dB at freq
+func Peaking(sampleRate int, freq float64, q float64, gainDb float64) Biquad {
+	c, alpha := rbjParams(sampleRate, freq, q)
+	a := math.Pow(10, gainDb/40)
+	return newBiquad(1+alpha*a, -2*c, 1-alpha*a, 1+alpha/a, -2*c, 1-alpha/a)
+}
+
+// LowShelf returns RBJ cookbook low shelf filter with gain in dB below freq
+func LowShelf(sampleRate int, freq float64, q float64, gainDb float64) Biquad {
+	c, alpha := rbjParams(sampleRate, freq, q)
+	a := math.Pow(10, gainDb/40)
+	sa := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)-(a-1)*c+sa),
+		2*a*((a-1)-(a+1)*c),
+		a*((a+1)-(a-1)*c-sa),
+		(a+1)+(a-1)*c+sa,
+		-2*((a-1)+(a+1)*c),
+		(a+1)+(a-1)*c-sa,
+	)
+}
+
+// HighShelf returns RBJ cookbook high shelf filter with gain in dB above freq
+func HighShelf(sampleRate int, freq float64, q float64, gainDb float64) Biquad {
+	c, alpha := rbjParams(sampleRate, freq, q)
+	a := math.Pow(10, gainDb/40)
+	sa := 2 * math.Sqrt(a) * alpha
+	return newBiquad(
+		a*((a+1)+(a-1)*c+sa),
+		-2*a*((a-1)+(a+1)*c),
+		a*((a+1)+(a-1)*c-sa),
+		(a+1)-(a-1)*c+sa,
+		2*((a-1)-(a+1)*c),
+		(a+1)-(a-1)*c-sa,
+	)
+}
+
+// firstOrder returns bilinear transform first order lowpass or highpass
+// filter as biquad
+func firstOrder(sampleRate int, freq float64, highpass bool) Biquad {
+	k := math.Tan(math.Pi * freq / float64(sampleRate))
+	if highpass {
+		return newBiquad(1, -1, 0, 1+k, k-1, 0)
+	}
+	return newBiquad(k, k, 0, 1+k, k-1, 0)
+}
+
+// Cascade is a chain of biquads applied in order
+type Cascade []Biquad
+
+func (c Cascade) Process(x float64) float64 {
+	for i := range c {
+		x = c[i].Process(x)
+	}
+	return x
+}
+
+func (c Cascade) Reset() {
+	for i := range c {
+		c[i].Reset()
+	}
+}
+
+// Clone returns cascade with the same coefficients and cleared state
+func (c Cascade) Clone() Cascade {
+	clone := make(Cascade, len(c))
+	copy(clone, c)
+	clone.Reset()
+	return clone
+}
+
+// Response returns complex frequency response at freq Hz
+func (c Cascade) Response(freq float64, sampleRate int) complex128 {
+	h := complex(1, 0)
+	for i := range c {
+		h *= c[i].Response(freq, sampleRate)
+	}
+	return h
+}
+
+// butterworth returns Butterworth filter of order as cascade of second order
+// sections and a first order section for odd order
+func butterworth(sampleRate int, freq float64, order int, highpass bool) Cascade {
+	c := make(Cascade, 0, (order+1)/2)
+	for k := range order / 2 {
+		// pole pair quality factor
+		q := 1 / (2 * math.Sin(float64(2*k+1)*math.Pi/float64(2*order)))
+		if highpass {
+			c = append(c, HighPass(sampleRate, freq, q))
+		} else {
+			c = append(c, LowPass(sampleRate, freq, q))
+		}
+	}
+	if order%2 == 1 {
+		c = append(c, firstOrder(sampleRate, freq, highpass))
+	}
+	return c
+}
+
+// ButterworthLowPass returns lowpass Butterworth filter of order, -3 dB at
+// freq
+func ButterworthLowPass(sampleRate int, freq float64, order int) Cascade {
+	return butterworth(sampleRate, freq, order, false)
+}
+
+// ButterworthHighPass returns highpass Butterworth filter of order, -3 dB at
+// freq
+func ButterworthHighPass(sampleRate int, freq float64, order int) Cascade {
+	return butterworth(sampleRate, freq, order, true)
+}
+
+// LinkwitzRileyLowPass returns lowpass Linkwitz-Riley crossover filter of
+// even order, two cascaded Butterworth filters of half order, -6 dB at freq.
+// Lowpass and highpass outputs of the same order sum to flat magnitude, see
+// LinkwitzRileyHighPass.
+func LinkwitzRileyLowPass(sampleRate int, freq float64, order int) (Cascade, error) {
+	if order < 2 || order%2 != 0 {
+		return nil, fmt.Errorf("invalid Linkwitz-Riley order: %d", order)
+	}
+	bw := butterworth(sampleRate, freq, order/2, false)
+	return append(bw, bw.Clone()...), nil
+}
+
+// LinkwitzRileyHighPass returns highpass Linkwitz-Riley crossover filter of
+// even order, see LinkwitzRileyLowPass. Highpass of order 2, 6, 10... is
+// inverted, lowpass and highpass are out of phase at freq otherwise and
+// their sum has a notch.
+func LinkwitzRileyHighPass(sampleRate int, freq float64, order int) (Cascade, error) {
+	if order < 2 || order%2 != 0 {
+		return nil, fmt.Errorf("invalid Linkwitz-Riley order: %d", order)
+	}
+	bw := butterworth(sampleRate, freq, order/2, true)
+	c := append(bw, bw.Clone()...)
+	if order%4 == 2 {
+		c[0].B0, c[0].B1, c[0].B2 = -c[0].B0, -c[0].B1, -c[0].B2
+	}
+	return c, nil
+}
+
+// FIR is a finite impulse response filter
+type FIR struct {
+	Coeffs []float64
+
+	// delay line, twice as long as coefficients to avoid wrapping
+	history []float64
+	pos     int
+}
+
+func NewFIR(coeffs []float64) *FIR {
+	return &FIR{
+		Coeffs:  coeffs,
+		history: make([]float64, 2*len(coeffs)),
+	}
+}
+
+func (f *FIR) Process(x float64) float64 {
+	n := len(f.Coeffs)
+	if f.pos == 0 {
+		f.pos = n
+		copy(f.history[n:], f.history[:n])
+	}
+	f.pos--
+	f.history[f.pos] = x
+
+	var y float64
+	for i, h := range f.Coeffs {
+		y += h * f.history[f.pos+i]
+	}
+	return y
+}
+
+func (f *FIR) Reset() {
+	clear(f.history)
+	f.pos = 0
+}
+
+// Delay returns group delay of linear phase filter, samples
+func (f *FIR) Delay() int {
+	return (len(f.Coeffs) - 1) / 2
+}
+
+// sinc returns windowed sinc lowpass coefficients with cutoff as a fraction
+// of sample rate
+func sinc(cutoff float64, taps int, win func([]float64) []float64) []float64 {
+	h := make([]float64, taps)
+	mid := float64(taps-1) / 2
+	for i := range h {
+		x := float64(i) - mid
+		if x == 0 {
+			h[i] = 2 * cutoff
+		} else {
+			h[i] = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+	}
+
+	if win != nil {
+		w := make([]float64, taps)
+		for i := range w {
+			w[i] = 1
+		}
+		w = win(w)
+		for i := range h {
+			h[i] *= w[i]
+		}
+	}
+
+	return h
+}
+
+// FIRLowPass returns windowed sinc lowpass filter coefficients with unity
+// DC gain, nil window is rectangular
+func FIRLowPass(sampleRate int, freq float64, taps int, win func([]float64) []float64) []float64 {
+	h := sinc(freq/float64(sampleRate), taps, win)
+
+	var sum float64
+	for _, v := range h {
+		sum += v
+	}
+	for i := range h {
+		h[i] /= sum
+	}
+
+	return h
+}
+
+// FIRHighPass returns windowed sinc highpass filter coefficients by spectral
+// inversion of lowpass, taps must be odd
+func FIRHighPass(sampleRate int, freq float64, taps int, win func([]float64) []float64) ([]float64, error) {
+	if taps%2 == 0 {
+		return nil, fmt.Errorf("highpass FIR needs odd number of taps: %d", taps)
+	}
+
+	h := FIRLowPass(sampleRate, freq, taps, win)
+	for i := range h {
+		h[i] = -h[i]
+	}
+	h[taps/2] += 1
+
+	return h, nil
+}
+
+// FIRBandPass returns windowed sinc bandpass filter coefficients passing
+// lowFreq..highFreq, taps must be odd
+func FIRBandPass(sampleRate int, lowFreq float64, highFreq float64, taps int, win func([]float64) []float64) ([]float64, error) {
+	if taps%2 == 0 {
+		return nil, fmt.Errorf("bandpass FIR needs odd number of taps: %d", taps)
+	}
+	if lowFreq >= highFreq {
+		return nil, fmt.Errorf("invalid band: %.1f - %.1f Hz", lowFreq, highFreq)
+	}
+
+	high := sinc(highFreq/float64(sampleRate), taps, win)
+	low := sinc(lowFreq/float64(sampleRate), taps, win)
+	for i := range high {
+		high[i] -= low[i]
+	}
+
+	return high, nil
+}
+
+// FilterResponse returns complex frequency response of FIR coefficients at
+// freq Hz
+func FilterResponse(coeffs []float64, freq float64, sampleRate int) complex128 {
+	w := -2 * math.Pi * freq / float64(sampleRate)
+	var h complex128
+	for i, c := range coeffs {
+		h += complex(c, 0) * cmplx.Exp(complex(0, w*float64(i)))
+	}
+	return h
+}
+
+type EQBandType string
+
+const (
+	EQLowPass   EQBandType = "lowpass"
+	EQHighPass  EQBandType = "highpass"
+	EQBandPass  EQBandType = "bandpass"
+	EQNotch     EQBandType = "notch"
+	EQPeak      EQBandType = "peak"
+	EQLowShelf  EQBandType = "lowshelf"
+	EQHighShelf EQBandType = "highshelf"
+)
+
+// EQBand is a band of parametric equalizer
+type EQBand struct {
+	Type   EQBandType
+	Freq   float64
+	GainDb float64
+	Q      float64
+}
+
+// ParseEQ parses comma separated EQ bands: type:freq[:q] for lowpass,
+// highpass, bandpass and notch, type:freq:gain[:q] for peak, lowshelf and
+// highshelf, e.g. "highpass:30,lowshelf:100:3,peak:2500:-4:2"
+func ParseEQ(s string) ([]EQBand, error) {
+	bands := make([]EQBand, 0)
+	for _, bandStr := range strings.Split(s, ",") {
+		bandStr = strings.TrimSpace(bandStr)
+		if bandStr == "" {
+			continue
+		}
+
+		parts := strings.Split(bandStr, ":")
+		band := EQBand{
+			Type: EQBandType(strings.ToLower(parts[0])),
+		}
+
+		values := make([]float64, len(parts)-1)
+		for i, p := range parts[1:] {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EQ band %s: %w", bandStr, err)
+			}
+			values[i] = v
+		}
+
+		switch band.Type {
+		case EQLowPass, EQHighPass, EQLowShelf, EQHighShelf:
+			// maximally flat
+			band.Q = 1 / math.Sqrt2
+		case EQBandPass, EQNotch, EQPeak:
+			band.Q = 1
+		default:
+			return nil, fmt.Errorf("unknown EQ band type: %s", parts[0])
+		}
+
+		withGain := band.Type == EQPeak || band.Type == EQLowShelf || band.Type == EQHighShelf
+		minValues, maxValues := 1, 2
+		if withGain {
+			minValues, maxValues = 2, 3
+		}
+		if len(values) < minValues || len(values) > maxValues {
+			return nil, fmt.Errorf("invalid EQ band: %s", bandStr)
+		}
+
+		band.Freq = values[0]
+		values = values[1:]
+		if withGain {
+			band.GainDb = values[0]
+			values = values[1:]
+		}
+		if len(values) > 0 {
+			band.Q = values[0]
+		}
+		if band.Freq <= 0 || band.Q <= 0 {
+			return nil, fmt.Errorf("invalid EQ band: %s", bandStr)
+		}
+
+		bands = append(bands, band)
+	}
+
+	return bands, nil
+}
+
+// Biquad returns the band filter for the sample rate
+func (b EQBand) Biquad(sampleRate int) Biquad {
+	switch b.Type {
+	case EQLowPass:
+		return LowPass(sampleRate, b.Freq, b.Q)
+	case EQHighPass:
+		return HighPass(sampleRate, b.Freq, b.Q)
+	case EQBandPass:
+		return BandPass(sampleRate, b.Freq, b.Q)
+	case EQNotch:
+		return Notch(sampleRate, b.Freq, b.Q)
+	case EQLowShelf:
+		return LowShelf(sampleRate, b.Freq, b.Q, b.GainDb)
+	case EQHighShelf:
+		return HighShelf(sampleRate, b.Freq, b.Q, b.GainDb)
+	}
+	return Peaking(sampleRate, b.Freq, b.Q, b.GainDb)
+}
+
+// EQCascade returns cascade of EQ bands for the sample rate, bands above
+// Nyquist frequency are skipped
+func EQCascade(bands []EQBand, sampleRate int) Cascade {
+	c := make(Cascade, 0, len(bands))
+	for _, b := range bands {
+		if b.Freq >= float64(sampleRate)/2 {
+			continue
+		}
+		c = append(c, b.Biquad(sampleRate))
+	}
+	return c
+}
@@ -0,0 +1,115 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gonum.org/v1/gonum/dsp/window"
+)
+
+func gainDb(h complex128) float64 {
+	return 20 * math.Log10(cmplx.Abs(h))
+}
+
+func Test_BiquadResponse(t *testing.T) {
+	const sampleRate = 48000
+
+	peak := Peaking(sampleRate, 1000, 2, 6)
+	assert.InDelta(t, 6, gainDb(peak.Response(1000, sampleRate)), 0.01)
+	assert.InDelta(t, 0, gainDb(peak.Response(20000, sampleRate)), 0.1)
+
+	low := LowShelf(sampleRate, 200, 1/math.Sqrt2, -4)
+	assert.InDelta(t, -4, gainDb(low.Response(10, sampleRate)), 0.05)
+	assert.InDelta(t, 0, gainDb(low.Response(10000, sampleRate)), 0.05)
+
+	high := HighShelf(sampleRate, 5000, 1/math.Sqrt2, 3)
+	assert.InDelta(t, 3, gainDb(high.Response(23000, sampleRate)), 0.1)
+
+	notch := Notch(sampleRate, 50, 10)
+	assert.Less(t, gainDb(notch.Response(50, sampleRate)), -60.0)
+
+	for _, order := range []int{1, 2, 3, 4, 8} {
+		lp := ButterworthLowPass(sampleRate, 1000, order)
+		assert.InDelta(t, -3.01, gainDb(lp.Response(1000, sampleRate)), 0.01)
+		assert.InDelta(t, 0, gainDb(lp.Response(10, sampleRate)), 0.01)
+		// roll-off of at least 6 dB per octave per order, steeper near
+		// Nyquist frequency by bilinear transform
+		assert.Less(t, gainDb(lp.Response(8000, sampleRate))-gainDb(lp.Response(4000, sampleRate)), -5.9*float64(order))
+
+		hp := ButterworthHighPass(sampleRate, 1000, order)
+		assert.InDelta(t, -3.01, gainDb(hp.Response(1000, sampleRate)), 0.01)
+	}
+
+	// crossover outputs sum to all-pass
+	for _, order := range []int{2, 4, 6, 8} {
+		lp, err := LinkwitzRileyLowPass(sampleRate, 2000, order)
+		assert.NoError(t, err)
+		hp, err := LinkwitzRileyHighPass(sampleRate, 2000, order)
+		assert.NoError(t, err)
+		assert.InDelta(t, -6.02, gainDb(lp.Response(2000, sampleRate)), 0.01)
+		for _, freq := range []float64{50, 500, 2000, 5000, 15000} {
+			sum := lp.Response(freq, sampleRate) + hp.Response(freq, sampleRate)
+			assert.InDelta(t, 0, gainDb(sum), 0.01, "order %d freq %v", order, freq)
+		}
+	}
+
+	_, err := LinkwitzRileyLowPass(sampleRate, 2000, 3)
+	assert.Error(t, err)
+}
+
+func Test_FIRFilter(t *testing.T) {
+	const sampleRate = 8000
+
+	lp := FIRLowPass(sampleRate, 1000, 101, window.BlackmanHarris)
+	assert.InDelta(t, 0, gainDb(FilterResponse(lp, 200, sampleRate)), 0.01)
+	assert.Less(t, gainDb(FilterResponse(lp, 1500, sampleRate)), -80.0)
+
+	hp, err := FIRHighPass(sampleRate, 1000, 101, window.BlackmanHarris)
+	assert.NoError(t, err)
+	assert.Less(t, gainDb(FilterResponse(hp, 500, sampleRate)), -80.0)
+	assert.InDelta(t, 0, gainDb(FilterResponse(hp, 3000, sampleRate)), 0.01)
+
+	bp, err := FIRBandPass(sampleRate, 500, 1500, 201, window.Hann)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0, gainDb(FilterResponse(bp, 1000, sampleRate)), 0.01)
+	assert.Less(t, gainDb(FilterResponse(bp, 3000, sampleRate)), -40.0)
+
+	_, err = FIRHighPass(sampleRate, 1000, 100, nil)
+	assert.Error(t, err)
+
+	// streaming output is convolution of the input
+	input := make([]float64, 300)
+	for i := range input {
+		input[i] = math.Sin(float64(i) * 0.3)
+	}
+	fir := NewFIR(lp)
+	for n, x := range input {
+		var expected float64
+		for k, h := range lp {
+			if n-k >= 0 {
+				expected += h * input[n-k]
+			}
+		}
+		assert.InDelta(t, expected, fir.Process(x), 1e-12)
+	}
+}
+
+func Test_ParseEQ(t *testing.T) {
+	bands, err := ParseEQ("highpass:30, lowshelf:100:3, peak:2500:-4:2")
+	assert.NoError(t, err)
+	assert.Equal(t, []EQBand{
+		{Type: EQHighPass, Freq: 30, Q: 1 / math.Sqrt2},
+		{Type: EQLowShelf, Freq: 100, GainDb: 3, Q: 1 / math.Sqrt2},
+		{Type: EQPeak, Freq: 2500, GainDb: -4, Q: 2},
+	}, bands)
+
+	for _, s := range []string{"peak:1000", "lowpass:1000:1:2", "band:100", "notch:x"} {
+		_, err = ParseEQ(s)
+		assert.Error(t, err, s)
+	}
+
+	// bands above Nyquist frequency are skipped
+	assert.Equal(t, 2, len(EQCascade(bands, 4000)))
+}
@@ -0,0 +1,181 @@
+package dsp
+
+import (
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// HPSS separates harmonic and percussive parts of amplitude spectrogram by
+// median filtering: harmonic sounds are smooth in time, percussive sounds
+// are smooth in frequency (Fitzgerald, Driedger).
+type HPSS struct {
+	// median filter length across frames for harmonic part, odd
+	HarmonicKernel int
+	// median filter length across frequency bins for percussive part, odd
+	PercussiveKernel int
+	// soft mask exponent
+	Power float64
+	// separation margin, parts must exceed each other by the margin, the
+	// rest goes to residual, 1 - no residual
+	Margin float64
+}
+
+func NewHPSS() *HPSS {
+	return &HPSS{
+		HarmonicKernel:   17,
+		PercussiveKernel: 17,
+		Power:            2,
+		Margin:           1,
+	}
+}
+
+// Masks returns harmonic, percussive and residual soft masks of amplitude
+// spectrogram, masks sum to 1 in each bin
+func (h *HPSS) Masks(amp [][]float64) ([][]float64, [][]float64, [][]float64) {
+	numFrames := len(amp)
+	if numFrames == 0 {
+		return [][]float64{}, [][]float64{}, [][]float64{}
+	}
+	numBins := len(amp[0])
+
+	harmonic := medianFilterTime(amp, h.HarmonicKernel)
+	percussive := medianFilterFreq(amp, h.PercussiveKernel)
+
+	harmMask := create2DSlice(numFrames, numBins)
+	percMask := create2DSlice(numFrames, numBins)
+	residMask := create2DSlice(numFrames, numBins)
+
+	const eps = 1e-12
+	for i := range numFrames {
+		for k := range numBins {
+			hv := math.Pow(harmonic[i][k], h.Power)
+			pv := math.Pow(percussive[i][k], h.Power)
+			hm := math.Pow(h.Margin*harmonic[i][k], h.Power)
+			pm := math.Pow(h.Margin*percussive[i][k], h.Power)
+
+			if hv+pm < eps || pv+hm < eps {
+				// silence is split evenly
+				harmMask[i][k] = 0.5
+				percMask[i][k] = 0.5
+				continue
+			}
+
+			harmMask[i][k] = hv / (hv + pm)
+			percMask[i][k] = pv / (pv + hm)
+			residMask[i][k] = max(0, 1-harmMask[i][k]-percMask[i][k])
+		}
+	}
+
+	return harmMask, percMask, residMask
+}
+
+// Harmonic returns harmonic part of amplitude spectrogram
+func (h *HPSS) Harmonic(amp [][]float64) [][]float64 {
+	harmMask, _, _ := h.Masks(amp)
+	return ApplyMask(amp, harmMask)
+}
+
+// ApplyMask returns amplitude spectrogram multiplied by mask
+func ApplyMask(amp [][]float64, mask [][]float64) [][]float64 {
+	if len(amp) == 0 {
+		return [][]float64{}
+	}
+	out := create2DSlice(len(amp), len(amp[0]))
+	for i, frame := range amp {
+		for k, a := range frame {
+			out[i][k] = a * mask[i][k]
+		}
+	}
+	return out
+}
+
+// ApplyComplexMask returns complex spectrogram multiplied by mask
+func ApplyComplexMask(spectrogram [][]complex128, mask [][]float64) [][]complex128 {
+	out := make([][]complex128, len(spectrogram))
+	for i, frame := range spectrogram {
+		out[i] = make([]complex128, len(frame))
+		for k, c := range frame {
+			out[i][k] = c * complex(mask[i][k], 0)
+		}
+	}
+	return out
+}
+
+// medianFilterTime returns median of each bin over kernel frames centered at
+// the frame, kernel is truncated at spectrogram edges
+func medianFilterTime(amp [][]float64, kernel int) [][]float64 {
+	numFrames, numBins := len(amp), len(amp[0])
+	out := create2DSlice(numFrames, numBins)
+	half := kernel / 2
+
+	parallelRange(numBins, func(from, to int) {
+		buf := make([]float64, 0, kernel)
+		for k := from; k < to; k++ {
+			for i := range numFrames {
+				buf = buf[:0]
+				for j := max(0, i-half); j <= min(numFrames-1, i+half); j++ {
+					buf = append(buf, amp[j][k])
+				}
+				out[i][k] = median(buf)
+			}
+		}
+	})
+
+	return out
+}
+
+// medianFilterFreq returns median of each frame over kernel bins centered at
+// the bin, kernel is truncated at spectrum edges
+func medianFilterFreq(amp [][]float64, kernel int) [][]float64 {
+	numFrames, numBins := len(amp), len(amp[0])
+	out := create2DSlice(numFrames, numBins)
+	half := kernel / 2
+
+	parallelRange(numFrames, func(from, to int) {
+		buf := make([]float64, 0, kernel)
+		for i := from; i < to; i++ {
+			frame := amp[i]
+			for k := range numBins {
+				buf = append(buf[:0], frame[max(0, k-half):min(numBins, k+half+1)]...)
+				out[i][k] = median(buf)
+			}
+		}
+	})
+
+	return out
+}
+
+// median returns median of values, values are reordered
+func median(values []float64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// parallelRange splits 0..n into contiguous ranges processed by GOMAXPROCS
+// goroutines
+func parallelRange(n int, fn func(from, to int)) {
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+	chunk := (n + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for from := 0; from < n; from += chunk {
+		to := min(from+chunk, n)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(from, to)
+		}()
+	}
+	wg.Wait()
+}
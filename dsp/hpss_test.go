@@ -0,0 +1,55 @@
+package dsp
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_HPSSMasks(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	// tone at bin 10 and click at frame 20 over noise floor
+	amp := create2DSlice(40, 100)
+	for i := range amp {
+		for k := range amp[i] {
+			amp[i][k] = 0.01 * rnd.Float64()
+		}
+		amp[i][10] = 1
+	}
+	for k := range amp[20] {
+		amp[20][k] = 1
+	}
+
+	hpss := NewHPSS()
+	harm, perc, resid := hpss.Masks(amp)
+
+	assert.Greater(t, harm[5][10], 0.99)
+	assert.Greater(t, perc[20][50], 0.99)
+	for i := range amp {
+		for k := range amp[i] {
+			assert.InDelta(t, 1, harm[i][k]+perc[i][k]+resid[i][k], 1e-9)
+		}
+	}
+	assert.InDelta(t, 0, resid[5][50], 1e-12)
+
+	// noise without dominant part goes to residual with margin
+	hpss.Margin = 3
+	harm, perc, resid = hpss.Masks(amp)
+	assert.Greater(t, harm[5][10], 0.99)
+	assert.Greater(t, perc[20][50], 0.99)
+
+	var residSum float64
+	for i := range amp {
+		for k := range amp[i] {
+			residSum += resid[i][k]
+		}
+	}
+	assert.Greater(t, residSum/float64(40*100), 0.5)
+
+	hpss.Margin = 1
+	harmAmp := hpss.Harmonic(amp)
+	assert.Less(t, harmAmp[20][50], 0.01)
+	assert.Greater(t, harmAmp[5][10], 0.99)
+}
@@ -0,0 +1,151 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type KeyProfile int
+
+const (
+	// KeyProfileKrumhansl is Krumhansl-Kessler probe tone profile
+	KeyProfileKrumhansl KeyProfile = iota
+	// KeyProfileTemperley is Temperley (1999) profile
+	KeyProfileTemperley
+)
+
+func ParseKeyProfile(s string) (KeyProfile, error) {
+	switch strings.ToLower(s) {
+	case "krumhansl", "ks":
+		return KeyProfileKrumhansl, nil
+	case "temperley":
+		return KeyProfileTemperley, nil
+	}
+	return KeyProfileKrumhansl, fmt.Errorf("unknown key profile: %s", s)
+}
+
+// major and minor profiles with tonic at index 0
+func (p KeyProfile) profiles() ([]float64, []float64) {
+	if p == KeyProfileTemperley {
+		return []float64{5.0, 2.0, 3.5, 2.0, 4.5, 4.0, 2.0, 4.5, 2.0, 3.5, 1.5, 4.0},
+			[]float64{5.0, 2.0, 3.5, 4.5, 2.0, 4.0, 2.0, 4.5, 3.5, 2.0, 1.5, 4.0}
+	}
+	return []float64{6.35, 2.23, 3.48, 2.33, 4.38, 4.09, 2.52, 5.19, 2.39, 3.66, 2.29, 2.88},
+		[]float64{6.33, 2.68, 3.52, 5.38, 2.60, 3.53, 2.54, 4.75, 3.98, 2.69, 3.34, 3.17}
+}
+
+// Key is a musical key estimate
+type Key struct {
+	// tonic chroma bin, 0 is C
+	Tonic int
+	Minor bool
+	// correlation of chroma with the key profile
+	Correlation float64
+	// margin of the best correlation over the runner-up key
+	Confidence float64
+}
+
+func (k Key) String() string {
+	mode := "major"
+	if k.Minor {
+		mode = "minor"
+	}
+	return ChromaNoteNames[k.Tonic] + " " + mode
+}
+
+// Camelot returns key in Camelot wheel notation used for harmonic mixing,
+// e.g. 8B for C major and 8A for A minor
+func (k Key) Camelot() string {
+	tonic := k.Tonic
+	letter := "B"
+	if k.Minor {
+		// relative major
+		tonic = (tonic + 3) % 12
+		letter = "A"
+	}
+	// position on the circle of fifths, C major is 8
+	fifths := tonic * 7 % 12
+	return fmt.Sprintf("%d%s", (fifths+7)%12+1, letter)
+}
+
+// KeyScores returns correlations of 12 bin chroma vector with 24 key
+// profiles: 12 major keys from C followed by 12 minor keys
+func KeyScores(chroma []float64, profile KeyProfile) []float64 {
+	major, minor := profile.profiles()
+
+	scores := make([]float64, 24)
+	rotated := make([]float64, 12)
+	for tonic := range 12 {
+		for i := range rotated {
+			rotated[i] = major[(i-tonic+12)%12]
+		}
+		scores[tonic] = pearson(chroma, rotated)
+
+		for i := range rotated {
+			rotated[i] = minor[(i-tonic+12)%12]
+		}
+		scores[12+tonic] = pearson(chroma, rotated)
+	}
+
+	return scores
+}
+
+// EstimateKey returns the key of 12 bin chroma frames (Krumhansl-Schmuckler
+// algorithm): mean chroma is correlated with profiles of all 24 keys
+func EstimateKey(chroma [][]float64, profile KeyProfile) Key {
+	mean := make([]float64, 12)
+	for _, frame := range chroma {
+		for i, v := range frame[:min(len(frame), 12)] {
+			mean[i] += v
+		}
+	}
+
+	scores := KeyScores(mean, profile)
+
+	best, second := 0, 1
+	if scores[second] > scores[best] {
+		best, second = second, best
+	}
+	for i := 2; i < len(scores); i++ {
+		switch {
+		case scores[i] > scores[best]:
+			best, second = i, best
+		case scores[i] > scores[second]:
+			second = i
+		}
+	}
+
+	return Key{
+		Tonic:       best % 12,
+		Minor:       best >= 12,
+		Correlation: scores[best],
+		Confidence:  scores[best] - scores[second],
+	}
+}
+
+// pearson returns correlation coefficient of x and y, 0 for constant vectors
+func pearson(x []float64, y []float64) float64 {
+	n := float64(len(x))
+
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= n
+	my /= n
+
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+
+	return sxy / math.Sqrt(sxx*syy)
+}
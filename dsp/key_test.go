@@ -0,0 +1,46 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_EstimateKey(t *testing.T) {
+	sampleRate := 22050
+	nfft := 4096
+
+	// A minor chord progression: Am - Dm - E - Am
+	chords := [][]float64{
+		{220, 261.63, 329.63},
+		{293.66, 349.23, 440},
+		{329.63, 415.30, 493.88},
+		{220, 261.63, 329.63},
+	}
+	input := make([]float64, 0)
+	for _, chord := range chords {
+		for j := range sampleRate {
+			ts := float64(j) / float64(sampleRate)
+			var v float64
+			for _, f := range chord {
+				v += math.Sin(2 * math.Pi * f * ts)
+			}
+			input = append(input, v/3)
+		}
+	}
+
+	amp, _ := SplitSpectrogram(New(512, nfft).STFT(input))
+	chroma := NewChroma(sampleRate).FromSpectrogram(amp, nfft)
+
+	for _, profile := range []KeyProfile{KeyProfileKrumhansl, KeyProfileTemperley} {
+		key := EstimateKey(chroma, profile)
+		assert.Equal(t, "A minor", key.String())
+		assert.Equal(t, "8A", key.Camelot())
+		assert.Greater(t, key.Confidence, 0.0)
+	}
+
+	assert.Equal(t, "8B", Key{Tonic: 0}.Camelot())
+	assert.Equal(t, "2B", Key{Tonic: 6}.Camelot())
+	assert.Equal(t, "1A", Key{Tonic: 8, Minor: true}.Camelot())
+}
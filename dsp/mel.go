@@ -0,0 +1,230 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type MelScale int
+
+const (
+	// MelHTK is 2595 * log10(1 + f/700) scale, filters have peak 1
+	MelHTK MelScale = iota
+	// MelSlaney is linear below 1 kHz and logarithmic above (Auditory
+	// Toolbox), filters are area normalized
+	MelSlaney
+)
+
+func ParseMelScale(s string) (MelScale, error) {
+	switch strings.ToLower(s) {
+	case "htk":
+		return MelHTK, nil
+	case "slaney":
+		return MelSlaney, nil
+	}
+	return MelHTK, fmt.Errorf("unknown mel scale: %s", s)
+}
+
+const (
+	slaneyMinLogHz  = 1000.0
+	slaneyLinStep   = 200.0 / 3
+	slaneyMinLogMel = slaneyMinLogHz / slaneyLinStep
+)
+
+var slaneyLogStep = math.Log(6.4) / 27
+
+// HzToMel converts frequency to mel
+func HzToMel(freq float64, scale MelScale) float64 {
+	if scale == MelHTK {
+		return 2595 * math.Log10(1+freq/700)
+	}
+
+	if freq < slaneyMinLogHz {
+		return freq / slaneyLinStep
+	}
+	return slaneyMinLogMel + math.Log(freq/slaneyMinLogHz)/slaneyLogStep
+}
+
+// MelToHz converts mel to frequency
+func MelToHz(mel float64, scale MelScale) float64 {
+	if scale == MelHTK {
+		return 700 * (math.Pow(10, mel/2595) - 1)
+	}
+
+	if mel < slaneyMinLogMel {
+		return mel * slaneyLinStep
+	}
+	return slaneyMinLogHz * math.Exp(slaneyLogStep*(mel-slaneyMinLogMel))
+}
+
+// MelFilterbank is a set of triangular filters equally spaced on mel scale
+type MelFilterbank struct {
+	Scale MelScale
+	// filter center frequencies, Hz
+	CenterFreqs []float64
+	// filter weights for each FFT bin, NumMels x (nfft/2+1)
+	Filters [][]float64
+}
+
+// NewMelFilterbank returns numMels filters between minFreq and maxFreq for
+// spectrum of nfft points FFT (nfft/2+1 bins, as returned by STFT).
+func NewMelFilterbank(sampleRate int, nfft int, numMels int,
+	minFreq float64, maxFreq float64, scale MelScale,
+) *MelFilterbank {
+	if maxFreq <= 0 || maxFreq > float64(sampleRate)/2 {
+		maxFreq = float64(sampleRate) / 2
+	}
+
+	numBins := nfft/2 + 1
+	binFreqs := make([]float64, numBins)
+	for k := range binFreqs {
+		binFreqs[k] = float64(k) * float64(sampleRate) / float64(nfft)
+	}
+
+	// numMels+2 points: filter edges and centers
+	minMel := HzToMel(minFreq, scale)
+	maxMel := HzToMel(maxFreq, scale)
+	edges := make([]float64, numMels+2)
+	for i := range edges {
+		edges[i] = MelToHz(minMel+(maxMel-minMel)*float64(i)/float64(numMels+1), scale)
+	}
+
+	fb := MelFilterbank{
+		Scale:       scale,
+		CenterFreqs: make([]float64, numMels),
+		Filters:     create2DSlice(numMels, numBins),
+	}
+
+	for m := range numMels {
+		lower, center, upper := edges[m], edges[m+1], edges[m+2]
+		fb.CenterFreqs[m] = center
+
+		norm := 1.0
+		if scale == MelSlaney {
+			norm = 2 / (upper - lower)
+		}
+
+		for k, freq := range binFreqs {
+			var w float64
+			switch {
+			case freq > lower && freq <= center:
+				w = (freq - lower) / (center - lower)
+			case freq > center && freq < upper:
+				w = (upper - freq) / (upper - center)
+			}
+			fb.Filters[m][k] = w * norm
+		}
+	}
+
+	return &fb
+}
+
+// Apply returns filter energies for power spectrum frame
+func (fb *MelFilterbank) Apply(power []float64) []float64 {
+	out := make([]float64, len(fb.Filters))
+	for m, filter := range fb.Filters {
+		var sum float64
+		for k, w := range filter[:min(len(filter), len(power))] {
+			sum += w * power[k]
+		}
+		out[m] = sum
+	}
+	return out
+}
+
+// MelSpectrogram returns mel spectrogram of amplitude spectrogram (as
+// returned by SplitSpectrogram), filters are applied to power spectrum
+func (fb *MelFilterbank) MelSpectrogram(amp [][]float64) [][]float64 {
+	melSpec := make([][]float64, len(amp))
+
+	power := make([]float64, 0)
+	for i, frame := range amp {
+		power = power[:0]
+		for _, a := range frame {
+			power = append(power, a*a)
+		}
+		melSpec[i] = fb.Apply(power)
+	}
+
+	return melSpec
+}
+
+// LogMelSpectrogram converts mel power spectrogram to dB, values are
+// floored at 1e-10 power (-100 dB)
+func LogMelSpectrogram(melSpec [][]float64) [][]float64 {
+	const minPower = 1e-10
+
+	logMel := make([][]float64, len(melSpec))
+	for i, frame := range melSpec {
+		logMel[i] = make([]float64, len(frame))
+		for m, p := range frame {
+			logMel[i][m] = 10 * math.Log10(max(p, minPower))
+		}
+	}
+
+	return logMel
+}
+
+// MFCC returns first numCoeffs coefficients of orthonormal DCT-II of log-mel
+// frames
+func MFCC(logMel [][]float64, numCoeffs int) [][]float64 {
+	if len(logMel) == 0 {
+		return nil
+	}
+
+	numMels := len(logMel[0])
+	numCoeffs = min(numCoeffs, numMels)
+
+	// DCT-II basis
+	basis := create2DSlice(numCoeffs, numMels)
+	for c := range numCoeffs {
+		scale := math.Sqrt(2 / float64(numMels))
+		if c == 0 {
+			scale = math.Sqrt(1 / float64(numMels))
+		}
+		for m := range numMels {
+			basis[c][m] = scale * math.Cos(math.Pi*float64(c)*(float64(m)+0.5)/float64(numMels))
+		}
+	}
+
+	mfcc := create2DSlice(len(logMel), numCoeffs)
+	for i, frame := range logMel {
+		for c := range numCoeffs {
+			var sum float64
+			for m, v := range frame {
+				sum += basis[c][m] * v
+			}
+			mfcc[i][c] = sum
+		}
+	}
+
+	return mfcc
+}
+
+// Deltas returns regression deltas of features over +-width frames, edge
+// frames are repeated
+func Deltas(features [][]float64, width int) [][]float64 {
+	numFrames := len(features)
+	if numFrames == 0 {
+		return nil
+	}
+
+	var denom float64
+	for n := 1; n <= width; n++ {
+		denom += 2 * float64(n*n)
+	}
+
+	deltas := create2DSlice(numFrames, len(features[0]))
+	for t := range numFrames {
+		for n := 1; n <= width; n++ {
+			next := features[min(t+n, numFrames-1)]
+			prev := features[max(t-n, 0)]
+			for c := range deltas[t] {
+				deltas[t][c] += float64(n) * (next[c] - prev[c]) / denom
+			}
+		}
+	}
+
+	return deltas
+}
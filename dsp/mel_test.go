@@ -0,0 +1,57 @@
+package dsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MelScale(t *testing.T) {
+	assert.InDelta(t, 1000, HzToMel(1000, MelHTK), 0.1)
+	assert.InDelta(t, 15, HzToMel(1000, MelSlaney), 1e-9)
+
+	for _, scale := range []MelScale{MelHTK, MelSlaney} {
+		for _, f := range []float64{0, 440, 1000, 8000} {
+			assert.InDelta(t, f, MelToHz(HzToMel(f, scale), scale), 1e-6)
+		}
+	}
+}
+
+func Test_MelFilterbank(t *testing.T) {
+	fb := NewMelFilterbank(16000, 512, 40, 0, 0, MelHTK)
+	assert.Equal(t, 40, len(fb.Filters))
+	assert.Equal(t, 257, len(fb.Filters[0]))
+
+	for m := 1; m < len(fb.CenterFreqs); m++ {
+		assert.Greater(t, fb.CenterFreqs[m], fb.CenterFreqs[m-1])
+	}
+
+	// tone at the filter center excites this filter the most
+	power := make([]float64, 257)
+	power[64] = 1 // 2 kHz
+	energies := fb.Apply(power)
+	maxIdx := 0
+	for m, e := range energies {
+		if e > energies[maxIdx] {
+			maxIdx = m
+		}
+	}
+	assert.InDelta(t, 2000, fb.CenterFreqs[maxIdx], 100)
+}
+
+func Test_MFCCDeltas(t *testing.T) {
+	// flat log-mel frames have energy in c0 only
+	logMel := [][]float64{
+		{1, 1, 1, 1},
+		{2, 2, 2, 2},
+		{3, 3, 3, 3},
+	}
+	mfcc := MFCC(logMel, 3)
+	assert.InDelta(t, 2, mfcc[0][0], 1e-9)
+	assert.InDelta(t, 0, mfcc[0][1], 1e-9)
+	assert.InDelta(t, 0, mfcc[0][2], 1e-9)
+
+	deltas := Deltas(mfcc, 1)
+	assert.InDelta(t, 2, deltas[1][0], 1e-9)
+	assert.InDelta(t, 1, deltas[0][0], 1e-9)
+}
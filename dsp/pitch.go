@@ -0,0 +1,451 @@
+package dsp
+
+import (
+	"math"
+	"strconv"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// PitchFrame is f0 estimate of one analysis frame
+type PitchFrame struct {
+	// frame start time, seconds
+	Time float64
+	// fundamental frequency, 0 for unvoiced frames
+	Freq   float64
+	Voiced bool
+	// voicing probability (pYIN), or 1 - aperiodicity (YIN)
+	Probability float64
+}
+
+// PitchNote is a segment of voiced frames with the same (rounded) note
+type PitchNote struct {
+	Onset    float64
+	Duration float64
+	Midi     int
+	// mean deviation of f0 from the note, cents
+	Cents float64
+}
+
+// PitchTracker estimates f0 of monophonic signal with YIN or pYIN
+type PitchTracker struct {
+	SampleRate int
+	MinFreq    float64
+	MaxFreq    float64
+	FrameShift int
+	// YIN aperiodicity threshold
+	Threshold float64
+
+	minLag   int
+	maxLag   int
+	winLen   int
+	fftLen   int
+	fft      *fourier.FFT
+	frameBuf []float64
+}
+
+// NewPitchTracker returns tracker for f0 in [minFreq, maxFreq] range with
+// 10ms hop
+func NewPitchTracker(sampleRate int, minFreq float64, maxFreq float64) *PitchTracker {
+	p := PitchTracker{
+		SampleRate: sampleRate,
+		MinFreq:    minFreq,
+		MaxFreq:    maxFreq,
+		FrameShift: sampleRate / 100,
+		Threshold:  0.1,
+	}
+
+	p.minLag = max(2, int(math.Floor(float64(sampleRate)/maxFreq)))
+	p.maxLag = int(math.Ceil(float64(sampleRate) / minFreq))
+	// integration window covers a period of the lowest frequency
+	p.winLen = p.maxLag
+
+	p.fftLen = 1
+	for p.fftLen < 2*(p.winLen+p.maxLag) {
+		p.fftLen *= 2
+	}
+	p.fft = fourier.NewFFT(p.fftLen)
+	p.frameBuf = make([]float64, p.fftLen)
+
+	return &p
+}
+
+// FrameLen returns analyzed samples per frame
+func (p *PitchTracker) FrameLen() int {
+	return p.winLen + p.maxLag
+}
+
+// NumFrames returns the number of analyzed frames
+func (p *PitchTracker) NumFrames(input []float64) int {
+	if len(input) < p.FrameLen() {
+		return 0
+	}
+	return (len(input)-p.FrameLen())/p.FrameShift + 1
+}
+
+// cmndf returns cumulative mean normalized difference function of frame
+func (p *PitchTracker) cmndf(frame []float64) []float64 {
+	w := p.winLen
+
+	// autocorrelation r(tau) = sum x[j]*x[j+tau], j < w, by FFT
+	clear(p.frameBuf)
+	copy(p.frameBuf, frame)
+	full := p.fft.Coefficients(nil, p.frameBuf)
+
+	clear(p.frameBuf)
+	copy(p.frameBuf, frame[:w])
+	head := p.fft.Coefficients(nil, p.frameBuf)
+
+	for i := range full {
+		full[i] *= complex(real(head[i]), -imag(head[i]))
+	}
+	r := p.fft.Sequence(nil, full)
+	scale := 1 / float64(p.fftLen)
+
+	// energies of sliding windows
+	cum := make([]float64, len(frame)+1)
+	for i, x := range frame {
+		cum[i+1] = cum[i] + x*x
+	}
+	e0 := cum[w]
+
+	d := make([]float64, p.maxLag+1)
+	d[0] = 1
+	var runningSum float64
+	for tau := 1; tau <= p.maxLag; tau++ {
+		diff := e0 + (cum[tau+w] - cum[tau]) - 2*r[tau]*scale
+		diff = max(diff, 0)
+		runningSum += diff
+		if runningSum > 0 {
+			d[tau] = diff * float64(tau) / runningSum
+		} else {
+			d[tau] = 1
+		}
+	}
+
+	return d
+}
+
+// refineLag returns lag with parabolic interpolation around local minimum
+func refineLag(d []float64, tau int) float64 {
+	if tau <= 0 || tau >= len(d)-1 {
+		return float64(tau)
+	}
+	a, b, c := d[tau-1], d[tau], d[tau+1]
+	den := a - 2*b + c
+	if den == 0 {
+		return float64(tau)
+	}
+	return float64(tau) + 0.5*(a-c)/den
+}
+
+// thresholdDip returns first local minimum of d below threshold, -1 if none
+func (p *PitchTracker) thresholdDip(d []float64, threshold float64) int {
+	for tau := p.minLag; tau <= p.maxLag; tau++ {
+		if d[tau] < threshold {
+			for tau+1 <= p.maxLag && d[tau+1] < d[tau] {
+				tau++
+			}
+			return tau
+		}
+	}
+	return -1
+}
+
+func (p *PitchTracker) globalMin(d []float64) int {
+	best := p.minLag
+	for tau := p.minLag; tau <= p.maxLag; tau++ {
+		if d[tau] < d[best] {
+			best = tau
+		}
+	}
+	return best
+}
+
+// YIN returns f0 estimates by YIN algorithm, frames with aperiodicity above
+// Threshold are unvoiced
+func (p *PitchTracker) YIN(input []float64) []PitchFrame {
+	numFrames := p.NumFrames(input)
+	frames := make([]PitchFrame, numFrames)
+
+	for i := range numFrames {
+		start := i * p.FrameShift
+		d := p.cmndf(input[start : start+p.FrameLen()])
+
+		frames[i].Time = float64(start) / float64(p.SampleRate)
+
+		tau := p.thresholdDip(d, p.Threshold)
+		if tau < 0 {
+			frames[i].Probability = max(0, 1-d[p.globalMin(d)])
+			continue
+		}
+
+		frames[i].Freq = float64(p.SampleRate) / refineLag(d, tau)
+		frames[i].Voiced = true
+		frames[i].Probability = max(0, 1-d[tau])
+	}
+
+	return frames
+}
+
+// pYIN thresholds and their Beta(2, 18) probabilities
+func pyinThresholds() ([]float64, []float64) {
+	const n = 100
+
+	thresholds := make([]float64, n)
+	probs := make([]float64, n)
+	var sum float64
+	for i := range n {
+		t := (float64(i) + 1) / n
+		thresholds[i] = t
+		probs[i] = t * math.Pow(1-t, 17)
+		sum += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+
+	return thresholds, probs
+}
+
+type pitchCandidate struct {
+	freq float64
+	prob float64
+}
+
+// PYIN returns f0 estimates by probabilistic YIN: pitch candidates are
+// weighted over a distribution of thresholds and the pitch track with
+// voicing decisions is decoded with Viterbi over 20 cents pitch bins
+func (p *PitchTracker) PYIN(input []float64) []PitchFrame {
+	numFrames := p.NumFrames(input)
+	if numFrames == 0 {
+		return nil
+	}
+
+	thresholds, thresholdProbs := pyinThresholds()
+
+	// prior of global minimum when no dip is below the threshold
+	const globalMinPrior = 0.01
+
+	candidates := make([][]pitchCandidate, numFrames)
+	frames := make([]PitchFrame, numFrames)
+
+	for i := range numFrames {
+		start := i * p.FrameShift
+		d := p.cmndf(input[start : start+p.FrameLen()])
+		frames[i].Time = float64(start) / float64(p.SampleRate)
+
+		lagProbs := make(map[int]float64)
+		for j, threshold := range thresholds {
+			tau := p.thresholdDip(d, threshold)
+			if tau < 0 {
+				lagProbs[p.globalMin(d)] += thresholdProbs[j] * globalMinPrior
+				continue
+			}
+			lagProbs[tau] += thresholdProbs[j]
+		}
+
+		var voicedProb float64
+		for tau, prob := range lagProbs {
+			candidates[i] = append(candidates[i], pitchCandidate{
+				freq: float64(p.SampleRate) / refineLag(d, tau),
+				prob: prob,
+			})
+			voicedProb += prob
+		}
+		frames[i].Probability = min(voicedProb, 1)
+	}
+
+	p.viterbi(frames, candidates)
+
+	return frames
+}
+
+// viterbi decodes the most likely pitch bin and voicing for each frame
+func (p *PitchTracker) viterbi(frames []PitchFrame, candidates [][]pitchCandidate) {
+	const (
+		binCents    = 20.0
+		maxJumpBins = 25
+		switchProb  = 0.01
+		minProb     = 1e-12
+	)
+
+	numBins := int(math.Ceil(1200*math.Log2(p.MaxFreq/p.MinFreq)/binCents)) + 1
+	binOf := func(freq float64) int {
+		b := int(math.Round(1200 * math.Log2(freq/p.MinFreq) / binCents))
+		return min(max(b, 0), numBins-1)
+	}
+
+	// jump weights, triangular, normalized
+	jumpWeights := make([]float64, 2*maxJumpBins+1)
+	var jumpSum float64
+	for j := range jumpWeights {
+		jumpWeights[j] = float64(maxJumpBins + 1 - abs(j-maxJumpBins))
+		jumpSum += jumpWeights[j]
+	}
+	for j := range jumpWeights {
+		jumpWeights[j] = math.Log(jumpWeights[j] / jumpSum)
+	}
+	logStay := math.Log(1 - switchProb)
+	logSwitch := math.Log(switchProb)
+
+	// states: [0, numBins) voiced, [numBins, 2*numBins) unvoiced
+	numStates := 2 * numBins
+	numFrames := len(frames)
+
+	observation := func(i int) []float64 {
+		obs := make([]float64, numStates)
+		var voicedProb float64
+		for _, c := range candidates[i] {
+			if c.freq < p.MinFreq || c.freq > p.MaxFreq {
+				continue
+			}
+			obs[binOf(c.freq)] += c.prob
+			voicedProb += c.prob
+		}
+		unvoiced := max(1-voicedProb, 0) / float64(numBins)
+		for b := range numBins {
+			obs[b] = math.Log(max(obs[b], minProb))
+			obs[numBins+b] = math.Log(max(unvoiced, minProb))
+		}
+		return obs
+	}
+
+	score := observation(0)
+	back := make([][]int32, numFrames)
+
+	next := make([]float64, numStates)
+	for i := 1; i < numFrames; i++ {
+		obs := observation(i)
+		back[i] = make([]int32, numStates)
+
+		for s := range numStates {
+			bin := s % numBins
+			voiced := s < numBins
+
+			best := math.Inf(-1)
+			bestPrev := 0
+			for j := -maxJumpBins; j <= maxJumpBins; j++ {
+				prevBin := bin + j
+				if prevBin < 0 || prevBin >= numBins {
+					continue
+				}
+				for _, prevVoiced := range []bool{true, false} {
+					prev := prevBin
+					if !prevVoiced {
+						prev += numBins
+					}
+					trans := jumpWeights[j+maxJumpBins] + logStay
+					if prevVoiced != voiced {
+						trans = jumpWeights[j+maxJumpBins] + logSwitch
+					}
+					if v := score[prev] + trans; v > best {
+						best = v
+						bestPrev = prev
+					}
+				}
+			}
+			next[s] = best + obs[s]
+			back[i][s] = int32(bestPrev)
+		}
+		score, next = next, score
+	}
+
+	state := 0
+	for s := range numStates {
+		if score[s] > score[state] {
+			state = s
+		}
+	}
+
+	for i := numFrames - 1; i >= 0; i-- {
+		bin := state % numBins
+		frames[i].Voiced = state < numBins
+		frames[i].Freq = 0
+		if frames[i].Voiced {
+			// closest candidate refines the bin frequency
+			frames[i].Freq = p.MinFreq * math.Pow(2, float64(bin)*binCents/1200)
+			bestProb := 0.0
+			for _, c := range candidates[i] {
+				if c.freq >= p.MinFreq && c.freq <= p.MaxFreq && binOf(c.freq) == bin && c.prob > bestProb {
+					bestProb = c.prob
+					frames[i].Freq = c.freq
+				}
+			}
+		}
+		if i > 0 {
+			state = int(back[i][state])
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// FreqToMidi returns fractional MIDI note number of the frequency
+func FreqToMidi(freq float64) float64 {
+	return 69 + 12*math.Log2(freq/440)
+}
+
+// MidiNoteName returns note name with octave, e.g. C#4
+func MidiNoteName(midi int) string {
+	// floor division, notes below C-1 have negative MIDI numbers
+	octave := midi / 12
+	if midi < 0 && midi%12 != 0 {
+		octave--
+	}
+	return ChromaNoteNames[((midi%12)+12)%12] + strconv.Itoa(octave-1)
+}
+
+// SegmentNotes groups consecutive voiced frames with the same rounded MIDI
+// note into notes, notes shorter than minDuration seconds are dropped
+func SegmentNotes(frames []PitchFrame, frameDuration float64, minDuration float64) []PitchNote {
+	notes := make([]PitchNote, 0)
+
+	var cur *PitchNote
+	var centsSum float64
+	var count int
+
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		cur.Duration = float64(count) * frameDuration
+		cur.Cents = centsSum / float64(count)
+		if cur.Duration >= minDuration {
+			notes = append(notes, *cur)
+		}
+		cur = nil
+	}
+
+	for i, f := range frames {
+		if !f.Voiced || f.Freq <= 0 {
+			flush()
+			continue
+		}
+
+		pitch := FreqToMidi(f.Freq)
+		midi := int(math.Round(pitch))
+
+		// a gap in frames ends the note as well
+		gap := i > 0 && cur != nil && f.Time-frames[i-1].Time > 1.5*frameDuration
+		if cur == nil || cur.Midi != midi || gap {
+			flush()
+			cur = &PitchNote{
+				Onset: f.Time,
+				Midi:  midi,
+			}
+			centsSum = 0
+			count = 0
+		}
+		centsSum += 100 * (pitch - float64(midi))
+		count++
+	}
+	flush()
+
+	return notes
+}
@@ -0,0 +1,57 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_PitchTrack(t *testing.T) {
+	sampleRate := 22050
+
+	// A3 for 0.5 sec, silence for 0.2 sec, C#4 + 10 cents for 0.5 sec
+	freqs := []float64{220, 0, 277.18 * math.Pow(2, 0.1/12)}
+	durs := []float64{0.5, 0.2, 0.5}
+
+	input := make([]float64, 0)
+	for i, f := range freqs {
+		n := int(durs[i] * float64(sampleRate))
+		for j := range n {
+			ts := float64(j) / float64(sampleRate)
+			// harmonic tone
+			v := math.Sin(2*math.Pi*f*ts) + 0.5*math.Sin(4*math.Pi*f*ts) + 0.25*math.Sin(6*math.Pi*f*ts)
+			input = append(input, 0.5*v)
+		}
+	}
+
+	p := NewPitchTracker(sampleRate, 60, 1000)
+
+	yin := p.YIN(input)
+	assert.Equal(t, p.NumFrames(input), len(yin))
+	assert.True(t, yin[10].Voiced)
+	assert.InDelta(t, 220, yin[10].Freq, 0.5)
+
+	frames := p.PYIN(input)
+	assert.Equal(t, len(yin), len(frames))
+	assert.True(t, frames[20].Voiced)
+	assert.InDelta(t, 220, frames[20].Freq, 0.5)
+	assert.False(t, frames[58].Voiced)
+	assert.Greater(t, frames[20].Probability, 0.9)
+
+	frameDur := float64(p.FrameShift) / float64(sampleRate)
+	notes := SegmentNotes(frames, frameDur, 0.05)
+	assert.Equal(t, 2, len(notes))
+	assert.Equal(t, "A3", MidiNoteName(notes[0].Midi))
+	assert.Equal(t, "C#4", MidiNoteName(notes[1].Midi))
+	assert.InDelta(t, 0.5, notes[0].Duration, 0.05)
+	assert.InDelta(t, 0.7, notes[1].Onset, 0.05)
+	assert.InDelta(t, 10, notes[1].Cents, 2)
+}
+
+func Test_MidiNoteName(t *testing.T) {
+	assert.Equal(t, "A4", MidiNoteName(69))
+	assert.Equal(t, "C-1", MidiNoteName(0))
+	assert.Equal(t, "B-2", MidiNoteName(-1))
+	assert.Equal(t, "C-2", MidiNoteName(-12))
+}
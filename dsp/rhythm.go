@@ -0,0 +1,334 @@
+package dsp
+
+import (
+	"math"
+	"slices"
+)
+
+// OnsetStrength returns spectral flux onset strength of amplitude
+// spectrogram (as returned by SplitSpectrogram): mean positive difference of
+// dB spectra of consecutive frames
+func OnsetStrength(amp [][]float64) []float64 {
+	if len(amp) == 0 {
+		return nil
+	}
+	return OnsetStrengthBand(amp, 0, len(amp[0]))
+}
+
+// OnsetStrengthBand returns spectral flux onset strength of bins in
+// [minBin, maxBin) range
+func OnsetStrengthBand(amp [][]float64, minBin int, maxBin int) []float64 {
+	env := make([]float64, len(amp))
+	if len(amp) == 0 {
+		return env
+	}
+	minBin = max(minBin, 0)
+	maxBin = min(maxBin, len(amp[0]))
+	if maxBin <= minBin {
+		return env
+	}
+
+	// dB floor 80 dB below spectrogram maximum
+	var maxAmp float64
+	for _, frame := range amp {
+		for _, a := range frame[minBin:maxBin] {
+			maxAmp = max(maxAmp, a)
+		}
+	}
+	floor := max(maxAmp*1e-4, 1e-12)
+
+	prev := make([]float64, maxBin-minBin)
+	cur := make([]float64, maxBin-minBin)
+	for i, frame := range amp {
+		for k, a := range frame[minBin:maxBin] {
+			cur[k] = 20 * math.Log10(max(a, floor))
+		}
+		if i > 0 {
+			var flux float64
+			for k := range cur {
+				flux += max(cur[k]-prev[k], 0)
+			}
+			env[i] = flux / float64(len(cur))
+		}
+		prev, cur = cur, prev
+	}
+
+	return env
+}
+
+// PeakPicker selects onsets from onset strength envelope: a frame is an onset
+// when it is maximum over [n-PreMax, n+PostMax] frames, exceeds mean over
+// [n-PreAvg, n+PostAvg] frames by Delta (relative to envelope maximum) and is
+// at least Wait frames after the previous onset
+type PeakPicker struct {
+	PreMax  int
+	PostMax int
+	PreAvg  int
+	PostAvg int
+	Delta   float64
+	Wait    int
+}
+
+// NewPeakPicker returns peak picker with defaults for envelope of frameRate
+// frames per second
+func NewPeakPicker(frameRate float64) *PeakPicker {
+	frames := func(sec float64) int {
+		return max(1, int(math.Round(sec*frameRate)))
+	}
+
+	return &PeakPicker{
+		PreMax:  frames(0.03),
+		PostMax: frames(0.03),
+		PreAvg:  frames(0.1),
+		PostAvg: frames(0.07),
+		Delta:   0.07,
+		Wait:    frames(0.03),
+	}
+}
+
+// Pick returns onset frames of envelope
+func (p *PeakPicker) Pick(env []float64) []int {
+	onsets := make([]int, 0)
+	if len(env) == 0 {
+		return onsets
+	}
+
+	delta := p.Delta * slices.Max(env)
+
+	last := -p.Wait - 1
+	for n, v := range env {
+		if n-last <= p.Wait {
+			continue
+		}
+
+		isMax := true
+		for i := max(n-p.PreMax, 0); i <= min(n+p.PostMax, len(env)-1); i++ {
+			if env[i] > v {
+				isMax = false
+				break
+			}
+		}
+		if !isMax {
+			continue
+		}
+
+		var sum float64
+		lo, hi := max(n-p.PreAvg, 0), min(n+p.PostAvg, len(env)-1)
+		for i := lo; i <= hi; i++ {
+			sum += env[i]
+		}
+		if v < sum/float64(hi-lo+1)+delta || v <= 0 {
+			continue
+		}
+
+		onsets = append(onsets, n)
+		last = n
+	}
+
+	return onsets
+}
+
+// EstimateTempo returns tempo in BPM from autocorrelation of onset strength
+// envelope of frameRate frames per second. Autocorrelation is weighted with
+// log-normal prior centered at 120 BPM to prefer tempo octave of the beat.
+func EstimateTempo(env []float64, frameRate float64, minBPM float64, maxBPM float64) float64 {
+	const (
+		priorBPM        = 120.0
+		priorStdOctaves = 1.0
+	)
+
+	minLag := max(1, int(math.Floor(60*frameRate/maxBPM)))
+	maxLag := int(math.Ceil(60 * frameRate / minBPM))
+	if len(env) <= maxLag+1 {
+		return 0
+	}
+
+	var mean float64
+	for _, v := range env {
+		mean += v
+	}
+	mean /= float64(len(env))
+
+	x := make([]float64, len(env))
+	for i, v := range env {
+		x[i] = v - mean
+	}
+
+	ac := make([]float64, maxLag+2)
+	for lag := range ac {
+		var sum float64
+		for i := lag; i < len(x); i++ {
+			sum += x[i] * x[i-lag]
+		}
+		// unbiased
+		ac[lag] = sum / float64(len(x)-lag)
+	}
+
+	weighted := func(lag int) float64 {
+		bpm := 60 * frameRate / float64(lag)
+		w := math.Log2(bpm/priorBPM) / priorStdOctaves
+		return ac[lag] * math.Exp(-0.5*w*w)
+	}
+
+	best := minLag
+	for lag := minLag; lag <= maxLag; lag++ {
+		if weighted(lag) > weighted(best) {
+			best = lag
+		}
+	}
+	if ac[best] <= 0 {
+		return 0
+	}
+
+	return 60 * frameRate / refineLag(ac, best)
+}
+
+// TrackBeats returns beat frames of onset strength envelope for tempo in BPM
+// by dynamic programming (Ellis 2007). Tightness penalizes deviations of
+// inter-beat intervals from the tempo period, 100 is a usual value.
+func TrackBeats(env []float64, frameRate float64, bpm float64, tightness float64) []int {
+	beats := make([]int, 0)
+	if len(env) == 0 || bpm <= 0 {
+		return beats
+	}
+
+	period := 60 * frameRate / bpm
+
+	// envelope normalized by standard deviation
+	var mean, sq float64
+	for _, v := range env {
+		mean += v
+		sq += v * v
+	}
+	mean /= float64(len(env))
+	std := math.Sqrt(max(sq/float64(len(env))-mean*mean, 0))
+	if std == 0 {
+		return beats
+	}
+
+	// local score is envelope smoothed with gaussian of period/32 width
+	half := int(math.Round(period))
+	kernel := make([]float64, 2*half+1)
+	for i := range kernel {
+		t := float64(i-half) * 32 / period
+		kernel[i] = math.Exp(-0.5 * t * t)
+	}
+	localScore := make([]float64, len(env))
+	for n := range env {
+		var sum float64
+		for i, w := range kernel {
+			idx := n + i - half
+			if idx >= 0 && idx < len(env) {
+				sum += w * env[idx] / std
+			}
+		}
+		localScore[n] = sum
+	}
+
+	cumScore := make([]float64, len(env))
+	backlink := make([]int, len(env))
+
+	minPrev := int(math.Round(period / 2))
+	maxPrev := int(math.Round(2 * period))
+	for n := range env {
+		backlink[n] = -1
+		best := math.Inf(-1)
+		for prev := n - maxPrev; prev <= n-minPrev; prev++ {
+			if prev < 0 {
+				continue
+			}
+			l := math.Log(float64(n-prev) / period)
+			if score := cumScore[prev] - tightness*l*l; score > best {
+				best = score
+				backlink[n] = prev
+			}
+		}
+		cumScore[n] = localScore[n]
+		if backlink[n] >= 0 {
+			cumScore[n] += best
+		}
+	}
+
+	// last beat is the last local maximum of cumulative score above half of
+	// median local maximum
+	maxima := make([]int, 0)
+	for n := 1; n < len(cumScore)-1; n++ {
+		if cumScore[n] > cumScore[n-1] && cumScore[n] >= cumScore[n+1] {
+			maxima = append(maxima, n)
+		}
+	}
+	if len(maxima) == 0 {
+		return beats
+	}
+	vals := make([]float64, len(maxima))
+	for i, n := range maxima {
+		vals[i] = cumScore[n]
+	}
+	slices.Sort(vals)
+	threshold := 0.5 * vals[len(vals)/2]
+
+	last := maxima[len(maxima)-1]
+	for i := len(maxima) - 1; i >= 0; i-- {
+		if cumScore[maxima[i]] >= threshold {
+			last = maxima[i]
+			break
+		}
+	}
+
+	for n := last; n >= 0; n = backlink[n] {
+		beats = append(beats, n)
+	}
+	slices.Reverse(beats)
+
+	// trim weak beats at the edges
+	var rms float64
+	for _, b := range beats {
+		rms += localScore[b] * localScore[b]
+	}
+	rms = math.Sqrt(rms / float64(len(beats)))
+	for len(beats) > 0 && localScore[beats[0]] < 0.5*rms {
+		beats = beats[1:]
+	}
+	for len(beats) > 0 && localScore[beats[len(beats)-1]] < 0.5*rms {
+		beats = beats[:len(beats)-1]
+	}
+
+	return beats
+}
+
+// BeatStrength returns maximum of envelope within +-radius frames of beats
+func BeatStrength(env []float64, beats []int, radius int) []float64 {
+	strength := make([]float64, len(beats))
+	for i, b := range beats {
+		for j := max(b-radius, 0); j <= min(b+radius, len(env)-1); j++ {
+			strength[i] = max(strength[i], env[j])
+		}
+	}
+	return strength
+}
+
+// DownbeatPhase returns index of the first downbeat among beats, the bar
+// phase with the strongest mean accent (e.g. low frequency onset strength at
+// beats) wins
+func DownbeatPhase(beatStrength []float64, beatsPerBar int) int {
+	if beatsPerBar < 1 {
+		return 0
+	}
+
+	best := 0
+	bestMean := math.Inf(-1)
+	for phase := range min(beatsPerBar, len(beatStrength)) {
+		var sum float64
+		var count int
+		for i := phase; i < len(beatStrength); i += beatsPerBar {
+			sum += beatStrength[i]
+			count++
+		}
+		if mean := sum / float64(count); mean > bestMean {
+			bestMean = mean
+			best = phase
+		}
+	}
+
+	return best
+}
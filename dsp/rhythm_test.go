@@ -0,0 +1,60 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_TempoBeats(t *testing.T) {
+	sampleRate := 22050
+	frameShift := sampleRate / 100
+	frameLen := 2048
+	frameRate := float64(sampleRate) / float64(frameShift)
+
+	// 120 BPM clicks starting at 0.25 sec, second beat of each bar is
+	// accented with low frequency kick
+	rnd := rand.New(rand.NewSource(1))
+	input := make([]float64, sampleRate*12)
+	numBeats := 0
+	for beat := 0.25; beat < 11.5; beat += 0.5 {
+		start := int(beat * float64(sampleRate))
+		for j := range sampleRate / 10 {
+			decay := math.Exp(-float64(j) / float64(sampleRate) * 60)
+			input[start+j] += 0.3 * decay * (rnd.Float64()*2 - 1)
+			if numBeats%4 == 1 {
+				input[start+j] += 0.8 * decay * math.Sin(2*math.Pi*60*float64(j)/float64(sampleRate))
+			}
+		}
+		numBeats++
+	}
+
+	amp, _ := SplitSpectrogram(New(frameShift, frameLen).STFT(input))
+	env := OnsetStrength(amp)
+	assert.Equal(t, len(amp), len(env))
+
+	onsets := NewPeakPicker(frameRate).Pick(env)
+	assert.InDelta(t, numBeats, len(onsets), 1)
+
+	bpm := EstimateTempo(env, frameRate, 40, 240)
+	assert.InDelta(t, 120, bpm, 2)
+
+	beats := TrackBeats(env, frameRate, bpm, 100)
+	assert.InDelta(t, numBeats, len(beats), 2)
+	for i := 1; i < len(beats); i++ {
+		assert.InDelta(t, 50, beats[i]-beats[i-1], 2)
+	}
+
+	// onset frames precede click times by half of the frame
+	first := (float64(beats[0]*frameShift) + float64(frameLen)/2) / float64(sampleRate)
+	phase := math.Mod(first-0.25, 0.5)
+	assert.True(t, phase < 0.05 || phase > 0.45, "beat phase %f", phase)
+
+	lowBins := 150 * frameLen / sampleRate
+	lowEnv := OnsetStrengthBand(amp, 0, lowBins)
+	downbeat := DownbeatPhase(BeatStrength(lowEnv, beats, 3), 4)
+	beatIdx := int(math.Round((first - 0.25) / 0.5))
+	assert.Equal(t, 1, (beatIdx+downbeat)%4)
+}
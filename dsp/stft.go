@@ -3,7 +3,8 @@ package dsp
 import (
 	"math"
 	"math/cmplx"
-	"slices"
+	"runtime"
+	"sync"
 
 	"gonum.org/v1/gonum/dsp/fourier"
 	"gonum.org/v1/gonum/dsp/window"
@@ -13,6 +14,10 @@ type STFT struct {
 	FrameShift int
 	FrameLen   int
 	Window     func([]float64) []float64 // window function
+	// FFT size, frames are zero-padded to it, 0 - FrameLen
+	NFFT int
+	// number of goroutines computing frames, 0 - GOMAXPROCS
+	Workers int
 }
 
 // New returns a new STFT instance.
@@ -28,7 +33,14 @@ func New(frameShift, frameLen int) *STFT {
 
 // NumFrames returnrs the number of frames that will be analyzed in STFT.
 func (s *STFT) NumFrames(input []float64) int {
-	return int(float64(len(input)-s.FrameLen)/float64(s.FrameShift)) + 1
+	return s.numFrames(len(input))
+}
+
+func (s *STFT) numFrames(inputLen int) int {
+	if inputLen < s.FrameLen {
+		return 0
+	}
+	return (inputLen-s.FrameLen)/s.FrameShift + 1
 }
 
 // DivideFrames returns overlapping divided frames for STFT.
@@ -47,27 +59,205 @@ func (s *STFT) FrameAt(input []float64, index int) []float64 {
 	return input[index*s.FrameShift : index*s.FrameShift+s.FrameLen]
 }
 
+// FFTLen returns FFT size of frames
+func (s *STFT) FFTLen() int {
+	return max(s.NFFT, s.FrameLen)
+}
+
+// NumBins returns the number of frequency bins of a spectrum frame, bin k is
+// k*sampleRate/FFTLen() Hz
+func (s *STFT) NumBins() int {
+	return s.FFTLen()/2 + 1
+}
+
+// windowCoeffs returns window function values, rectangular for nil Window
+func (s *STFT) windowCoeffs() []float64 {
+	win := make([]float64, s.FrameLen)
+	for i := range win {
+		win[i] = 1
+	}
+	if s.Window != nil {
+		win = s.Window(win)
+	}
+	return win
+}
+
+// stftWorker holds FFT plan and buffers of one goroutine
+type stftWorker struct {
+	fft    *fourier.FFT
+	frame  []float64
+	coeffs []complex128
+}
+
+// forEachFrame windows frames of input and calls fn for them, frames are
+// split into contiguous ranges processed by parallel workers
+func forEachFrame[T float32 | float64](s *STFT, input []T, fn func(w *stftWorker, index int)) {
+	numFrames := s.numFrames(len(input))
+	if numFrames == 0 {
+		return
+	}
+
+	win := s.windowCoeffs()
+	nfft := s.FFTLen()
+
+	workers := s.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, numFrames)
+	chunk := (numFrames + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for from := 0; from < numFrames; from += chunk {
+		to := min(from+chunk, numFrames)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// samples after FrameLen stay zero padding
+			w := stftWorker{
+				fft:    fourier.NewFFT(nfft),
+				frame:  make([]float64, nfft),
+				coeffs: make([]complex128, nfft/2+1),
+			}
+			for i := from; i < to; i++ {
+				src := input[i*s.FrameShift : i*s.FrameShift+s.FrameLen]
+				for k, v := range src {
+					w.frame[k] = float64(v) * win[k]
+				}
+				fn(&w, i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 // STFT returns complex spectrogram given an input signal.
 func (s *STFT) STFT(input []float64) [][]complex128 {
 	numFrames := s.NumFrames(input)
+	numBins := s.NumBins()
+
+	// one allocation for all frames
+	data := make([]complex128, numFrames*numBins)
 	spectrogram := make([][]complex128, numFrames)
+	for i := range spectrogram {
+		spectrogram[i] = data[i*numBins : (i+1)*numBins : (i+1)*numBins]
+	}
+
+	forEachFrame(s, input, func(w *stftWorker, i int) {
+		w.fft.Coefficients(spectrogram[i], w.frame)
+	})
+
+	return spectrogram
+}
+
+// Magnitude returns amplitude spectrogram given an input signal, it is the
+// same as amplitude of SplitSpectrogram of STFT without the complex matrix.
+func (s *STFT) Magnitude(input []float64) [][]float64 {
+	numFrames := s.NumFrames(input)
+	amp := create2DSlice(numFrames, s.NumBins())
 
-	fft := fourier.NewFFT(s.FrameLen)
+	forEachFrame(s, input, func(w *stftWorker, i int) {
+		coeffs := w.fft.Coefficients(w.coeffs, w.frame)
+		for k, c := range coeffs {
+			amp[i][k] = cmplx.Abs(c)
+		}
+	})
 
-	frames := s.DivideFrames(input)
-	for i, frame := range frames {
-		// Windowing
-		frameCopy := slices.Clone(frame)
-		windowed := s.Window(frameCopy)
-		// Complex Spectrum
-		coeff := fft.Coefficients(nil, windowed)
+	return amp
+}
 
-		spectrogram[i] = coeff
+// STFTComplex64 returns complex spectrogram of float32 signal in reduced
+// precision, it halves memory of large spectrograms. FFT is computed in
+// float64 precision, it is not faster than STFT.
+func (s *STFT) STFTComplex64(input []float32) [][]complex64 {
+	numFrames := s.numFrames(len(input))
+	numBins := s.NumBins()
+
+	data := make([]complex64, numFrames*numBins)
+	spectrogram := make([][]complex64, numFrames)
+	for i := range spectrogram {
+		spectrogram[i] = data[i*numBins : (i+1)*numBins : (i+1)*numBins]
 	}
 
+	forEachFrame(s, input, func(w *stftWorker, i int) {
+		coeffs := w.fft.Coefficients(w.coeffs, w.frame)
+		for k, c := range coeffs {
+			spectrogram[i][k] = complex64(c)
+		}
+	})
+
 	return spectrogram
 }
 
+// MagnitudeFloat32 returns amplitude spectrogram of float32 signal in reduced
+// precision, FFT is computed in float64 precision as in STFTComplex64.
+func (s *STFT) MagnitudeFloat32(input []float32) [][]float32 {
+	numFrames := s.numFrames(len(input))
+	numBins := s.NumBins()
+
+	data := make([]float32, numFrames*numBins)
+	amp := make([][]float32, numFrames)
+	for i := range amp {
+		amp[i] = data[i*numBins : (i+1)*numBins : (i+1)*numBins]
+	}
+
+	forEachFrame(s, input, func(w *stftWorker, i int) {
+		coeffs := w.fft.Coefficients(w.coeffs, w.frame)
+		for k, c := range coeffs {
+			amp[i][k] = float32(cmplx.Abs(c))
+		}
+	})
+
+	return amp
+}
+
+// ISTFT returns signal reconstructed from complex spectrogram by weighted
+// overlap-add: each inverse transformed frame is multiplied by the analysis
+// window and the sum is normalized by the sum of squared windows. Signal is
+// reconstructed perfectly where the squared windows sum is non zero, e.g.
+// for Hann window with hop of FrameLen/4. Zero padding of frames to NFFT is
+// dropped.
+func (s *STFT) ISTFT(spectrogram [][]complex128) []float64 {
+	numFrames := len(spectrogram)
+	if numFrames == 0 {
+		return nil
+	}
+
+	signal := make([]float64, (numFrames-1)*s.FrameShift+s.FrameLen)
+	windowSum := make([]float64, len(signal))
+
+	win := s.windowCoeffs()
+
+	nfft := s.FFTLen()
+	fft := fourier.NewFFT(nfft)
+	frame := make([]float64, nfft)
+	scale := 1 / float64(nfft)
+
+	for i, spec := range spectrogram {
+		frame = fft.Sequence(frame, spec)
+
+		offset := i * s.FrameShift
+		for t, v := range frame[:s.FrameLen] {
+			signal[offset+t] += v * scale * win[t]
+			windowSum[offset+t] += win[t] * win[t]
+		}
+	}
+
+	// window-sum normalization, samples not covered by window stay zero
+	const minWindowSum = 1e-8
+	for t, ws := range windowSum {
+		if ws > minWindowSum {
+			signal[t] /= ws
+		} else {
+			signal[t] = 0
+		}
+	}
+
+	return signal
+}
+
 // SplitSpectrum splits complex spectrum X(k) to amplitude |X(k)|
 // and angle(X(k))
 func SplitSpectrum(spec []complex128) ([]float64, []float64) {
@@ -83,21 +273,51 @@ func SplitSpectrum(spec []complex128) ([]float64, []float64) {
 
 // SplitSpectrogram returns SpilitSpectrum for each time frame.
 func SplitSpectrogram(spectrogram [][]complex128) ([][]float64, [][]float64) {
-	numFrames, numFreqBins := len(spectrogram), len(spectrogram[0])
+	numFrames := len(spectrogram)
+	if numFrames == 0 {
+		return [][]float64{}, [][]float64{}
+	}
+	numFreqBins := len(spectrogram[0])
 	amp := create2DSlice(numFrames, numFreqBins)
 	phase := create2DSlice(numFrames, numFreqBins)
 
-	for i := 0; i < numFrames; i++ {
-		amp[i], phase[i] = SplitSpectrum(spectrogram[i])
+	for i, spec := range spectrogram {
+		for k, val := range spec {
+			amp[i][k] = cmplx.Abs(val)
+			phase[i][k] = math.Atan2(imag(val), real(val))
+		}
 	}
 
 	return amp, phase
 }
 
+// CombineSpectrum returns complex spectrum from amplitude and angle, it is
+// inverse of SplitSpectrum
+func CombineSpectrum(amp []float64, phase []float64) []complex128 {
+	spec := make([]complex128, len(amp))
+	for i := range spec {
+		spec[i] = cmplx.Rect(amp[i], phase[i])
+	}
+
+	return spec
+}
+
+// CombineSpectrogram returns CombineSpectrum for each time frame.
+func CombineSpectrogram(amp [][]float64, phase [][]float64) [][]complex128 {
+	spectrogram := make([][]complex128, len(amp))
+	for i := range spectrogram {
+		spectrogram[i] = CombineSpectrum(amp[i], phase[i])
+	}
+
+	return spectrogram
+}
+
+// create2DSlice returns rows x cols matrix backed by one allocation
 func create2DSlice(rows, cols int) [][]float64 {
+	data := make([]float64, rows*cols)
 	s := make([][]float64, rows)
 	for i := range s {
-		s[i] = make([]float64, cols)
+		s[i] = data[i*cols : (i+1)*cols : (i+1)*cols]
 	}
 	return s
 }
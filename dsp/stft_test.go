@@ -0,0 +1,128 @@
+package dsp
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ISTFTReconstruction(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	input := make([]float64, 8192)
+	for i := range input {
+		input[i] = math.Sin(2*math.Pi*440*float64(i)/44100) + 0.1*rnd.NormFloat64()
+	}
+
+	frameLen := 1024
+	for _, frameShift := range []int{frameLen / 2, frameLen / 4} {
+		stft := New(frameShift, frameLen)
+
+		amp, phase := SplitSpectrogram(stft.STFT(input))
+		output := stft.ISTFT(CombineSpectrogram(amp, phase))
+
+		assert.Equal(t, (stft.NumFrames(input)-1)*frameShift+frameLen, len(output))
+
+		// first and last samples are under window edges
+		for i := frameShift; i < len(output)-frameShift; i++ {
+			if math.Abs(output[i]-input[i]) > 1e-9 {
+				assert.Failf(t, "reconstruction error", "hop %d, sample %d: %f != %f", frameShift, i, output[i], input[i])
+				break
+			}
+		}
+	}
+}
+
+func Test_StreamingSTFT(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	input := make([]float64, 10000)
+	for i := range input {
+		input[i] = rnd.NormFloat64()
+	}
+
+	for _, frameShift := range []int{256, 1024, 1500} {
+		stft := New(frameShift, 1024)
+		expected := stft.STFT(input)
+
+		ss := stft.NewStreamingSTFT()
+		spectra := make([][]complex128, 0)
+		for pos := 0; pos < len(input); {
+			n := min(1+rnd.Intn(700), len(input)-pos)
+			spectra = append(spectra, ss.Write(input[pos:pos+n])...)
+			pos += n
+		}
+
+		assert.Equal(t, len(expected), len(spectra), "hop %d", frameShift)
+		assert.Equal(t, len(expected), ss.Frames())
+		assert.Equal(t, expected, spectra)
+	}
+}
+
+func Test_STFTParallel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	input := make([]float64, 20000)
+	input32 := make([]float32, len(input))
+	for i := range input {
+		input[i] = rnd.NormFloat64()
+		input32[i] = float32(input[i])
+	}
+
+	stft := New(441, 2048)
+	stft.Workers = 1
+	expected := stft.STFT(input)
+	expectedAmp, _ := SplitSpectrogram(expected)
+
+	stft.Workers = 3
+	assert.Equal(t, expected, stft.STFT(input))
+	assert.Equal(t, expectedAmp, stft.Magnitude(input))
+
+	spec32 := stft.STFTComplex64(input32)
+	amp32 := stft.MagnitudeFloat32(input32)
+	assert.Equal(t, len(expected), len(spec32))
+	assert.Equal(t, len(expected), len(amp32))
+	for i := range expected {
+		for k := range expected[i] {
+			assert.InDelta(t, real(expected[i][k]), real(spec32[i][k]), 1e-3)
+			assert.InDelta(t, expectedAmp[i][k], amp32[i][k], 1e-3)
+		}
+	}
+
+	assert.Empty(t, stft.STFT(input[:1000]))
+	assert.Empty(t, stft.Magnitude(input[:2047]))
+	assert.Equal(t, 1, len(stft.Magnitude(input[:2048])))
+}
+
+func Test_STFTZeroPadding(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	input := make([]float64, 4096)
+	for i := range input {
+		input[i] = rnd.NormFloat64()
+	}
+
+	stft := New(256, 1024)
+	stft.NFFT = 4096
+
+	spectrogram := stft.STFT(input)
+	assert.Equal(t, stft.NumFrames(input), len(spectrogram))
+	assert.Equal(t, 2049, len(spectrogram[0]))
+
+	ss := stft.NewStreamingSTFT()
+	streamed := ss.Write(input)
+	assert.Equal(t, len(spectrogram), len(streamed))
+	for k := range spectrogram[1] {
+		assert.InDelta(t, real(spectrogram[1][k]), real(streamed[1][k]), 1e-9)
+	}
+
+	output := stft.ISTFT(spectrogram)
+	for i := 256; i < len(output)-256; i++ {
+		if math.Abs(output[i]-input[i]) > 1e-9 {
+			assert.Failf(t, "reconstruction error", "sample %d: %f != %f", i, output[i], input[i])
+			break
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package dsp
+
+import (
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// StreamingSTFT computes STFT of a signal given in chunks of any size.
+// Frames are the same as STFT.STFT returns for the whole signal, samples of
+// the last incomplete frame are kept until the next chunk arrives.
+type StreamingSTFT struct {
+	stft *STFT
+	fft  *fourier.FFT
+
+	// samples starting at the next frame
+	pending []float64
+	// samples to drop before the next frame when hop is longer than frame
+	skip int
+	// index of the next frame
+	frameIdx int
+
+	frame []float64
+}
+
+// NewStreamingSTFT returns streaming processor with frame parameters and
+// window of s
+func (s *STFT) NewStreamingSTFT() *StreamingSTFT {
+	return &StreamingSTFT{
+		stft:    s,
+		fft:     fourier.NewFFT(s.FFTLen()),
+		pending: make([]float64, 0, 2*s.FrameLen),
+		frame:   make([]float64, s.FFTLen()),
+	}
+}
+
+// Write adds samples and returns spectra of frames completed by them
+func (ss *StreamingSTFT) Write(samples []float64) [][]complex128 {
+	frameLen := ss.stft.FrameLen
+	hop := ss.stft.FrameShift
+
+	if ss.skip > 0 {
+		n := min(ss.skip, len(samples))
+		samples = samples[n:]
+		ss.skip -= n
+	}
+	ss.pending = append(ss.pending, samples...)
+
+	var spectra [][]complex128
+
+	pending := ss.pending
+	for len(pending) >= frameLen {
+		// zero padding after frameLen samples is kept
+		copy(ss.frame, pending[:frameLen])
+		if ss.stft.Window != nil {
+			ss.stft.Window(ss.frame[:frameLen])
+		}
+		spectra = append(spectra, ss.fft.Coefficients(nil, ss.frame))
+		ss.frameIdx++
+
+		if hop > len(pending) {
+			ss.skip = hop - len(pending)
+			pending = pending[:0]
+			break
+		}
+		pending = pending[hop:]
+	}
+
+	// keep the unprocessed tail at the start of the buffer
+	n := copy(ss.pending, pending)
+	ss.pending = ss.pending[:n]
+
+	return spectra
+}
+
+// Frames returns the number of emitted frames, it is index of the next frame
+func (ss *StreamingSTFT) Frames() int {
+	return ss.frameIdx
+}
+
+// Reset drops buffered samples and restarts frame indexing
+func (ss *StreamingSTFT) Reset() {
+	ss.pending = ss.pending[:0]
+	ss.skip = 0
+	ss.frameIdx = 0
+}
@@ -0,0 +1,427 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/dsp/window"
+)
+
+// PhaseVocoder changes duration of a signal given in chunks without changing
+// its pitch. Frames are taken with analysis hop of SynthesisHop*rate and
+// overlap-added with SynthesisHop, phases of spectral peaks are advanced by
+// their instantaneous frequency and bins around a peak keep their phase
+// relation to it (identity phase locking, Laroche and Dolson).
+type PhaseVocoder struct {
+	FrameLen     int
+	SynthesisHop int
+
+	rate   float64
+	fft    *fourier.FFT
+	window []float64
+	// overlap-add gain of squared windows
+	norm float64
+
+	// input samples starting before the next frame
+	pending []float64
+	// position of the next frame in pending
+	pos float64
+	// start of the previous frame in pending, negative when dropped
+	prevStart int
+	started   bool
+
+	prevPhase  []float64
+	synthPhase []float64
+	// overlap-add buffer, the first SynthesisHop samples are complete
+	ola []float64
+
+	frame  []float64
+	coeffs []complex128
+	mag    []float64
+	phase  []float64
+	peaks  []int
+}
+
+// NewPhaseVocoder returns phase vocoder with Hann window of frameLen and
+// synthesis hop of frameLen/4, rate is playback speed: 2 - twice shorter
+func NewPhaseVocoder(frameLen int, rate float64) *PhaseVocoder {
+	numBins := frameLen/2 + 1
+
+	pv := &PhaseVocoder{
+		FrameLen:     frameLen,
+		SynthesisHop: frameLen / 4,
+		fft:          fourier.NewFFT(frameLen),
+		ola:          make([]float64, frameLen),
+		frame:        make([]float64, frameLen),
+		coeffs:       make([]complex128, numBins),
+		mag:          make([]float64, numBins),
+		phase:        make([]float64, numBins),
+		prevPhase:    make([]float64, numBins),
+		synthPhase:   make([]float64, numBins),
+	}
+	pv.SetRate(rate)
+
+	win := make([]float64, frameLen)
+	for i := range win {
+		win[i] = 1
+	}
+	pv.window = window.Hann(win)
+
+	var sum float64
+	for _, w := range pv.window {
+		sum += w * w
+	}
+	pv.norm = sum / float64(pv.SynthesisHop)
+
+	return pv
+}
+
+// SetRate changes playback speed from the next frame
+func (pv *PhaseVocoder) SetRate(rate float64) {
+	pv.rate = rate
+}
+
+func (pv *PhaseVocoder) Rate() float64 {
+	return pv.rate
+}
+
+// Write adds samples and returns output samples completed by them
+func (pv *PhaseVocoder) Write(samples []float64) []float64 {
+	pv.pending = append(pv.pending, samples...)
+
+	var out []float64
+	for {
+		start := int(math.Round(pv.pos))
+		if start+pv.FrameLen > len(pv.pending) {
+			break
+		}
+
+		out = append(out, pv.synthesize(pv.pending[start:start+pv.FrameLen], start-pv.prevStart)...)
+
+		pv.prevStart = start
+		pv.pos += float64(pv.SynthesisHop) * pv.rate
+	}
+
+	// drop samples before the next frame
+	drop := min(int(pv.pos), len(pv.pending))
+	n := copy(pv.pending, pv.pending[drop:])
+	pv.pending = pv.pending[:n]
+	pv.pos -= float64(drop)
+	pv.prevStart -= drop
+
+	return out
+}
+
+// Flush returns output of the buffered samples followed by silence, vocoder
+// starts a new signal after it
+func (pv *PhaseVocoder) Flush() []float64 {
+	out := pv.Write(make([]float64, pv.FrameLen))
+	out = append(out, pv.ola[:pv.FrameLen-pv.SynthesisHop]...)
+
+	pv.Reset()
+
+	return out
+}
+
+// Reset drops buffered samples and phases
+func (pv *PhaseVocoder) Reset() {
+	pv.pending = pv.pending[:0]
+	pv.pos = 0
+	pv.prevStart = 0
+	pv.started = false
+	clear(pv.ola)
+}
+
+// synthesize returns the next SynthesisHop output samples after overlap-add
+// of the frame taken analysisHop samples after the previous one
+func (pv *PhaseVocoder) synthesize(input []float64, analysisHop int) []float64 {
+	n := pv.FrameLen
+	for i, v := range input {
+		pv.frame[i] = v * pv.window[i]
+	}
+	pv.fft.Coefficients(pv.coeffs, pv.frame)
+	for k, c := range pv.coeffs {
+		pv.mag[k] = cmplx.Abs(c)
+		pv.phase[k] = cmplx.Phase(c)
+	}
+
+	if !pv.started {
+		pv.started = true
+		copy(pv.synthPhase, pv.phase)
+	} else {
+		pv.advancePhases(analysisHop)
+	}
+	copy(pv.prevPhase, pv.phase)
+
+	for k := range pv.coeffs {
+		pv.coeffs[k] = cmplx.Rect(pv.mag[k], pv.synthPhase[k])
+	}
+	pv.fft.Sequence(pv.frame, pv.coeffs)
+
+	scale := 1 / (float64(n) * pv.norm)
+	for i, v := range pv.frame {
+		pv.ola[i] += v * pv.window[i] * scale
+	}
+
+	hop := pv.SynthesisHop
+	out := make([]float64, hop)
+	copy(out, pv.ola[:hop])
+	copy(pv.ola, pv.ola[hop:])
+	clear(pv.ola[n-hop:])
+
+	return out
+}
+
+// advancePhases sets synthesis phases of the current frame
+func (pv *PhaseVocoder) advancePhases(analysisHop int) {
+	n := float64(pv.FrameLen)
+	hs := float64(pv.SynthesisHop)
+
+	// synthesis phase advanced by instantaneous frequency of the bin
+	advance := func(k int) float64 {
+		omega := 2 * math.Pi * float64(k) / n
+		if analysisHop <= 0 {
+			return pv.synthPhase[k] + omega*hs
+		}
+		ha := float64(analysisHop)
+		dphi := pv.phase[k] - pv.prevPhase[k] - omega*ha
+		dphi -= 2 * math.Pi * math.Round(dphi/(2*math.Pi))
+		return pv.synthPhase[k] + (omega+dphi/ha)*hs
+	}
+
+	pv.peaks = spectralPeaks(pv.mag, pv.peaks[:0])
+	if len(pv.peaks) == 0 {
+		for k := range pv.synthPhase {
+			pv.synthPhase[k] = advance(k)
+		}
+		return
+	}
+
+	for _, p := range pv.peaks {
+		pv.synthPhase[p] = advance(p)
+	}
+
+	// bins keep phase difference to the nearest peak
+	j := 0
+	for k := range pv.synthPhase {
+		for j+1 < len(pv.peaks) && k > (pv.peaks[j]+pv.peaks[j+1])/2 {
+			j++
+		}
+		p := pv.peaks[j]
+		if k != p {
+			pv.synthPhase[k] = pv.synthPhase[p] + pv.phase[k] - pv.phase[p]
+		}
+	}
+}
+
+// spectralPeaks appends bins larger than two neighbours on each side
+func spectralPeaks(mag []float64, peaks []int) []int {
+	const minPeak = 1e-9
+	for k := range mag {
+		if mag[k] < minPeak {
+			continue
+		}
+		isPeak := true
+		for d := -2; d <= 2 && isPeak; d++ {
+			i := k + d
+			if d == 0 || i < 0 || i >= len(mag) {
+				continue
+			}
+			if mag[i] > mag[k] || (d > 0 && mag[i] == mag[k]) {
+				isPeak = false
+			}
+		}
+		if isPeak {
+			peaks = append(peaks, k)
+		}
+	}
+	return peaks
+}
+
+// TimeStretch returns signal played with rate speed and the same pitch,
+// output has len(input)/rate samples
+func TimeStretch(input []float64, frameLen int, rate float64) []float64 {
+	pv := NewPhaseVocoder(frameLen, rate)
+	out := pv.Write(input)
+	out = append(out, pv.Flush()...)
+
+	outLen := int(math.Round(float64(len(input)) / rate))
+	if len(out) < outLen {
+		out = append(out, make([]float64, outLen-len(out))...)
+	}
+	return out[:outLen]
+}
+
+// Resampler changes sample rate of a signal given in chunks by band-limited
+// (Kaiser windowed sinc) interpolation
+type Resampler struct {
+	// input samples per output sample, 2 - output rate is half of input rate
+	step float64
+
+	// input samples, the first is at -history
+	buf []float64
+	// position of the next output sample in buf
+	pos float64
+}
+
+// sinc zero crossings on each side of interpolation kernel
+const resamplerHalfLen = 16
+
+// NewResampler returns resampler with step input samples per output sample
+func NewResampler(step float64) *Resampler {
+	r := &Resampler{}
+	r.SetStep(step)
+	r.Reset()
+	return r
+}
+
+// SetStep changes resampling step from the next output sample
+func (r *Resampler) SetStep(step float64) {
+	r.step = step
+}
+
+func (r *Resampler) Step() float64 {
+	return r.step
+}
+
+// kernelHalfLen returns interpolation kernel half length in input samples,
+// kernel is widened to lower the cutoff below output Nyquist frequency
+func (r *Resampler) kernelHalfLen() int {
+	return int(math.Ceil(resamplerHalfLen * max(1, r.step)))
+}
+
+// Write adds samples and returns output samples completed by them
+func (r *Resampler) Write(samples []float64) []float64 {
+	r.buf = append(r.buf, samples...)
+	return r.interpolate(math.Inf(1))
+}
+
+// Flush returns output of the buffered samples, resampler starts a new
+// signal after it
+func (r *Resampler) Flush() []float64 {
+	end := float64(len(r.buf))
+	r.buf = append(r.buf, make([]float64, r.kernelHalfLen()+1)...)
+	out := r.interpolate(end)
+
+	r.Reset()
+	return out
+}
+
+// interpolate returns output samples before the end position of buf with
+// complete kernel support
+func (r *Resampler) interpolate(end float64) []float64 {
+	cutoff := min(1, 1/r.step)
+	hw := r.kernelHalfLen()
+
+	var out []float64
+	for r.pos < end {
+		n0 := int(math.Floor(r.pos))
+		if n0+hw >= len(r.buf) {
+			break
+		}
+
+		var y float64
+		for n := max(0, n0-hw+1); n <= n0+hw; n++ {
+			x := (r.pos - float64(n)) * cutoff
+			if math.Abs(x) >= resamplerHalfLen {
+				continue
+			}
+			y += r.buf[n] * cutoff * sincKaiser(x)
+		}
+		out = append(out, y)
+
+		r.pos += r.step
+	}
+
+	// keep kernel history of the next output sample
+	drop := max(0, min(int(math.Floor(r.pos))-hw, len(r.buf)))
+	n := copy(r.buf, r.buf[drop:])
+	r.buf = r.buf[:n]
+	r.pos -= float64(drop)
+
+	return out
+}
+
+// Reset drops buffered samples, silence precedes the next samples
+func (r *Resampler) Reset() {
+	r.buf = make([]float64, r.kernelHalfLen())
+	r.pos = float64(len(r.buf))
+}
+
+// sincKaiser returns sinc(x) windowed by Kaiser window over
+// resamplerHalfLen zero crossings
+func sincKaiser(x float64) float64 {
+	const beta = 8.0
+
+	if x == 0 {
+		return 1
+	}
+	t := x / resamplerHalfLen
+	w := besselI0(beta*math.Sqrt(1-t*t)) / besselI0(beta)
+	return math.Sin(math.Pi*x) / (math.Pi * x) * w
+}
+
+// TimePitch changes tempo and pitch of a signal given in chunks: phase
+// vocoder stretches the signal by pitch ratio and tempo, resampling
+// restores the duration and shifts the pitch
+type TimePitch struct {
+	pv *PhaseVocoder
+	rs *Resampler
+
+	tempo     float64
+	semitones float64
+}
+
+// NewTimePitch returns processor with phase vocoder frame length, tempo is
+// playback speed (0.5 - half speed), semitones is pitch shift
+func NewTimePitch(frameLen int, tempo float64, semitones float64) *TimePitch {
+	tp := &TimePitch{
+		pv: NewPhaseVocoder(frameLen, 1),
+		rs: NewResampler(1),
+	}
+	tp.Set(tempo, semitones)
+	return tp
+}
+
+// Set changes tempo and pitch shift for the next samples
+func (tp *TimePitch) Set(tempo float64, semitones float64) {
+	ratio := math.Pow(2, semitones/12)
+
+	tp.tempo = tempo
+	tp.semitones = semitones
+	tp.pv.SetRate(tempo / ratio)
+	tp.rs.SetStep(ratio)
+}
+
+func (tp *TimePitch) Tempo() float64 {
+	return tp.tempo
+}
+
+func (tp *TimePitch) Semitones() float64 {
+	return tp.semitones
+}
+
+// Write adds samples and returns output samples completed by them
+func (tp *TimePitch) Write(samples []float64) []float64 {
+	return tp.rs.Write(tp.pv.Write(samples))
+}
+
+// Flush returns output of buffered samples
+func (tp *TimePitch) Flush() []float64 {
+	out := tp.rs.Write(tp.pv.Flush())
+	return append(out, tp.rs.Flush()...)
+}
+
+// PitchShift returns signal with pitch shifted by semitones and the same
+// duration
+func PitchShift(input []float64, frameLen int, semitones float64) []float64 {
+	tp := NewTimePitch(frameLen, 1, semitones)
+	out := tp.Write(input)
+	out = append(out, tp.Flush()...)
+
+	if len(out) < len(input) {
+		out = append(out, make([]float64, len(input)-len(out))...)
+	}
+	return out[:len(input)]
+}
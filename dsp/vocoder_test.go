@@ -0,0 +1,85 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zeroCrossingFreq returns frequency of a tone by its zero crossings
+func zeroCrossingFreq(x []float64, sampleRate float64) float64 {
+	first, last, count := -1, -1, 0
+	for i := 1; i < len(x); i++ {
+		if x[i-1] < 0 && x[i] >= 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+			count++
+		}
+	}
+	return float64(count-1) * sampleRate / float64(last-first)
+}
+
+func Test_TimeStretch(t *testing.T) {
+	const sampleRate = 16000
+
+	input := make([]float64, 2*sampleRate)
+	for i := range input {
+		input[i] = 0.5 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+	}
+
+	for _, rate := range []float64{0.5, 0.8, 1.5} {
+		output := TimeStretch(input, 2048, rate)
+		assert.Equal(t, int(math.Round(float64(len(input))/rate)), len(output))
+
+		body := output[4096 : len(output)-4096]
+		assert.InDelta(t, 440, zeroCrossingFreq(body, sampleRate), 1, "rate %.1f", rate)
+		assert.InDelta(t, rms(input), rms(body), 0.02, "rate %.1f", rate)
+	}
+}
+
+func Test_PitchShift(t *testing.T) {
+	const sampleRate = 16000
+
+	input := make([]float64, 2*sampleRate)
+	for i := range input {
+		input[i] = 0.5 * math.Sin(2*math.Pi*440*float64(i)/sampleRate)
+	}
+
+	for _, semitones := range []float64{-5, 7, 12} {
+		output := PitchShift(input, 2048, semitones)
+		assert.Equal(t, len(input), len(output))
+
+		want := 440 * math.Pow(2, semitones/12)
+		body := output[4096 : len(output)-4096]
+		assert.InDelta(t, want, zeroCrossingFreq(body, sampleRate), 1, "semitones %.0f", semitones)
+		assert.InDelta(t, rms(input), rms(body), 0.02, "semitones %.0f", semitones)
+	}
+}
+
+func Test_ResamplerStream(t *testing.T) {
+	input := make([]float64, 10000)
+	for i := range input {
+		input[i] = math.Sin(2 * math.Pi * 0.01 * float64(i))
+	}
+
+	// chunked output matches the whole signal output
+	whole := NewResampler(1.25)
+	expected := append(whole.Write(input), whole.Flush()...)
+	assert.InDelta(t, float64(len(input))/1.25, float64(len(expected)), 1)
+
+	chunked := NewResampler(1.25)
+	var output []float64
+	for i := 0; i < len(input); i += 777 {
+		output = append(output, chunked.Write(input[i:min(i+777, len(input))])...)
+	}
+	output = append(output, chunked.Flush()...)
+	assert.InDeltaSlice(t, expected, output, 1e-9)
+
+	// unit step is exact copy
+	same := NewResampler(1)
+	copied := append(same.Write(input), same.Flush()...)
+	assert.InDeltaSlice(t, input, copied, 1e-9)
+}
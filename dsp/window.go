@@ -0,0 +1,173 @@
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/dsp/window"
+)
+
+// default Kaiser window beta, sidelobes are about -90 dB
+const kaiserDefaultBeta = 8.6
+
+// ParseWindow returns window function by name: hann, hamming,
+// blackman-harris, kaiser[:beta], flattop, rectangular
+func ParseWindow(s string) (func([]float64) []float64, error) {
+	name, param, hasParam := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+
+	switch name {
+	case "hann":
+		return window.Hann, nil
+	case "hamming":
+		return window.Hamming, nil
+	case "blackman-harris", "blackmanharris":
+		return window.BlackmanHarris, nil
+	case "flattop", "flat-top":
+		return window.FlatTop, nil
+	case "rectangular", "rect", "none":
+		return window.Rectangular, nil
+	case "kaiser":
+		beta := kaiserDefaultBeta
+		if hasParam {
+			v, err := strconv.ParseFloat(param, 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("invalid kaiser window beta: %s", param)
+			}
+			beta = v
+		}
+		return Kaiser(beta), nil
+	}
+	return nil, fmt.Errorf("unknown window: %s", s)
+}
+
+// Kaiser returns Kaiser window function with shape parameter beta, beta 0
+// is rectangular window
+func Kaiser(beta float64) func([]float64) []float64 {
+	return func(seq []float64) []float64 {
+		n := len(seq)
+		if n == 1 {
+			return seq
+		}
+		norm := besselI0(beta)
+		for i := range seq {
+			x := 2*float64(i)/float64(n-1) - 1
+			seq[i] *= besselI0(beta*math.Sqrt(1-x*x)) / norm
+		}
+		return seq
+	}
+}
+
+// besselI0 returns modified Bessel function of the first kind of order 0
+func besselI0(x float64) float64 {
+	sum := 1.0
+	term := 1.0
+	y := x * x / 4
+	for k := 1; k < 500; k++ {
+		term *= y / float64(k*k)
+		sum += term
+		if term < sum*1e-16 {
+			break
+		}
+	}
+	return sum
+}
+
+type SpectrumScale int
+
+const (
+	// ScaleAmplitude is amplitude of sinusoids
+	ScaleAmplitude SpectrumScale = iota
+	// ScalePower is power (mean square) of sinusoids
+	ScalePower
+	// ScaleDB is amplitude in dB relative to full scale sinusoid
+	ScaleDB
+	// ScalePSD is power spectral density, 1/Hz
+	ScalePSD
+)
+
+func ParseSpectrumScale(s string) (SpectrumScale, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "amplitude", "amp":
+		return ScaleAmplitude, nil
+	case "power":
+		return ScalePower, nil
+	case "db":
+		return ScaleDB, nil
+	case "psd":
+		return ScalePSD, nil
+	}
+	return ScaleAmplitude, fmt.Errorf("unknown spectrum scale: %s", s)
+}
+
+func (sc SpectrumScale) String() string {
+	switch sc {
+	case ScaleAmplitude:
+		return "amplitude"
+	case ScalePower:
+		return "power"
+	case ScaleDB:
+		return "dB"
+	case ScalePSD:
+		return "psd"
+	}
+	return fmt.Sprintf("SpectrumScale(%d)", int(sc))
+}
+
+// minimal reported level of dB scale
+const minScaleDB = -120.0
+
+// ScaleSpectrum returns one-sided amplitude spectrum |X(k)| of a frame
+// windowed with win coefficients (and zero-padded to any FFT size) in the
+// scale, spectrum is corrected for the window gain
+func ScaleSpectrum(amp []float64, win []float64, sampleRate int, scale SpectrumScale) []float64 {
+	var s1, s2 float64
+	for _, w := range win {
+		s1 += w
+		s2 += w * w
+	}
+
+	out := make([]float64, len(amp))
+	last := len(amp) - 1
+	for k, a := range amp {
+		// energy of negative frequencies, DC and Nyquist bins are not mirrored
+		sides := 2.0
+		if k == 0 || k == last {
+			sides = 1
+		}
+
+		// sinusoid amplitude
+		ampl := sides * a / s1
+
+		switch scale {
+		case ScaleAmplitude:
+			out[k] = ampl
+		case ScalePower:
+			// mean square of sinusoid, DC and Nyquist bins are not halved
+			out[k] = ampl * ampl
+			if sides == 2 {
+				out[k] /= 2
+			}
+		case ScaleDB:
+			out[k] = max(minScaleDB, 20*math.Log10(ampl+1e-300))
+		case ScalePSD:
+			out[k] = sides * a * a / (float64(sampleRate) * s2)
+		}
+	}
+
+	return out
+}
+
+// ScaleSpectrogram returns amplitude spectrogram (as returned by Magnitude)
+// in the scale, see ScaleSpectrum
+func (s *STFT) ScaleSpectrogram(amp [][]float64, sampleRate int, scale SpectrumScale) [][]float64 {
+	win := s.windowCoeffs()
+
+	out := make([][]float64, len(amp))
+	for i, frame := range amp {
+		out[i] = ScaleSpectrum(frame, win, sampleRate, scale)
+	}
+
+	return out
+}
@@ -0,0 +1,62 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SpectrumScale(t *testing.T) {
+	const (
+		sampleRate = 8000
+		frameLen   = 1024
+		nfft       = 4096
+		ampl       = 0.5
+		freq       = 1000.0 // bin 512 of 4096 points FFT
+	)
+
+	input := make([]float64, frameLen)
+	for i := range input {
+		input[i] = ampl * math.Sin(2*math.Pi*freq*float64(i)/sampleRate)
+	}
+
+	for _, name := range []string{"hann", "hamming", "blackman-harris", "kaiser:6", "flattop"} {
+		windowFn, err := ParseWindow(name)
+		assert.NoError(t, err)
+
+		stft := New(frameLen, frameLen)
+		stft.Window = windowFn
+		stft.NFFT = nfft
+
+		amp := stft.Magnitude(input)
+		assert.Equal(t, 1, len(amp))
+		assert.Equal(t, nfft/2+1, len(amp[0]))
+
+		peak := int(freq * nfft / sampleRate)
+
+		scaled := stft.ScaleSpectrogram(amp, sampleRate, ScaleAmplitude)
+		assert.InDelta(t, ampl, scaled[0][peak], 0.01, name)
+
+		scaled = stft.ScaleSpectrogram(amp, sampleRate, ScalePower)
+		assert.InDelta(t, ampl*ampl/2, scaled[0][peak], 0.001, name)
+
+		scaled = stft.ScaleSpectrogram(amp, sampleRate, ScaleDB)
+		assert.InDelta(t, 20*math.Log10(ampl), scaled[0][peak], 0.1, name)
+
+		// PSD integrates to mean square of the signal
+		scaled = stft.ScaleSpectrogram(amp, sampleRate, ScalePSD)
+		var power float64
+		for _, v := range scaled[0] {
+			power += v * sampleRate / nfft
+		}
+		assert.InDelta(t, ampl*ampl/2, power, 0.005, name)
+	}
+
+	_, err := ParseWindow("kaiser:x")
+	assert.Error(t, err)
+
+	// beta 0 is rectangular window
+	win := Kaiser(0)([]float64{1, 1, 1, 1})
+	assert.InDeltaSlice(t, []float64{1, 1, 1, 1}, win, 1e-12)
+}
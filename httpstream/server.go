@@ -0,0 +1,455 @@
+package httpstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drgolem/musiclab/audiosink"
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+const (
+	FormatWav = "wav"
+	FormatPCM = "pcm"
+)
+
+const (
+	wavHeaderSize       = 44
+	defaultMetaInterval = 16000
+	// icy metadata length is stored in one byte as number of 16 byte blocks
+	maxIcyMetaSize = 255 * 16
+)
+
+var (
+	errRangeInvalid        = errors.New("invalid range")
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+	errBodyDone            = errors.New("body done")
+)
+
+// Track is an audio source served by the stream server. Open starts audio
+// stream at the given position, Seekable tracks allow Range requests when
+// the stream knows its exact length (audiosource.SamplesCounter).
+type Track struct {
+	SongInfo *types.SongInfo
+	Seekable bool
+	Open     func(ctx context.Context, start time.Duration) (audiosource.AudioStream, error)
+}
+
+// FileTrack creates seekable track decoding music file
+func FileTrack(fileName string, songInfo *types.SongInfo) Track {
+	return Track{
+		SongInfo: songInfo,
+		Seekable: true,
+		Open: func(ctx context.Context, start time.Duration) (audiosource.AudioStream, error) {
+			return audiosource.NewMusicAudioProducer(ctx, fileName,
+				audiosource.WithPlayStartPos(start))
+		},
+	}
+}
+
+type ServerOptions struct {
+	Format       string
+	MetaInterval int
+	Name         string
+}
+
+type SetOptionsFn func(opt *ServerOptions)
+
+// WithFormat sets default stream format: wav or pcm, clients can override it
+// with format query parameter
+func WithFormat(format string) SetOptionsFn {
+	return func(opt *ServerOptions) {
+		opt.Format = format
+	}
+}
+
+// WithMetaInterval sets number of audio bytes between icy metadata blocks
+func WithMetaInterval(metaInterval int) SetOptionsFn {
+	return func(opt *ServerOptions) {
+		opt.MetaInterval = metaInterval
+	}
+}
+
+func WithName(name string) SetOptionsFn {
+	return func(opt *ServerOptions) {
+		opt.Name = name
+	}
+}
+
+type streamServer struct {
+	tracks []Track
+	opt    ServerOptions
+}
+
+// NewStreamServer creates http handler streaming tracks one after another.
+// Every request gets its own audio streams. Tracks with audio format
+// different from the first track are skipped.
+func NewStreamServer(tracks []Track, opts ...SetOptionsFn) http.Handler {
+	opt := ServerOptions{
+		Format:       FormatWav,
+		MetaInterval: defaultMetaInterval,
+		Name:         "musiclab",
+	}
+	for _, sf := range opts {
+		sf(&opt)
+	}
+
+	return &streamServer{
+		tracks: tracks,
+		opt:    opt,
+	}
+}
+
+func (s *streamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	outFormat := s.opt.Format
+	if f := r.URL.Query().Get("format"); f != "" {
+		outFormat = f
+	}
+	if outFormat != FormatWav && outFormat != FormatPCM {
+		http.Error(w, fmt.Sprintf("unsupported format: %s", outFormat), http.StatusBadRequest)
+		return
+	}
+
+	if len(s.tracks) == 0 {
+		http.Error(w, "no tracks", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+
+	track := s.tracks[0]
+	stream, err := track.Open(ctx, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if stream != nil {
+			stream.Close()
+		}
+	}()
+
+	audioFormat := stream.GetFormat()
+	frameByteSize := int64(audioFormat.Channels * audioFormat.BitsPerSample / 8)
+
+	// data size is known only for a single track with exact length, estimated
+	// length is streamed chunked
+	dataSize := int64(-1)
+	if counter, ok := stream.(audiosource.SamplesCounter); ok && len(s.tracks) == 1 && track.Seekable {
+		if nSamples := counter.TotalSamples(); nSamples >= 0 {
+			dataSize = nSamples * frameByteSize
+		}
+	}
+
+	var header []byte
+	if outFormat == FormatWav {
+		if dataSize >= 0 {
+			header = audiosink.WavHeader(audioFormat, dataSize)
+		} else {
+			header = audiosink.WavHeader(audioFormat, math.MaxUint32)
+		}
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", contentType(outFormat, audioFormat))
+	hdr.Set("Cache-Control", "no-cache")
+
+	status := http.StatusOK
+	bodyStart := int64(0)
+	bodyLen := int64(-1)
+	icy := r.Header.Get("Icy-MetaData") == "1" && s.opt.MetaInterval > 0
+
+	if dataSize >= 0 {
+		hdr.Set("Accept-Ranges", "bytes")
+		totalSize := int64(len(header)) + dataSize
+		bodyLen = totalSize
+
+		if rangeHdr := r.Header.Get("Range"); rangeHdr != "" {
+			start, end, err := parseRange(rangeHdr, totalSize)
+			switch {
+			case errors.Is(err, errRangeNotSatisfiable):
+				hdr.Set("Content-Range", fmt.Sprintf("bytes */%d", totalSize))
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return
+			case err == nil:
+				status = http.StatusPartialContent
+				bodyStart = start
+				bodyLen = end - start + 1
+				hdr.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, totalSize))
+				// metadata would break byte offsets
+				icy = false
+			}
+			// malformed or multiple ranges, serve full content
+		}
+	}
+
+	if icy {
+		// metadata is interleaved with audio, length is not known
+		bodyLen = -1
+		hdr.Set("icy-metaint", strconv.Itoa(s.opt.MetaInterval))
+		hdr.Set("icy-name", s.opt.Name)
+	} else if bodyLen >= 0 {
+		hdr.Set("Content-Length", strconv.FormatInt(bodyLen, 10))
+	}
+
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	var out io.Writer = w
+	var icyOut *icyWriter
+	if icy {
+		icyOut = &icyWriter{
+			w:       w,
+			metaInt: s.opt.MetaInterval,
+		}
+		out = icyOut
+	}
+
+	bw := &bodyWriter{
+		w:      out,
+		skip:   bodyStart,
+		remain: bodyLen,
+	}
+
+	if bodyStart > int64(len(header)) {
+		// seek in audio data, header is not part of the body
+		sample := (bodyStart - int64(len(header))) / frameByteSize
+		bw.skip = bodyStart - int64(len(header)) - sample*frameByteSize
+
+		startPos := time.Duration(float64(sample) / float64(audioFormat.SampleRate) * float64(time.Second))
+
+		stream.Close()
+		stream, err = track.Open(ctx, startPos)
+		if err != nil {
+			fmt.Printf("ERR: %v\n", err)
+			// keep declared content length
+			bw.Write(make([]byte, max(0, bw.remain)))
+			return
+		}
+	} else if _, err := bw.Write(header); err != nil {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	for idx := range s.tracks {
+		if idx > 0 {
+			track = s.tracks[idx]
+			stream, err = track.Open(ctx, 0)
+			if err != nil {
+				fmt.Printf("ERR: %v\n", err)
+				continue
+			}
+			if stream.GetFormat() != audioFormat {
+				f := stream.GetFormat()
+				fmt.Printf("skip track %d, format %s, stream format %s\n",
+					idx, f.String(), audioFormat.String())
+				stream.Close()
+				stream = nil
+				continue
+			}
+		}
+
+		if icyOut != nil {
+			icyOut.title = streamTitle(track.SongInfo)
+		}
+
+		err = copyStream(ctx, bw, flusher, stream)
+		stream.Close()
+		stream = nil
+		if err != nil {
+			// client gone or requested range is sent
+			return
+		}
+	}
+
+	// stream failed before the declared length, pad with silence
+	if bw.remain > 0 {
+		bw.Write(make([]byte, bw.remain))
+	}
+}
+
+func copyStream(ctx context.Context, w io.Writer, flusher http.Flusher, stream audiosource.AudioStream) error {
+	for {
+		select {
+		case pkt, ok := <-stream.Stream():
+			if !ok {
+				return nil
+			}
+
+			frameByteSize := pkt.Format.Channels * pkt.Format.BitsPerSample / 8
+			_, err := w.Write(pkt.Audio[:pkt.SamplesCount*frameByteSize])
+			if err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func contentType(outFormat string, audioFormat types.FrameFormat) string {
+	if outFormat == FormatWav {
+		return "audio/wav"
+	}
+	return fmt.Sprintf("audio/pcm;rate=%d;channels=%d;bits=%d;endianness=little",
+		audioFormat.SampleRate, audioFormat.Channels, audioFormat.BitsPerSample)
+}
+
+func streamTitle(songInfo *types.SongInfo) string {
+	if songInfo == nil {
+		return ""
+	}
+	if songInfo.Artist == "" {
+		return songInfo.Title
+	}
+	return songInfo.Artist + " - " + songInfo.Title
+}
+
+// parseRange parses single byte range, multiple ranges are not supported
+func parseRange(rangeHdr string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(rangeHdr, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, errRangeInvalid
+	}
+
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, errRangeInvalid
+	}
+
+	if startStr == "" {
+		// suffix range, last n bytes
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, errRangeInvalid
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, errRangeNotSatisfiable
+		}
+		n = min(n, size)
+		return size - n, size - 1, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, errRangeInvalid
+	}
+	if start >= size {
+		return 0, 0, errRangeNotSatisfiable
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, errRangeInvalid
+		}
+		end = min(end, size-1)
+	}
+
+	return start, end, nil
+}
+
+// bodyWriter drops first skip bytes and stops after remain bytes (if not negative)
+type bodyWriter struct {
+	w      io.Writer
+	skip   int64
+	remain int64
+}
+
+func (bw *bodyWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	skip := min(bw.skip, int64(len(p)))
+	bw.skip -= skip
+	p = p[skip:]
+
+	if bw.remain >= 0 {
+		if bw.remain == 0 {
+			return 0, errBodyDone
+		}
+		p = p[:min(int64(len(p)), bw.remain)]
+		bw.remain -= int64(len(p))
+	}
+
+	if len(p) > 0 {
+		if _, err := bw.w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	if bw.remain == 0 {
+		return n, errBodyDone
+	}
+	return n, nil
+}
+
+// icyWriter inserts icy metadata block after every metaInt audio bytes. Stream
+// title is sent when changed, otherwise empty block.
+type icyWriter struct {
+	w         io.Writer
+	metaInt   int
+	count     int
+	title     string
+	sentTitle string
+}
+
+func (iw *icyWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), iw.metaInt-iw.count)
+		k, err := iw.w.Write(p[:n])
+		written += k
+		if err != nil {
+			return written, err
+		}
+		iw.count += n
+		p = p[n:]
+
+		if iw.count == iw.metaInt {
+			if _, err := iw.w.Write(iw.metaBlock()); err != nil {
+				return written, err
+			}
+			iw.count = 0
+		}
+	}
+	return written, nil
+}
+
+func (iw *icyWriter) metaBlock() []byte {
+	if iw.title == iw.sentTitle {
+		return []byte{0}
+	}
+	iw.sentTitle = iw.title
+
+	meta := fmt.Sprintf("StreamTitle='%s';", strings.ReplaceAll(iw.title, "'", "`"))
+	if len(meta) > maxIcyMetaSize {
+		meta = meta[:maxIcyMetaSize]
+	}
+
+	blocks := (len(meta) + 15) / 16
+	block := make([]byte, 1+blocks*16)
+	block[0] = byte(blocks)
+	copy(block[1:], meta)
+
+	return block
+}
@@ -0,0 +1,349 @@
+package httpstream
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drgolem/musiclab/audiosink"
+	"github.com/drgolem/musiclab/audiosource"
+	"github.com/drgolem/musiclab/types"
+)
+
+var testFormat = types.FrameFormat{
+	SampleRate:    8000,
+	Channels:      1,
+	BitsPerSample: 16,
+}
+
+type testStream struct {
+	stream chan audiosource.AudioSamplesPacket
+	done   chan struct{}
+	total  int64
+}
+
+// newTestStream produces mono samples with value equal to sample position
+func newTestStream(ctx context.Context, start time.Duration, nSamples int) *testStream {
+	s := &testStream{
+		stream: make(chan audiosource.AudioSamplesPacket),
+		done:   make(chan struct{}),
+		total:  int64(nSamples),
+	}
+
+	go func() {
+		defer close(s.stream)
+
+		const packetSamples = 100
+		pos := int(start.Seconds() * float64(testFormat.SampleRate))
+		for pos < nSamples {
+			cnt := min(packetSamples, nSamples-pos)
+			audio := make([]byte, 2*cnt)
+			for i := range cnt {
+				binary.LittleEndian.PutUint16(audio[2*i:], uint16(pos+i))
+			}
+			pos += cnt
+
+			select {
+			case s.stream <- audiosource.AudioSamplesPacket{Format: testFormat, Audio: audio, SamplesCount: cnt}:
+			case <-ctx.Done():
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s
+}
+
+func (s *testStream) GetFormat() types.FrameFormat {
+	return testFormat
+}
+
+func (s *testStream) Status() map[string]string {
+	return map[string]string{}
+}
+
+func (s *testStream) TotalSamples() int64 {
+	return s.total
+}
+
+func (s *testStream) Stream() <-chan audiosource.AudioSamplesPacket {
+	return s.stream
+}
+
+func (s *testStream) Close() error {
+	close(s.done)
+	return nil
+}
+
+func testTrack(title string, nSamples int, seekable bool) Track {
+	return Track{
+		SongInfo: &types.SongInfo{
+			Title:    title,
+			Artist:   "Artist",
+			Duration: time.Duration(nSamples) * time.Second / time.Duration(testFormat.SampleRate),
+		},
+		Seekable: seekable,
+		Open: func(ctx context.Context, start time.Duration) (audiosource.AudioStream, error) {
+			return newTestStream(ctx, start, nSamples), nil
+		},
+	}
+}
+
+func testSamples(from, to int) []byte {
+	data := make([]byte, 0, 2*(to-from))
+	for i := from; i < to; i++ {
+		data = binary.LittleEndian.AppendUint16(data, uint16(i))
+	}
+	return data
+}
+
+func Test_StreamWavPlaylist(t *testing.T) {
+	srv := httptest.NewServer(NewStreamServer([]Track{
+		testTrack("One", 1000, true),
+		testTrack("Two", 500, true),
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "audio/wav", resp.Header.Get("Content-Type"))
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Empty(t, resp.Header.Get("Accept-Ranges"))
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "RIFF", string(body[0:4]))
+	assert.Equal(t, uint32(8000), binary.LittleEndian.Uint32(body[24:]))
+
+	expData := append(testSamples(0, 1000), testSamples(0, 500)...)
+	assert.Equal(t, expData, body[wavHeaderSize:])
+}
+
+func Test_StreamRange(t *testing.T) {
+	srv := httptest.NewServer(NewStreamServer([]Track{
+		testTrack("One", 8000, true),
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Range", "bytes=1044-1143")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "bytes 1044-1143/16044", resp.Header.Get("Content-Range"))
+	assert.Equal(t, int64(100), resp.ContentLength)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, testSamples(500, 550), body)
+
+	// range starting inside the header
+	req.Header.Set("Range", "bytes=40-47")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, append(binary.LittleEndian.AppendUint32(nil, 16000), testSamples(0, 2)...), body)
+
+	req.Header.Set("Range", "bytes=20000-")
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+	assert.Equal(t, "bytes */16044", resp.Header.Get("Content-Range"))
+}
+
+func Test_StreamEstimatedLength(t *testing.T) {
+	track := testTrack("One", 1000, true)
+	open := track.Open
+	track.Open = func(ctx context.Context, start time.Duration) (audiosource.AudioStream, error) {
+		stream, err := open(ctx, start)
+		stream.(*testStream).total = -1
+		return stream, err
+	}
+
+	srv := httptest.NewServer(NewStreamServer([]Track{track}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Range", "bytes=1044-1143")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	assert.Empty(t, resp.Header.Get("Accept-Ranges"))
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, testSamples(0, 1000), body[wavHeaderSize:])
+}
+
+// writeTestWav writes stereo wav file of testFormat sample rate with sample
+// values equal to sample position, negated in the right channel
+func writeTestWav(t *testing.T, nSamples int) string {
+	format := types.FrameFormat{
+		SampleRate:    testFormat.SampleRate,
+		Channels:      2,
+		BitsPerSample: 16,
+	}
+
+	audio := make([]byte, 0, 4*nSamples)
+	for i := range nSamples {
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(i))
+		audio = binary.LittleEndian.AppendUint16(audio, uint16(-i))
+	}
+
+	audioPktChan := make(chan audiosource.AudioSamplesPacket, 1)
+	audioPktChan <- audiosource.AudioSamplesPacket{Format: format, Audio: audio, SamplesCount: nSamples}
+	close(audioPktChan)
+
+	fileName := filepath.Join(t.TempDir(), "test.wav")
+	sink, err := audiosink.NewWavFileSink(fileName, audioPktChan)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Play(context.Background()))
+	assert.NoError(t, sink.Close(context.Background()))
+
+	return fileName
+}
+
+func Test_StreamWavFileRange(t *testing.T) {
+	const nSamples = 16000
+	fileName := writeTestWav(t, nSamples)
+
+	// data size is from decoder, not from song info duration
+	srv := httptest.NewServer(NewStreamServer([]Track{
+		FileTrack(fileName, &types.SongInfo{Title: "Test", Duration: 2500 * time.Millisecond}),
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	full, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	declared := int64(wavHeaderSize + 4*nSamples)
+	assert.Equal(t, declared, resp.ContentLength)
+	assert.Equal(t, declared, int64(len(full)))
+	assert.Equal(t, uint32(4*nSamples), binary.LittleEndian.Uint32(full[40:]))
+
+	// range starts inside a decoded packet and inside a frame
+	for _, start := range []int{wavHeaderSize + 4*5001 + 2, wavHeaderSize + 4*2048, wavHeaderSize + 4*nSamples - 6} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, full[start:], body, "range start %d", start)
+	}
+}
+
+func Test_StreamIcyMetadata(t *testing.T) {
+	const metaInt = 1000
+
+	srv := httptest.NewServer(NewStreamServer([]Track{
+		testTrack("One", 800, false),
+		testTrack("Two", 800, false),
+	}, WithFormat(FormatPCM), WithMetaInterval(metaInt)))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "1000", resp.Header.Get("icy-metaint"))
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "audio/pcm;rate=8000;channels=1"))
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	audio := make([]byte, 0)
+	titles := make([]string, 0)
+	for len(body) > 0 {
+		n := min(metaInt, len(body))
+		audio = append(audio, body[:n]...)
+		body = body[n:]
+		if len(body) == 0 {
+			break
+		}
+
+		metaLen := int(body[0]) * 16
+		if metaLen > 0 {
+			titles = append(titles, strings.TrimRight(string(body[1:1+metaLen]), "\x00"))
+		}
+		body = body[1+metaLen:]
+	}
+
+	assert.Equal(t, append(testSamples(0, 800), testSamples(0, 800)...), audio)
+	assert.Equal(t, []string{
+		"StreamTitle='Artist - One';",
+		"StreamTitle='Artist - Two';",
+	}, titles)
+}
+
+func Test_ParseRange(t *testing.T) {
+	testData := []struct {
+		Range    string
+		ExpStart int64
+		ExpEnd   int64
+		ExpErr   error
+	}{
+		{"bytes=0-99", 0, 99, nil},
+		{"bytes=100-", 100, 999, nil},
+		{"bytes=900-2000", 900, 999, nil},
+		{"bytes=-100", 900, 999, nil},
+		{"bytes=-2000", 0, 999, nil},
+		{"bytes=1000-", 0, 0, errRangeNotSatisfiable},
+		{"bytes=0-10,20-30", 0, 0, errRangeInvalid},
+		{"bytes=20-10", 0, 0, errRangeInvalid},
+		{"items=0-10", 0, 0, errRangeInvalid},
+	}
+
+	for _, td := range testData {
+		start, end, err := parseRange(td.Range, 1000)
+		assert.ErrorIs(t, err, td.ExpErr, td.Range)
+		if td.ExpErr == nil {
+			assert.NoError(t, err, td.Range)
+			assert.Equal(t, td.ExpStart, start, td.Range)
+			assert.Equal(t, td.ExpEnd, end, td.Range)
+		}
+	}
+}
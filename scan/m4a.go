@@ -0,0 +1,62 @@
+package scan
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/drgolem/musiclab/decoders/alac"
+	"github.com/drgolem/musiclab/decoders/mp4"
+	"github.com/drgolem/musiclab/types"
+)
+
+type M4aTagDecoder struct{}
+
+func (d *M4aTagDecoder) Decode(file string) (*types.SongInfo, error) {
+	mp4File, err := mp4.ParseFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("ERR: %w, file: %s", err, file)
+	}
+
+	track, err := mp4File.AudioTrack()
+	if err != nil {
+		return nil, fmt.Errorf("ERR: %w, file: %s", err, file)
+	}
+
+	if track.SampleEntry.Format != "alac" {
+		// only ALAC is decoded, AAC files can't be played
+		fmt.Printf("skip m4a codec: %s (%s)\n", track.SampleEntry.Format, file)
+		return nil, nil
+	}
+
+	md := mp4File.Metadata
+
+	title := md.Title
+	if title == "" {
+		title = filepath.Base(file)
+	}
+
+	format := types.FrameFormat{
+		SampleRate:    track.SampleEntry.SampleRate,
+		Channels:      track.SampleEntry.Channels,
+		BitsPerSample: track.SampleEntry.BitsPerSample,
+	}
+	// sample entry can't hold sample rates above 65535, use ALAC config
+	cfg, err := alac.ParseConfig(track.SampleEntry.DecoderConfig)
+	if err == nil {
+		format.SampleRate = int(cfg.SampleRate)
+		format.Channels = int(cfg.NumChannels)
+		format.BitsPerSample = int(cfg.BitDepth)
+	}
+
+	songInfo := types.SongInfo{
+		Title:      title,
+		Artist:     md.Artist,
+		Album:      md.Album,
+		FilePath:   file,
+		FileFormat: types.FileFormat_M4A,
+		Duration:   track.Length(),
+		Format:     format,
+	}
+
+	return &songInfo, nil
+}
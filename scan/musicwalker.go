@@ -33,9 +33,7 @@ func MusicDocWalker(ctx context.Context,
 	cuesheetChan := make(chan CueSheet, MaxConcurrency)
 
 	if len(fileTypes) == 0 {
-		fileTypes = []types.FileFormatType{
-			types.FileFormat_MP3, types.FileFormat_FLAC, types.FileFormat_OGG,
-		}
+		fileTypes = MusicFileTypes()
 	}
 
 	wgProcess.Go(
@@ -72,7 +70,7 @@ func MusicDocWalker(ctx context.Context,
 
 					reqType := slices.Contains(fileTypes, ext)
 					if reqType {
-						// MP3, FLAC, OGG supported
+						// MP3, FLAC, OGG, M4A supported
 						select {
 						case filesChan <- osPathname:
 						case <-ctx.Done():
@@ -209,6 +207,24 @@ func MusicDocWalker(ctx context.Context,
 						return nil
 					})
 
+				case types.FileFormat_M4A:
+					wgSubProcess.Go(func() error {
+						tagDecoder := M4aTagDecoder{}
+						songInfo, err := tagDecoder.Decode(file)
+						if err != nil {
+							return err
+						}
+						if songInfo != nil {
+							sd := ToSongDocument(songInfo)
+							select {
+							case songsChan <- sd:
+							case <-ctxSub.Done():
+								return ctx.Err()
+							}
+						}
+						return nil
+					})
+
 				case types.FileFormat_WAV:
 					wgSubProcess.Go(func() error {
 						// TODO: process wav
@@ -20,6 +20,14 @@ const (
 	MaxConcurrency = 8
 )
 
+// MusicFileTypes returns file types scanned for songs by default
+func MusicFileTypes() []types.FileFormatType {
+	return []types.FileFormatType{
+		types.FileFormat_MP3, types.FileFormat_FLAC, types.FileFormat_OGG,
+		types.FileFormat_M4A,
+	}
+}
+
 type CueTrack struct {
 	Title    string
 	Artist   string
@@ -65,3 +73,19 @@ func ToSongDocument(si *types.SongInfo) types.SongDocument {
 
 	return sd
 }
+
+// TagDecoderForFile returns tag decoder matching file extension
+func TagDecoderForFile(fileName string) (MusicTagDecoder, error) {
+	ext := types.FileFormatType(strings.ToLower(filepath.Ext(fileName)))
+	switch ext {
+	case types.FileFormat_MP3:
+		return &Mp3TagDecoder{}, nil
+	case types.FileFormat_FLAC:
+		return &FlacTagDecoder{}, nil
+	case types.FileFormat_OGG:
+		return &OggTagDecoder{}, nil
+	case types.FileFormat_M4A:
+		return &M4aTagDecoder{}, nil
+	}
+	return nil, fmt.Errorf("unsupported file type: %s", ext)
+}
@@ -3,6 +3,8 @@ package types
 import (
 	"fmt"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,6 +15,7 @@ const (
 	FileFormat_FLAC FileFormatType = ".flac"
 	FileFormat_OGG  FileFormatType = ".ogg"
 	FileFormat_WAV  FileFormatType = ".wav"
+	FileFormat_M4A  FileFormatType = ".m4a"
 	FileFormat_CUE  FileFormatType = ".cue"
 )
 
@@ -32,6 +35,8 @@ type SongInfo struct {
 	FileFormat FileFormatType
 	FilePath   string `json:"FilePath,omitempty" bson:"FilePath,omitempty" structs:"FilePath,omitempty"`
 	ID         string
+	// musical key, e.g. "A minor", empty if not analyzed
+	Key string `json:"Key,omitempty" bson:"Key,omitempty" structs:"Key,omitempty"`
 }
 
 type SongLocation struct {
@@ -82,3 +87,28 @@ func (s *SongInfo) String() string {
 	return fmt.Sprintf("Duration: [%s], Title: [%s], Artist: [%s], Album: [%s], Format: [%s], file: [%s]",
 		s.Duration, s.Title, s.Artist, s.Album, s.Format.String(), s.FilePath)
 }
+
+// ParseFrameFormat parses format in FrameFormat.String form
+// (sample rate:channels:bits per sample), bits per sample default to 16
+func ParseFrameFormat(s string) (FrameFormat, error) {
+	var f FrameFormat
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return f, fmt.Errorf("invalid frame format: %s", s)
+	}
+	vals := []int{0, 0, 16}
+	for idx, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v <= 0 {
+			return f, fmt.Errorf("invalid frame format: %s", s)
+		}
+		vals[idx] = v
+	}
+
+	f.SampleRate = vals[0]
+	f.Channels = vals[1]
+	f.BitsPerSample = vals[2]
+
+	return f, nil
+}